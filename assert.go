@@ -0,0 +1,107 @@
+package a2asm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/taeber/a2asm/syntax"
+)
+
+// assertion is an ERR or ASSERT, checked once every line has been read so
+// that it may refer to labels defined after it.
+type assertion struct {
+	Directive string
+	Expr      expression
+	Limit     bool   // ERR \addr: the address must not be past Expr
+	Message   string // for ASSERT
+
+	File       string
+	LineNumber uint
+}
+
+// err handles Merlin's ERR directive, which fails the assembly if the value
+// of its expression is not zero, as in ERR *-1/$4000 to stop code running
+// into $4000. ERR \addr fails if the code before it runs past addr.
+func (s *state) err(operand string, args []syntax.Expr) error {
+	x, err := single("ERR", args)
+	if err != nil {
+		return err
+	}
+
+	a := &assertion{Directive: "ERR", File: s.File, LineNumber: s.LineNumber}
+	a.Limit = strings.HasPrefix(operand, "\\")
+	a.Expr = s.expression(x)
+
+	s.Assertions = append(s.Assertions, a)
+	return nil
+}
+
+// assert handles ASSERT expr,"message", which fails the assembly with the
+// message unless the value of the expression is true (not zero).
+func (s *state) assert(args []syntax.Expr) error {
+	if len(args) == 0 {
+		return fmt.Errorf("ASSERT needs an expression")
+	}
+
+	a := &assertion{
+		Directive:  "ASSERT",
+		Expr:       s.expression(args[0]),
+		File:       s.File,
+		LineNumber: s.LineNumber,
+	}
+
+	if len(args) > 1 {
+		msg, rest, err := readDelimited([]byte(args[1].(*syntax.Str).Text))
+		if err != nil {
+			return err
+		}
+		if len(rest) > 0 {
+			return fmt.Errorf("unexpected character after message: %c", rest[0])
+		}
+		for i := range msg {
+			msg[i] &^= highASCII
+		}
+		a.Message = string(msg)
+	}
+
+	s.Assertions = append(s.Assertions, a)
+	return nil
+}
+
+// checkAssertions checks each ERR and ASSERT, reporting the first to fail.
+func (s *state) checkAssertions() error {
+	for _, a := range s.Assertions {
+		value, _, err := s.eval(a.Expr)
+		if err == nil {
+			err = a.check(value)
+		}
+		if err != nil {
+			s.File, s.LineNumber = a.File, a.LineNumber
+			return s.error(err)
+		}
+	}
+
+	return nil
+}
+
+func (a *assertion) check(value uint16) error {
+	switch {
+	case a.Limit:
+		if a.Expr.Here > value {
+			return fmt.Errorf("ERR: code reaches $%04X, past $%04X", a.Expr.Here, value)
+		}
+
+	case a.Directive == "ERR":
+		if value != 0 {
+			return fmt.Errorf("ERR: %s is $%04X, not 0", a.Expr.X, value)
+		}
+
+	case value == 0:
+		if a.Message != "" {
+			return fmt.Errorf("assertion failed: %s", a.Message)
+		}
+		return fmt.Errorf("assertion failed: %s", a.Expr.X)
+	}
+
+	return nil
+}
@@ -0,0 +1,38 @@
+package a2asm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAssertions(t *testing.T) {
+	tests := map[string]string{
+		// Passing
+		" ORG $3FFE\n RTS\n ERR *-1/$4000":               "",
+		" ORG $300\n RTS\n ERR \\$301":                   "",
+		" ORG $300\n ASSERT END<$400,'too big'\nEND RTS": "",
+		" ORG $300\n ASSERT SIZE=1\n RTS\nSIZE EQU 1":    "",
+
+		// Failing
+		" ORG $3FFF\n NOP\n NOP\n ERR *-1/$4000":                     "line 4 - ERR: *-1/$4000 is $0001, not 0",
+		" ORG $300\n NOP\n NOP\n ERR \\$301":                         "line 4 - ERR: code reaches $0302, past $0301",
+		" ORG $300\n ASSERT END<$301,\"too big\"\n NOP\nEND RTS":     "line 2 - assertion failed: too big",
+		" ORG $300\n ASSERT END<$301,'no room' ; why\n NOP\nEND RTS": "line 2 - assertion failed: no room",
+		" ORG $300\n ASSERT END<$301,'no room'!\nEND RTS":            "line 2 - unexpected character after message: !",
+		" ORG $300\n ASSERT END=$301\nEND RTS":                       "line 2 - assertion failed: END=$301",
+		" ORG $300\n ASSERT NOWHERE\n RTS":                           "line 2 - unknown label: NOWHERE",
+	}
+
+	for src, expected := range tests {
+		_, err := AssembleSegments(strings.NewReader(src))
+		if expected == "" {
+			if err != nil {
+				t.Errorf("%q: %v", src, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != expected {
+			t.Errorf("%q: expected %q; got %v", src, expected, err)
+		}
+	}
+}
@@ -0,0 +1,862 @@
+package a2asm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/taeber/a2asm/syntax"
+)
+
+// CA65Options configures AssembleCA65.
+type CA65Options struct {
+	// Config is an ld65-style linker configuration with MEMORY and SEGMENTS
+	// blocks. When nil, ZEROPAGE is placed in zero page and CODE, RODATA,
+	// DATA and BSS follow one another from $0800.
+	Config io.Reader
+
+	// Open opens the files named by .include.
+	Open func(name string) (io.ReadCloser, error)
+}
+
+// defaultCA65Config is used when CA65Options has no Config.
+const defaultCA65Config = `
+MEMORY {
+	ZP:   start = $0000, size = $0100, file = "";
+	MAIN: start = $0800, size = $B800, file = %O;
+}
+SEGMENTS {
+	ZEROPAGE: load = ZP,   type = zp,  optional = yes;
+	CODE:     load = MAIN, type = ro,  optional = yes;
+	RODATA:   load = MAIN, type = ro,  optional = yes;
+	DATA:     load = MAIN, type = rw,  optional = yes;
+	BSS:      load = MAIN, type = bss, optional = yes;
+}
+`
+
+// ca65ProvisionalBase is where segments are assembled while measuring them.
+// It keeps their labels out of zero page so instructions are sized the same
+// once the segments are placed.
+const ca65ProvisionalBase = 0x0200
+
+// AssembleCA65 reads a practical subset of ca65-style 6502 assembly from src
+// and returns one segment for each MEMORY area of the configuration that is
+// written to a file. The supported directives are .org, .byte, .word, .res,
+// .segment, .proc, .include and .macro. Instructions are encoded as they are
+// for MERLIN sources, so zero page addressing is only used for labels
+// defined before they are used, and expressions are evaluated left to right:
+// those that ca65 would evaluate differently, by precedence, are an error.
+//
+// Code following .org is placed at that address rather than in a MEMORY
+// area and is returned as its own segment.
+func AssembleCA65(src io.Reader, opts CA65Options) (segments []Segment, err error) {
+	config := opts.Config
+	if config == nil {
+		config = strings.NewReader(defaultCA65Config)
+	}
+
+	var cfg *ldConfig
+	if cfg, err = parseLdConfig(config); err != nil {
+		return
+	}
+
+	pre := ca65Preprocessor{open: opts.Open, macros: make(map[string]*ca65Macro)}
+	if err = pre.read("", src, 0); err != nil {
+		return
+	}
+
+	// Measure each segment, then assemble again with them in place.
+	first := newCA65Pass(cfg, nil, nil)
+	if err = first.run(pre.lines); err != nil {
+		return
+	}
+
+	for _, seg := range cfg.Segments {
+		if !seg.Optional && first.sizes[seg.Name] == 0 && !first.named[seg.Name] {
+			return nil, fmt.Errorf("segment %s is not in the source; make it optional = yes if it need not be", seg.Name)
+		}
+	}
+
+	var bases map[string]address
+	if bases, err = cfg.layout(first.sizes, first.used); err != nil {
+		return
+	}
+
+	second := newCA65Pass(cfg, bases, first.s)
+	if err = second.run(pre.lines); err != nil {
+		return
+	}
+
+	for _, name := range second.used {
+		if second.sizes[name] != first.sizes[name] {
+			return nil, fmt.Errorf("segment %s changed size from %d to %d bytes once placed",
+				name, first.sizes[name], second.sizes[name])
+		}
+	}
+
+	if err = second.s.finish(); err != nil {
+		return
+	}
+
+	return second.segments(), nil
+}
+
+type ca65Line struct {
+	File   string
+	Number uint
+	Text   string
+}
+
+type ca65Macro struct {
+	Params []string
+	Body   []ca65Line
+}
+
+// ca65Preprocessor expands .include and .macro into a flat list of lines.
+type ca65Preprocessor struct {
+	open   func(name string) (io.ReadCloser, error)
+	macros map[string]*ca65Macro
+	lines  []ca65Line
+}
+
+const ca65MaxDepth = 16
+
+func (p *ca65Preprocessor) read(file string, src io.Reader, depth int) error {
+	if depth > ca65MaxDepth {
+		return fmt.Errorf("%s: .include nested too deeply", file)
+	}
+
+	var lines []ca65Line
+	scanner := bufio.NewScanner(src)
+	for n := uint(1); scanner.Scan(); n++ {
+		lines = append(lines, ca65Line{file, n, scanner.Text()})
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return p.process(lines, depth)
+}
+
+func (p *ca65Preprocessor) process(lines []ca65Line, depth int) error {
+	var macro *ca65Macro
+
+	for _, line := range lines {
+		text := stripCA65Comment(line.Text)
+		label, rest := splitCA65Label(text)
+		word, args := splitCA65Word(rest)
+		keyword := strings.ToLower(word)
+
+		if macro != nil {
+			if keyword == ".endmacro" || keyword == ".endmac" {
+				macro = nil
+				continue
+			}
+			macro.Body = append(macro.Body, line)
+			continue
+		}
+
+		switch {
+		case keyword == ".macro" || keyword == ".mac":
+			name, params := splitCA65Word(args)
+			if name == "" {
+				return line.errorf(".macro needs a name")
+			}
+			macro = &ca65Macro{}
+			for _, param := range splitCA65List(params) {
+				macro.Params = append(macro.Params, strings.TrimSpace(param))
+			}
+			p.macros[name] = macro
+
+		case keyword == ".include":
+			name, err := unquoteCA65(args)
+			if err != nil {
+				return line.error(err)
+			}
+			if p.open == nil {
+				return line.errorf("cannot open %s", name)
+			}
+			fp, err := p.open(name)
+			if err != nil {
+				return line.error(err)
+			}
+			err = p.read(name, fp, depth+1)
+			fp.Close()
+			if err != nil {
+				return err
+			}
+
+		case p.macros[word] != nil:
+			if depth > ca65MaxDepth {
+				return line.errorf("macro %s nested too deeply", word)
+			}
+			if label != "" {
+				p.lines = append(p.lines, ca65Line{line.File, line.Number, label + ":"})
+			}
+			if err := p.process(p.macros[word].expand(line, args), depth+1); err != nil {
+				return err
+			}
+
+		default:
+			p.lines = append(p.lines, line)
+		}
+	}
+
+	if macro != nil {
+		return fmt.Errorf("missing .endmacro")
+	}
+
+	return nil
+}
+
+// expand substitutes the arguments of an invocation for the macro's
+// parameters. Expanded lines keep the invocation's position.
+func (m *ca65Macro) expand(at ca65Line, args string) []ca65Line {
+	values := splitCA65List(args)
+	replace := make(map[string]string)
+	for i, param := range m.Params {
+		replace[param] = ""
+		if i < len(values) {
+			replace[param] = strings.TrimSpace(values[i])
+		}
+	}
+
+	var lines []ca65Line
+	for _, line := range m.Body {
+		text := mapCA65Identifiers(line.Text, func(name string) string {
+			if value, ok := replace[name]; ok {
+				return value
+			}
+			return name
+		})
+		lines = append(lines, ca65Line{at.File, at.Number, text})
+	}
+
+	return lines
+}
+
+func (line ca65Line) error(err error) error {
+	return &Error{File: line.File, Line: line.Number, Message: err.Error()}
+}
+
+func (line ca65Line) errorf(format string, a ...interface{}) error {
+	return line.error(fmt.Errorf(format, a...))
+}
+
+// ca65Pass assembles the preprocessed lines once.
+type ca65Pass struct {
+	s   *state
+	cfg *ldConfig
+
+	bases    map[string]address // nil while measuring
+	counters map[string]address
+	sizes    map[string]int
+	used     []string
+	named    map[string]bool // selected with .segment
+	segment  string
+	absolute bool // after .org, until the next .segment
+	orgs     map[address]bool
+
+	scopes []string
+	known  *state // labels from the previous pass, for resolving scopes
+}
+
+func newCA65Pass(cfg *ldConfig, bases map[string]address, known *state) *ca65Pass {
+	return &ca65Pass{
+		s:        newState(nil),
+		cfg:      cfg,
+		bases:    bases,
+		counters: make(map[string]address),
+		sizes:    make(map[string]int),
+		named:    make(map[string]bool),
+		orgs:     make(map[address]bool),
+		known:    known,
+	}
+}
+
+func (c *ca65Pass) run(lines []ca65Line) error {
+	// Code before the first .segment goes in CODE, which the configuration
+	// need only have if there is some.
+	if c.cfg.segment("CODE") != nil {
+		if err := c.switchSegment("CODE"); err != nil {
+			return err
+		}
+	}
+
+	for _, line := range lines {
+		c.s.LineNumber = line.Number
+		written := c.s.Written
+		if err := c.statement(line.Text); err != nil {
+			return line.error(err)
+		}
+		if c.segment == "" && !c.absolute && c.s.Written != written {
+			return line.error(fmt.Errorf("segment CODE is not in the linker configuration"))
+		}
+	}
+
+	if len(c.scopes) > 0 {
+		return fmt.Errorf("missing .endproc for %s", c.scopes[len(c.scopes)-1])
+	}
+
+	c.saveCounter()
+
+	for _, name := range c.used {
+		c.sizes[name] = int(c.counters[name]) - int(c.base(name))
+	}
+
+	return nil
+}
+
+func (c *ca65Pass) statement(text string) error {
+	s := c.s
+
+	text = stripCA65Comment(text)
+	label, rest := splitCA65Label(text)
+
+	if label != "" {
+		if label[0] == '@' {
+			s.Labels[s.CurrentLabel+":"+label[1:]] = s.Address
+		} else {
+			label = c.qualify(label)
+			s.Labels[label] = s.Address
+			s.CurrentLabel = label
+		}
+	}
+
+	word, args := splitCA65Word(rest)
+	if word == "" {
+		return nil
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(args), "=") || strings.HasPrefix(strings.TrimSpace(args), ":=") {
+		value := strings.TrimPrefix(strings.TrimLeft(args, " \t:"), "=")
+		x, err := c.expr(value)
+		if err != nil {
+			return err
+		}
+		return s.equ(c.qualify(word), []syntax.Expr{x})
+	}
+
+	if word[0] == '.' {
+		return c.directive(strings.ToLower(word), args)
+	}
+
+	l := &syntax.Line{Opcode: syntax.Field{Text: word}}
+	if syntax.IsInstruction(l.Mnemonic()) {
+		l.Instruction = l.Mnemonic()
+	}
+	operand, err := c.operand(args)
+	if err != nil {
+		return err
+	}
+	var x syntax.Expr
+	l.Mode, l.Size, x, err = syntax.ParseOperand(string(operand), 1)
+	if x != nil {
+		l.Args = []syntax.Expr{x}
+	}
+	return s.instruction(l, err)
+}
+
+func (c *ca65Pass) directive(name, args string) error {
+	s := c.s
+
+	switch name {
+	case ".org":
+		x, err := c.expr(args)
+		if err != nil {
+			return err
+		}
+		num, ref, err := s.eval(s.expression(x))
+		if err != nil {
+			return err
+		}
+		if ref != "" {
+			return fmt.Errorf(".org needs a constant address")
+		}
+		c.saveCounter()
+		s.closeSegment()
+		s.Origin, s.Address, s.Top = num, num, false
+		c.absolute = true
+		c.orgs[num] = true
+
+	case ".byte", ".byt":
+		for _, item := range splitCA65List(args) {
+			item = strings.TrimSpace(item)
+			if len(item) > 0 && item[0] == '"' {
+				str, err := unquoteCA65(item)
+				if err != nil {
+					return err
+				}
+				for i := 0; i < len(str); i++ {
+					s.write(str[i])
+				}
+				continue
+			}
+			x, err := c.expr(item)
+			if err == nil {
+				err = s.writeData(x, 1)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+	case ".word", ".addr":
+		for _, item := range splitCA65List(args) {
+			x, err := c.expr(item)
+			if err == nil {
+				err = s.writeData(x, 2)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+	case ".res":
+		items := splitCA65List(args)
+		if len(items) == 0 || len(items) > 2 {
+			return fmt.Errorf(".res needs a count and an optional fill value")
+		}
+		x, err := c.expr(items[0])
+		if err != nil {
+			return err
+		}
+		count, ref, err := s.eval(s.expression(x))
+		if err == nil && ref != "" {
+			err = fmt.Errorf(".res needs a constant count")
+		}
+		if err != nil {
+			return err
+		}
+		var fill uint16
+		if len(items) == 2 {
+			if x, err = c.expr(items[1]); err != nil {
+				return err
+			}
+			if fill, ref, err = s.eval(s.expression(x)); err == nil && ref != "" {
+				err = fmt.Errorf(".res needs a constant fill value")
+			}
+			if err != nil {
+				return err
+			}
+		}
+		for i := uint16(0); i < count; i++ {
+			s.writeShort(fill)
+		}
+
+	case ".segment":
+		seg, err := unquoteCA65(strings.SplitN(args, ":", 2)[0])
+		if err != nil {
+			return err
+		}
+		c.named[seg] = true
+		return c.switchSegment(seg)
+
+	case ".proc":
+		scope, _ := splitCA65Word(args)
+		if scope == "" {
+			return fmt.Errorf(".proc needs a name")
+		}
+		label := c.qualify(scope)
+		s.Labels[label] = s.Address
+		s.CurrentLabel = label
+		c.scopes = append(c.scopes, scope)
+
+	case ".endproc":
+		if len(c.scopes) == 0 {
+			return fmt.Errorf(".endproc without .proc")
+		}
+		c.scopes = c.scopes[:len(c.scopes)-1]
+
+	case ".setcpu":
+		cpu, err := unquoteCA65(args)
+		if err != nil {
+			return err
+		}
+		if cpu != "6502" {
+			return fmt.Errorf("unsupported CPU: %s", cpu)
+		}
+
+	case ".p02":
+
+	default:
+		return fmt.Errorf("unsupported directive: %s", name)
+	}
+
+	return nil
+}
+
+// base returns where segment name starts in this pass.
+func (c *ca65Pass) base(name string) address {
+	if c.bases != nil {
+		return c.bases[name]
+	}
+
+	if seg := c.cfg.segment(name); seg != nil && seg.Type == "zp" {
+		return address(c.cfg.memory(seg.Load).Start)
+	}
+
+	return ca65ProvisionalBase
+}
+
+func (c *ca65Pass) saveCounter() {
+	if !c.absolute {
+		c.counters[c.segment] = c.s.Address
+	}
+}
+
+func (c *ca65Pass) switchSegment(name string) error {
+	if c.cfg.segment(name) == nil {
+		return fmt.Errorf("segment %s is not in the linker configuration", name)
+	}
+
+	s := c.s
+
+	if c.segment != "" {
+		c.saveCounter()
+		s.closeSegment()
+	}
+
+	next, ok := c.counters[name]
+	if !ok {
+		next = c.base(name)
+		c.used = append(c.used, name)
+	}
+
+	c.segment = name
+	c.absolute = false
+	s.Origin, s.Address, s.Top = next, next, false
+	s.OriginLine = s.LineNumber
+	return nil
+}
+
+// qualify returns name as defined in the current .proc scope.
+func (c *ca65Pass) qualify(name string) string {
+	if len(c.scopes) == 0 {
+		return name
+	}
+	return strings.Join(c.scopes, "::") + "::" + name
+}
+
+// resolve returns the name that a reference to name refers to from the
+// current scope: the innermost enclosing .proc that defines it, or the
+// global name.
+func (c *ca65Pass) resolve(name string) string {
+	if strings.HasPrefix(name, "::") {
+		return name[2:]
+	}
+
+	for i := len(c.scopes); i > 0; i-- {
+		scoped := strings.Join(c.scopes[:i], "::") + "::" + name
+		if c.defines(c.s, scoped) || (c.known != nil && c.defines(c.known, scoped)) {
+			return scoped
+		}
+	}
+
+	return name
+}
+
+func (c *ca65Pass) defines(s *state, name string) bool {
+	if _, ok := s.Labels[name]; ok {
+		return true
+	}
+	_, ok := s.Constants[name]
+	return ok
+}
+
+// operand translates a ca65 operand into the form the MERLIN encoder reads.
+// Operands that the encoder would evaluate differently from ca65 are an
+// error; see checkCA65Order.
+func (c *ca65Pass) operand(text string) ([]byte, error) {
+	text = strings.TrimSpace(text)
+	if strings.EqualFold(text, "a") {
+		return []byte("A"), nil
+	}
+
+	text = mapCA65Identifiers(text, func(name string) string {
+		if name[0] == '@' {
+			return ":" + name[1:]
+		}
+		return c.resolve(name)
+	})
+
+	var out []byte
+	for i := 0; i < len(text); i++ {
+		ch := text[i]
+		switch {
+		case ch == ' ' || ch == '\t':
+			continue
+		case ch == ',' && i+1 < len(text):
+			// Index registers
+			reg := strings.TrimLeft(text[i+1:], " \t")
+			if len(reg) > 0 && strings.ContainsRune("xXyY", rune(reg[0])) &&
+				(len(reg) == 1 || reg[1] == ')' || reg[1] == ' ') {
+				out = append(out, ',', reg[0]&^0x20)
+				i = len(text) - len(reg)
+				continue
+			}
+		}
+		out = append(out, ch)
+	}
+
+	return out, checkCA65Order(string(out))
+}
+
+// expr translates and parses a ca65 expression, as in .org or .word.
+func (c *ca65Pass) expr(text string) (syntax.Expr, error) {
+	operand, err := c.operand(text)
+	if err != nil {
+		return nil, err
+	}
+	return syntax.ParseExpr(string(operand), 1)
+}
+
+// checkCA65Order returns an error for an operand, in MERLIN form, whose value
+// depends on the order it is evaluated in. The encoder works from left to
+// right, as MERLIN does, where ca65 evaluates *, / and & before + and -, and
+// applies < and > to the first term only.
+func checkCA65Order(operand string) error {
+	_, _, x, err := syntax.ParseOperand(operand, 1)
+	if err != nil || x == nil {
+		// Left for the encoder to report.
+		return nil
+	}
+
+	var selector byte
+	if u, ok := x.(*syntax.Unary); ok && (u.Op == '<' || u.Op == '>') {
+		selector, x = u.Op, u.X
+	}
+
+	// The operators, from left to right.
+	var ops []byte
+	for b, ok := x.(*syntax.Binary); ok; b, ok = b.X.(*syntax.Binary) {
+		ops = append([]byte{b.Op}, ops...)
+	}
+
+	additive, multiplicative := false, false
+	for _, op := range ops {
+		switch op {
+		case '+', '-':
+			additive = true
+		case '*', '/', '&':
+			if additive {
+				return fmt.Errorf("%s would be evaluated left to right, not with ca65's precedence; put %c before any + or -", operand, op)
+			}
+			multiplicative = true
+		}
+	}
+
+	// The low byte of a sum is the same either way.
+	if selector == '>' && len(ops) > 0 || selector == '<' && multiplicative {
+		return fmt.Errorf("%s would take a byte of the whole expression, where ca65 takes that of the first term", operand)
+	}
+	return nil
+}
+
+// segments returns what the configuration writes to files: the used part of
+// each MEMORY area, then any code placed with .org.
+func (c *ca65Pass) segments() (segments []Segment) {
+	s := c.s
+
+	owner := func(start address) *ldSegment {
+		for _, name := range c.used {
+			base := c.bases[name]
+			if start >= base && int(start) < int(base)+c.sizes[name] {
+				return c.cfg.segment(name)
+			}
+		}
+		return nil
+	}
+
+	for _, mem := range c.cfg.Memory {
+		if !mem.File {
+			continue
+		}
+
+		var image []byte
+		if mem.Fill {
+			image = make([]byte, mem.Size)
+		}
+
+		for _, span := range s.Segments {
+			seg := owner(span.Start)
+			if c.orgs[span.Start] || seg == nil || seg.Load != mem.Name || seg.Type == "bss" {
+				continue
+			}
+			end := int(span.End) - mem.Start
+			for len(image) < end {
+				image = append(image, 0)
+			}
+			copy(image[int(span.Start)-mem.Start:], s.Memory[span.Start:span.End])
+		}
+
+		if mem.Fill && mem.FillVal != 0 {
+			filled := make([]bool, len(image))
+			for _, span := range s.Segments {
+				if seg := owner(span.Start); seg != nil && seg.Load == mem.Name && seg.Type != "bss" {
+					for i := int(span.Start); i < int(span.End); i++ {
+						filled[i-mem.Start] = true
+					}
+				}
+			}
+			for i := range image {
+				if !filled[i] {
+					image[i] = mem.FillVal
+				}
+			}
+		}
+
+		if len(image) > 0 {
+			segments = append(segments, Segment{uint16(mem.Start), image})
+		}
+	}
+
+	for _, span := range s.Segments {
+		if c.orgs[span.Start] {
+			segments = append(segments, Segment{span.Start, s.Memory[span.Start:span.End]})
+		}
+	}
+
+	return
+}
+
+// stripCA65Comment removes a ; comment that is not within quotes.
+func stripCA65Comment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		ch := text[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == ';':
+			return text[:i]
+		}
+	}
+	return text
+}
+
+// splitCA65Label splits "label: rest" into its label and the rest.
+func splitCA65Label(text string) (label, rest string) {
+	trimmed := strings.TrimLeft(text, " \t")
+	i := 0
+	if i < len(trimmed) && trimmed[i] == '@' {
+		i++
+	}
+	for i < len(trimmed) && isCA65IdentChar(trimmed[i]) {
+		i++
+	}
+	if i == 0 || i >= len(trimmed) || trimmed[i] != ':' ||
+		(i+1 < len(trimmed) && (trimmed[i+1] == ':' || trimmed[i+1] == '=')) {
+		return "", text
+	}
+	return trimmed[:i], trimmed[i+1:]
+}
+
+// splitCA65Word splits off the first whitespace-separated word of text.
+func splitCA65Word(text string) (word, rest string) {
+	text = strings.TrimLeft(text, " \t")
+	i := strings.IndexAny(text, " \t=")
+	if i < 0 {
+		return text, ""
+	}
+	return text[:i], text[i:]
+}
+
+// splitCA65List splits text at the commas that are not within quotes or
+// parentheses.
+func splitCA65List(text string) (items []string) {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i < len(text); i++ {
+		ch := text[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '(':
+			depth++
+		case ch == ')':
+			depth--
+		case ch == ',' && depth == 0:
+			items = append(items, text[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, text[start:])
+}
+
+func unquoteCA65(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if len(text) < 2 || text[0] != '"' || text[len(text)-1] != '"' {
+		return "", fmt.Errorf("expected a quoted string; got %s", text)
+	}
+	return text[1 : len(text)-1], nil
+}
+
+func isCA65IdentChar(ch byte) bool {
+	return isLetter(ch) || isDigit(ch) || ch == '_'
+}
+
+// mapCA65Identifiers replaces each identifier in text, outside of quotes and
+// numeric literals, with the result of fn. Scoped names such as "a::b" and
+// cheap locals such as "@loop" are passed to fn whole.
+func mapCA65Identifiers(text string, fn func(name string) string) string {
+	var out strings.Builder
+	for i := 0; i < len(text); {
+		ch := text[i]
+		switch {
+		case ch == '"' || ch == '\'':
+			j := i + 1
+			for j < len(text) && text[j] != ch {
+				j++
+			}
+			if j < len(text) {
+				j++
+			}
+			out.WriteString(text[i:j])
+			i = j
+
+		case ch == '$' || isDigit(ch):
+			j := i + 1
+			for j < len(text) && isHex(text[j]) {
+				j++
+			}
+			out.WriteString(text[i:j])
+			i = j
+
+		case ch == '@' || isLetter(ch) || ch == '_' || strings.HasPrefix(text[i:], "::"):
+			j := i
+			if ch == '@' {
+				j++
+			}
+			for j < len(text) {
+				if strings.HasPrefix(text[j:], "::") {
+					j += 2
+				} else if isCA65IdentChar(text[j]) {
+					j++
+				} else {
+					break
+				}
+			}
+			out.WriteString(fn(text[i:j]))
+			i = j
+
+		default:
+			out.WriteByte(ch)
+			i++
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,182 @@
+package a2asm
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestCA65(t *testing.T) {
+	prg := strings.NewReader(`
+; Print a message
+        .segment "ZEROPAGE"
+ptr:    .res 2
+        .segment "CODE"
+        .include "load16.inc"
+.proc   main
+        load16 ptr, message
+        ldy #0
+@loop:  lda (ptr),y
+        beq done
+        jsr $FDED
+        iny
+        bne @loop
+done:   rts
+.endproc
+        .segment "RODATA"
+message: .byte "HI", $8D, 0
+        .word main, main::done
+`)
+	open := func(name string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(`
+.macro  load16 dest, value
+        lda #<value
+        sta dest
+        lda #>value
+        sta dest+1
+.endmacro
+`)), nil
+	}
+
+	segments, err := AssembleCA65(prg, CA65Options{Open: open})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(segments) != 1 || segments[0].Origin != 0x800 {
+		t.Errorf("Expected one segment at $0800; got %v", segments)
+		return
+	}
+
+	expected := []byte("" +
+		"\xA9\x15\x85\x00\xA9\x08\x85\x01" +
+		"\xA0\x00\xB1\x00\xF0\x06\x20\xED\xFD\xC8\xD0\xF6\x60" +
+		"HI\x8D\x00\x00\x08\x14\x08")
+	if !bytes.Equal(expected, segments[0].Data) {
+		t.Errorf("Expected %v; got %v", expected, segments[0].Data)
+	}
+}
+
+func TestCA65Config(t *testing.T) {
+	config := strings.NewReader(`
+# Code at $6000 and data on the next page
+MEMORY {
+    ZP:   start = $80, size = $80, file = "";
+    MAIN: start = $6000, size = $200, file = %O, fill = yes, fillval = $EA;
+}
+SEGMENTS {
+    ZEROPAGE: load = ZP, type = zp;
+    CODE:     load = MAIN, type = ro;
+    DATA:     load = MAIN, type = rw, start = $6100;
+}
+`)
+	prg := strings.NewReader(`
+.segment "ZEROPAGE"
+count:  .res 1
+.segment "CODE"
+        lda value
+        sta count
+        rts
+.segment "DATA"
+value:  .byte 42
+`)
+
+	segments, err := AssembleCA65(prg, CA65Options{Config: config})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(segments) != 1 || segments[0].Origin != 0x6000 || len(segments[0].Data) != 0x200 {
+		t.Errorf("Expected $200 bytes at $6000; got %v", segments)
+		return
+	}
+
+	data := segments[0].Data
+	expected := []byte("\x2A\xEA")
+	if !bytes.Equal(expected, data[0x100:0x102]) {
+		t.Errorf("Expected %v; got %v", expected, data[0x100:0x102])
+	}
+
+	expected = []byte("\xAD\x00\x61\x85\x80\x60\xEA")
+	if !bytes.Equal(expected, data[0:7]) {
+		t.Errorf("Expected %v; got %v", expected, data[0:7])
+	}
+}
+
+func TestCA65Overflow(t *testing.T) {
+	config := strings.NewReader(`
+MEMORY { MAIN: start = $300, size = 2, file = %O; }
+SEGMENTS { CODE: load = MAIN, type = ro; }
+`)
+
+	_, err := AssembleCA65(strings.NewReader(" jsr $FDED"), CA65Options{Config: config})
+	if err == nil || !strings.Contains(err.Error(), "overflows memory area MAIN by 1 bytes") {
+		t.Errorf("Expected an overflow error; got %v", err)
+	}
+}
+
+func TestCA65Segments(t *testing.T) {
+	// MAIN has no file attribute, so it is written as ld65 would, and there
+	// is no CODE segment, which the source does not use.
+	config := `
+MEMORY { MAIN: start = $300, size = $100; }
+SEGMENTS {
+    DATA:   load = MAIN, type = rw;
+    RODATA: load = MAIN, type = ro, optional = yes;
+}
+`
+	segments, err := AssembleCA65(strings.NewReader(`.segment "DATA"
+.byte 1, 2`), CA65Options{Config: strings.NewReader(config)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 1 || segments[0].Origin != 0x300 || !bytes.Equal(segments[0].Data, []byte{1, 2}) {
+		t.Errorf("Expected 01 02 at $300; got %v", segments)
+	}
+
+	_, err = AssembleCA65(strings.NewReader(" rts"), CA65Options{Config: strings.NewReader(config)})
+	if err == nil || !strings.Contains(err.Error(), "segment CODE is not in the linker configuration") {
+		t.Errorf("Expected CODE to be missing; got %v", err)
+	}
+
+	_, err = AssembleCA65(strings.NewReader(`.segment "RODATA"
+.byte 1`), CA65Options{Config: strings.NewReader(config)})
+	if err == nil || !strings.Contains(err.Error(), "segment DATA is not in the source") {
+		t.Errorf("Expected DATA to be missing; got %v", err)
+	}
+}
+
+func TestCA65Precedence(t *testing.T) {
+	segments, err := AssembleCA65(strings.NewReader(`
+start   = $0800
+        .word 2*4+start, 3*2+1
+        lda #<start+1
+`), CA65Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte("\x08\x08\x07\x00\xA9\x01")
+	if len(segments) != 1 || !bytes.Equal(expected, segments[0].Data) {
+		t.Errorf("Expected %v; got %v", expected, segments)
+	}
+
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{".word start+2*4, 1+2*3", "start+2*4 would be evaluated left to right, not with ca65's precedence; put * before any + or -"},
+		{"lda #>start+1", "#>start+1 would take a byte of the whole expression, where ca65 takes that of the first term"},
+		{"lda start-1/2", "start-1/2 would be evaluated left to right, not with ca65's precedence; put / before any + or -"},
+	}
+	for _, test := range tests {
+		_, err := AssembleCA65(strings.NewReader("start = $0800\n"+test.src+"\n"), CA65Options{})
+		if err == nil || !strings.HasSuffix(err.Error(), test.expected) {
+			t.Errorf("Expected %q; got %v", test.expected, err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package a2asm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// charset is the character generator that decides which screen codes show
+// which characters on the 40-column text screen ($400-$7FF):
+//
+//	        II+             //e             //e alternate
+//	$00-$3F inverse @-?     inverse @-?     inverse @-?
+//	$40-$7F flashing @-?    flashing @-?    MouseText, inverse a-~
+//	$80-$FF normal @-?      normal @-~      normal @-~
+//
+// The II+ has no lowercase and only the alternate //e set has MouseText and
+// inverse lowercase, in place of flashing text.
+type charset int
+
+const (
+	charsetIIe    charset = iota // primary //e character set
+	charsetIIPlus                // II and II+
+	charsetIIeAlt                // alternate //e set, enhanced with MouseText
+)
+
+var charsetNames = map[string]charset{
+	"IIE":     charsetIIe,
+	"II+":     charsetIIPlus,
+	"IIE-ALT": charsetIIeAlt,
+}
+
+func (cs charset) String() string {
+	for name, c := range charsetNames {
+		if c == cs {
+			return name
+		}
+	}
+	return fmt.Sprintf("charset(%d)", int(cs))
+}
+
+// setCharset handles the CHARSET directive, which selects the character set
+// that SCR, INV, FLS and MTX encode strings for: IIE (the default), II+ or
+// IIE-ALT.
+func (s *state) setCharset(operand string) error {
+	name := strings.ToUpper(operand)
+	cs, ok := charsetNames[name]
+	if !ok {
+		return fmt.Errorf("unknown character set: %s; expected IIE, II+ or IIE-ALT", name)
+	}
+
+	s.Charset = cs
+	return nil
+}
+
+// screenCode returns the screen code that shows ch on the text screen as the
+// string directive mneumonic asks: normal (SCR), inverse (INV), flashing (FLS)
+// or as MouseText (MTX), where @, A-Z, [, \, ], ^ and _ pick the glyph.
+func (cs charset) screenCode(ch byte, mneumonic string) (byte, error) {
+	ch &^= highASCII
+
+	if ch < 0x20 || ch == 0x7F {
+		return 0, fmt.Errorf("$%02X has no screen code", ch)
+	}
+
+	lower := ch >= 0x60
+
+	switch mneumonic {
+	case "SCR":
+		if lower && cs == charsetIIPlus {
+			return 0, fmt.Errorf("no lowercase %q in the %s character set", ch, cs)
+		}
+		return ch | highASCII, nil
+
+	case "INV":
+		if !lower {
+			return ch & 0x3F, nil
+		}
+		if cs != charsetIIeAlt {
+			return 0, fmt.Errorf("no inverse %q in the %s character set", ch, cs)
+		}
+		return ch, nil
+
+	case "FLS":
+		if cs == charsetIIeAlt {
+			return 0, fmt.Errorf("no flashing text in the %s character set", cs)
+		}
+		if lower {
+			return 0, fmt.Errorf("no flashing %q in the %s character set", ch, cs)
+		}
+		return ch&0x3F | 0x40, nil
+
+	case "MTX":
+		if cs != charsetIIeAlt {
+			return 0, fmt.Errorf("no MouseText in the %s character set; use CHARSET IIE-ALT", cs)
+		}
+		if ch < 0x40 || lower {
+			return 0, fmt.Errorf("no MouseText glyph for %q; expected @, A-Z, [, \\, ], ^ or _", ch)
+		}
+		return ch, nil
+	}
+
+	return ch, nil
+}
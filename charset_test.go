@@ -0,0 +1,48 @@
+package a2asm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestScreenCodes(t *testing.T) {
+	tests := []struct {
+		Source   string
+		Expected string
+	}{
+		{` SCR "Hi!"`, "\xC8\xE9\xA1"},
+		{` INV "A1 @"`, "\x01\x31\x20\x00"},
+		{` FLS 'A1'`, "\x41\x71"},
+		{" CHARSET II+\n SCR 'HI'", "\xC8\xC9"},
+		{" CHARSET IIE-ALT\n INV 'Ab'", "\x01\x62"},
+		{" CHARSET IIE-ALT\n MTX '@A_'", "\x40\x41\x5F"},
+	}
+
+	for _, test := range tests {
+		actual := assembleBytes(t, test.Source)
+		if !bytes.Equal([]byte(test.Expected), actual) {
+			t.Errorf("%q: expected %x; got %x", test.Source, test.Expected, actual)
+		}
+	}
+}
+
+func TestUnmappableScreenCodes(t *testing.T) {
+	tests := map[string]string{
+		" CHARSET II+\n SCR 'Hi'":    "line 2 - no lowercase 'i' in the II+ character set",
+		` INV 'a'`:                   "line 1 - no inverse 'a' in the IIE character set",
+		` FLS 'a'`:                   "line 1 - no flashing 'a' in the IIE character set",
+		" CHARSET IIE-ALT\n FLS 'A'": "line 2 - no flashing text in the IIE-ALT character set",
+		` MTX 'A'`:                   "line 1 - no MouseText in the IIE character set; use CHARSET IIE-ALT",
+		" CHARSET IIE-ALT\n MTX '1'": "line 2 - no MouseText glyph for '1'; expected @, A-Z, [, \\, ], ^ or _",
+		" SCR '\x07'":                "line 1 - $07 has no screen code",
+		` CHARSET IIGS`:              "line 1 - unknown character set: IIGS; expected IIE, II+ or IIE-ALT",
+	}
+
+	for src, expected := range tests {
+		_, err := AssembleSegments(strings.NewReader(src))
+		if err == nil || err.Error() != expected {
+			t.Errorf("%q: expected %q; got %v", src, expected, err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/taeber/a2asm"
+)
+
+var convertUsage = `Usage: a2asm convert [-to FORMAT] [-o OUTPUT] <SOURCE_FILE>
+
+Converts MERLIN source between its native DOS 3.3 format (high-bit ASCII,
+carriage returns, single spaces between fields) and plain text (tabs between
+fields). By default, the source is converted to whichever format it is not.
+
+`
+
+func convert(args []string) {
+	flags := flag.NewFlagSet("convert", flag.ExitOnError)
+	to := flags.String("to", "", "convert to `FORMAT`: merlin or text")
+	output := flags.String("o", "", "write to `OUTPUT` instead of stdout")
+	flags.Usage = func() {
+		fmt.Print(convertUsage)
+		flags.PrintDefaults()
+	}
+
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	var src []byte
+	var err error
+	if flags.Arg(0) == "-" {
+		src, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		src, err = ioutil.ReadFile(flags.Arg(0))
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if *to == "" {
+		*to = "merlin"
+		if a2asm.IsMerlinNative(src) {
+			*to = "text"
+		}
+	}
+
+	var dst []byte
+	switch *to {
+	case "merlin":
+		dst = a2asm.TextToMerlin(src)
+	case "text":
+		dst = a2asm.MerlinToText(src)
+	default:
+		log.Fatalln("unknown format:", *to)
+	}
+
+	if *output == "" || *output == "-" {
+		_, err = os.Stdout.Write(dst)
+	} else {
+		err = ioutil.WriteFile(*output, dst, 0644)
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/taeber/a2asm"
+)
+
+// report writes the warnings of result, which may be nil, and err in the
+// -diagnostics-format, then exits if there is an error or, with -Werror, a
+// warning. src is the path of the source, which PUT file names are
+// relative to.
+func report(result *a2asm.Result, err error, src string) {
+	var warnings []a2asm.Diagnostic
+	if result != nil {
+		warnings = result.Diagnostics()
+	}
+	failed := err != nil || (*werror && len(warnings) > 0)
+
+	if *diagFormat == "text" {
+		if result != nil {
+			for _, warning := range result.Warnings {
+				log.Println("warning:", warning)
+			}
+		}
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if failed {
+			log.Fatalln(len(warnings), "warnings treated as errors")
+		}
+		return
+	}
+
+	diagnostics := warnings
+	if err != nil {
+		d, ok := a2asm.ErrorDiagnostic(err)
+		if !ok {
+			d = a2asm.Diagnostic{Severity: "error", Rule: a2asm.ErrorRule, Message: err.Error()}
+		}
+		diagnostics = append(diagnostics, d)
+	}
+	for i := range diagnostics {
+		diagnostics[i].File = diagnosticPath(src, diagnostics[i].File)
+	}
+
+	var werr error
+	switch *diagFormat {
+	case "json":
+		werr = writeJSON(os.Stderr, diagnostics)
+	case "sarif":
+		werr = writeSARIF(os.Stderr, warningRules(), diagnostics)
+	default:
+		log.Fatalln("unknown diagnostics format:", *diagFormat)
+	}
+	if werr != nil {
+		log.Fatalln(werr)
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// diagnosticPath returns the path of file, as named in a diagnostic, given
+// the path of the source that included it.
+func diagnosticPath(src, file string) string {
+	if file == "" {
+		return src
+	}
+	if image, _, ok := splitImagePath(src); ok {
+		return image + ":" + file
+	}
+	return filepath.Join(filepath.Dir(src), file)
+}
+
+func writeJSON(w io.Writer, diagnostics []a2asm.Diagnostic) error {
+	if diagnostics == nil {
+		diagnostics = []a2asm.Diagnostic{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(diagnostics)
+}
+
+// SARIF 2.1.0, as much of it as is needed to annotate source.
+type (
+	sarifLog struct {
+		Schema  string     `json:"$schema"`
+		Version string     `json:"version"`
+		Runs    []sarifRun `json:"runs"`
+	}
+	sarifRun struct {
+		Tool    sarifTool     `json:"tool"`
+		Results []sarifResult `json:"results"`
+	}
+	sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+	sarifDriver struct {
+		Name           string      `json:"name"`
+		InformationURI string      `json:"informationUri"`
+		Rules          []sarifRule `json:"rules"`
+	}
+	sarifRule struct {
+		ID               string       `json:"id"`
+		ShortDescription sarifMessage `json:"shortDescription"`
+	}
+	sarifMessage struct {
+		Text string `json:"text"`
+	}
+	sarifResult struct {
+		RuleID    string          `json:"ruleId"`
+		Level     string          `json:"level"`
+		Message   sarifMessage    `json:"message"`
+		Locations []sarifLocation `json:"locations"`
+	}
+	sarifLocation struct {
+		PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	}
+	sarifPhysicalLocation struct {
+		ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+		Region           *sarifRegion          `json:"region,omitempty"`
+	}
+	sarifArtifactLocation struct {
+		URI string `json:"uri"`
+	}
+	sarifRegion struct {
+		StartLine   uint `json:"startLine"`
+		StartColumn int  `json:"startColumn,omitempty"`
+		EndColumn   int  `json:"endColumn,omitempty"`
+	}
+)
+
+// errorRule describes the Rule of errors in SARIF.
+var errorRule = sarifRule{a2asm.ErrorRule, sarifMessage{"source that cannot be assembled"}}
+
+// warningRules describes the errors and each category of warning in SARIF.
+func warningRules() []sarifRule {
+	rules := []sarifRule{errorRule}
+	for _, category := range a2asm.WarningCategories {
+		rules = append(rules, sarifRule{category.Name, sarifMessage{category.Description}})
+	}
+	return rules
+}
+
+func writeSARIF(w io.Writer, rules []sarifRule, diagnostics []a2asm.Diagnostic) error {
+	results := []sarifResult{}
+	for _, d := range diagnostics {
+		location := sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifactLocation{filepath.ToSlash(d.File)},
+		}
+		if d.Line > 0 {
+			location.Region = &sarifRegion{d.Line, d.Column, d.EndColumn}
+		}
+
+		results = append(results, sarifResult{
+			RuleID:    d.Rule,
+			Level:     d.Severity,
+			Message:   sarifMessage{d.Message},
+			Locations: []sarifLocation{{location}},
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool: sarifTool{sarifDriver{
+				Name:           "a2asm",
+				InformationURI: "https://github.com/taeber/a2asm",
+				Rules:          rules,
+			}},
+			Results: results,
+		}},
+	})
+}
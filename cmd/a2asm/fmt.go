@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/taeber/a2asm"
+)
+
+var fmtUsage = `Usage: a2asm fmt [-check] [-tabs OPCODE,OPERAND,COMMENT] [SOURCE_FILE...]
+
+Rewrites MERLIN sources with their label, opcode, operand and comment fields
+lined up in columns, mnemonics and hex numbers in uppercase, and lines that
+are all comment left as they are. Sources in MERLIN's native format stay in
+it. With no files, or "-", the standard input is formatted to stdout.
+
+With -check, nothing is rewritten. The files that are not formatted are
+listed and a2asm exits with status 1 if there are any.
+
+`
+
+func reformat(args []string) {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	check := flags.Bool("check", false, "list the files that are not formatted instead of rewriting them")
+	tabs := flags.String("tabs", "9,15,26", "the `COLUMNS`, counting from 0, of the opcode, operand and comment")
+	flags.Usage = func() {
+		fmt.Print(fmtUsage)
+		flags.PrintDefaults()
+	}
+
+	flags.Parse(args)
+
+	opts, err := parseTabs(*tabs)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+
+	var unformatted int
+	for _, path := range paths {
+		var src []byte
+		if path == "-" {
+			src, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			src, err = ioutil.ReadFile(path)
+		}
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		dst, err := a2asm.Format(src, opts)
+		if err != nil {
+			log.Fatalln(path+":", err)
+		}
+		if a2asm.IsMerlinNative(src) {
+			dst = a2asm.TextToMerlin(dst)
+		}
+
+		switch {
+		case *check:
+			if !bytes.Equal(src, dst) {
+				fmt.Println(path)
+				unformatted++
+			}
+		case path == "-":
+			_, err = os.Stdout.Write(dst)
+		case !bytes.Equal(src, dst):
+			err = ioutil.WriteFile(path, dst, 0644)
+		}
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	if unformatted > 0 {
+		os.Exit(1)
+	}
+}
+
+// parseTabs parses the -tabs flag: the columns of the opcode, operand and
+// comment fields.
+func parseTabs(tabs string) (opts a2asm.FormatOptions, err error) {
+	columns := strings.Split(tabs, ",")
+	if len(columns) != 3 {
+		return opts, fmt.Errorf("-tabs needs three columns; got %q", tabs)
+	}
+
+	var n [3]int
+	for i, column := range columns {
+		if n[i], err = strconv.Atoi(strings.TrimSpace(column)); err != nil || n[i] <= 0 {
+			return opts, fmt.Errorf("bad -tabs column: %q", column)
+		}
+		if i > 0 && n[i] <= n[i-1] {
+			return opts, fmt.Errorf("-tabs columns must increase; got %q", tabs)
+		}
+	}
+
+	return a2asm.FormatOptions{Opcode: n[0], Operand: n[1], Comment: n[2]}, nil
+}
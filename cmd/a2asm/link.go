@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/taeber/a2asm"
+)
+
+var linkUsage = `Usage: a2asm link [-headless] <LINKER_FILE>
+
+Runs a MERLIN linker command file. Each line holds one command:
+
+  ORG addr   where the next linked file will start (default $8000)
+  ASM file   assemble a REL source and add it to the link
+  LNK file   add a REL file to the link
+  SAV file   link everything added since the last SAV and save it
+
+File names are relative to the linker command file.
+
+`
+
+func link(args []string) {
+	flags := flag.NewFlagSet("link", flag.ExitOnError)
+	headless := flags.Bool("headless", false, "do not write the DOS 3.3 header")
+	flags.Usage = func() {
+		fmt.Print(linkUsage)
+		flags.PrintDefaults()
+	}
+
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	script, err := os.Open(flags.Arg(0))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer script.Close()
+
+	dir := filepath.Dir(flags.Arg(0))
+
+	open := func(name string) (io.ReadCloser, error) {
+		return os.Open(filepath.Join(dir, name))
+	}
+
+	save := func(name string, linked a2asm.Segment) error {
+		var buf bytes.Buffer
+		n, err := a2asm.WriteImage(&buf, []a2asm.Segment{linked}, *headless)
+		if err != nil {
+			return err
+		}
+
+		log.Println(n, "bytes written to", name)
+		return ioutil.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0644)
+	}
+
+	if err = a2asm.Link(script, open, save); err != nil {
+		log.Fatalln(err)
+	}
+}
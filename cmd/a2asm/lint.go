@@ -0,0 +1,134 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/taeber/a2asm"
+	"github.com/taeber/a2asm/lint"
+)
+
+var lintUsage = `Usage: a2asm lint [-disable NAME,...] [-diagnostics-format FORMAT]
+                 <ASSEMBLY_FILE...>
+
+Assembles each MERLIN source and reports the common 6502 mistakes found in
+it to stdout, exiting with status 1 if there are any. -disable turns rules
+off by name; a comment of the form "; a2asm:ignore NAME" turns them off for
+its line.
+
+`
+
+func lintSources(args []string) {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	disable := flags.String("disable", "", "turn off the rules named in the comma-separated `NAMES`")
+	format := flags.String("diagnostics-format", "text", "write what is found as `FORMAT`: text, json, or sarif")
+	flags.Usage = func() {
+		fmt.Print(lintUsage)
+		flags.PrintDefaults()
+		fmt.Println("\nRules:")
+		for _, rule := range lint.Rules {
+			fmt.Printf("  %-24s %s\n", rule.Name, rule.Description)
+		}
+	}
+
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	disabled, err := parseRules(*disable)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	var diagnostics []a2asm.Diagnostic
+	for _, src := range flags.Args() {
+		found, err := lintSource(src)
+		if err != nil {
+			if *format == "text" {
+				log.Fatalln(src+":", err)
+			}
+			d, ok := a2asm.ErrorDiagnostic(err)
+			if !ok {
+				d = a2asm.Diagnostic{Severity: "error", Rule: a2asm.ErrorRule, Message: err.Error()}
+			}
+			found = append(found, d)
+		}
+
+		for _, d := range found {
+			if !disabled[d.Rule] {
+				d.File = diagnosticPath(src, d.File)
+				diagnostics = append(diagnostics, d)
+			}
+		}
+	}
+
+	switch *format {
+	case "text":
+		for _, d := range diagnostics {
+			fmt.Printf("%s: line %d - %s [%s]\n", d.File, d.Line, d.Message, d.Rule)
+		}
+	case "json":
+		err = writeJSON(os.Stdout, diagnostics)
+	case "sarif":
+		rules := []sarifRule{errorRule}
+		for _, rule := range lint.Rules {
+			rules = append(rules, sarifRule{rule.Name, sarifMessage{rule.Description}})
+		}
+		err = writeSARIF(os.Stdout, rules, diagnostics)
+	default:
+		log.Fatalln("unknown diagnostics format:", *format)
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if len(diagnostics) > 0 {
+		os.Exit(1)
+	}
+}
+
+// lintSource assembles the source at path and returns what lint finds in
+// it.
+func lintSource(path string) ([]a2asm.Diagnostic, error) {
+	open, name, err := sourceOpener(path)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := a2asm.AssembleWithOptions(nil, a2asm.Options{
+		Name:   name,
+		Open:   open,
+		Locals: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lint.Check(result), nil
+}
+
+// parseRules parses the -disable flag: a comma-separated list of rules.
+func parseRules(names string) (map[string]bool, error) {
+	rules := make(map[string]bool)
+	if names == "" {
+		return rules, nil
+	}
+
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, rule := range lint.Rules {
+			found = found || rule.Name == name
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown rule: %s", name)
+		}
+		rules[name] = true
+	}
+	return rules, nil
+}
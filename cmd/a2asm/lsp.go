@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/taeber/a2asm/lsp"
+)
+
+var lspUsage = `Usage: a2asm lsp
+
+Runs a language server for MERLIN assembly, speaking the Language Server
+Protocol on stdin and stdout. Each open source is assembled as it changes,
+giving the editor its errors and warnings, the definitions and references
+of its labels and EQUs, hover with the value of a symbol or the opcodes,
+cycles and flags of an instruction, completion of mnemonics and symbols,
+and an outline of its global labels.
+
+Warnings may be turned on or off with the initialization option
+{"warnings": {"NAME": true}}.
+
+`
+
+func serve(args []string) {
+	flags := flag.NewFlagSet("lsp", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Print(lspUsage)
+		flags.PrintDefaults()
+	}
+
+	flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if err := lsp.Serve(os.Stdin, os.Stdout); err != nil {
+		log.Fatalln(err)
+	}
+}
@@ -1,31 +1,121 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 
 	"github.com/taeber/a2asm"
 )
 
 var usage = `Apple //e Assembler
 
-Usage: a2asm [-headless] <ASSEMBLY_FILE>
+Usage: a2asm [-headless] [-format FORMAT] [-o OUTPUT]
+             [-syntax SYNTAX] [-config FILE] [-target TARGET] [-map]
+             [-charset CHARSET] [-symbols [-locals]]
+             [-W NAME] [-Wno-NAME] [-Werror] [-diagnostics-format FORMAT]
+             <ASSEMBLY_FILE>
+       a2asm link [-headless] <LINKER_FILE>
+       a2asm convert [-to FORMAT] [-o OUTPUT] <SOURCE_FILE>
+       a2asm verify <ASSEMBLY_FILE> <LISTING_FILE>
+       a2asm fmt [-check] [-tabs OPCODE,OPERAND,COMMENT] [SOURCE_FILE...]
+       a2asm lint [-disable NAME,...] [-diagnostics-format FORMAT]
+                  <ASSEMBLY_FILE...>
+       a2asm lsp
 
 Converts MERLIN-type assembly into 6502 binary. A 4-byte, DOS 3.3 header
 comprising the origin and length is prefixed unless -headless is used.
 
+Sources may be plain text or in MERLIN's native DOS 3.3 format. They may
+also be read straight from a DOS 3.3 or ProDOS disk image by naming them as
+IMAGE.dsk:FILENAME, in which case PUT files are read from the same image.
+
+Sources using REL are written as MERLIN REL files for the linker instead.
+
+With -syntax ca65, a subset of ca65 syntax is accepted instead and its
+segments are placed using the ld65-style memory map in -config.
+
+When the source has more than one ORG, -format decides how the segments
+are written:
+
+  image    a single image padded with zeros between segments (default)
+  records  each segment prefixed with its own DOS 3.3 header
+  split    each segment in its own file named OUTPUT.XXXX, where XXXX is
+           the segment's origin in hex; requires -o
+
+With -target, a warning is given for each segment loaded into memory that
+the target reserves: dos33, prodos or rom. -map summarizes the memory used
+and left free.
+
+-charset picks the character set that SCR, INV, FLS and MTX strings are
+encoded for until a CHARSET directive: IIE (default), II+ or IIE-ALT.
+
+-symbols writes the symbol table to stderr; with -locals, each global
+label's local labels are listed beneath it.
+
+-W NAME turns on a category of warning and -Wno-NAME turns it off; with
+-Werror, any warning stops the output being written. A comment of the form
+"; a2asm:ignore NAME" turns warnings off for its line.
+
+-diagnostics-format json or sarif writes errors and warnings to stderr as
+JSON or SARIF 2.1.0, with the file, line, columns, severity and rule of
+each, instead of as text.
+
 `
 
-var headless = flag.Bool("headless", false, "do not write the DOS 3.3 header")
+var (
+	headless   = flag.Bool("headless", false, "do not write the DOS 3.3 header")
+	format     = flag.String("format", "image", "how to write multiple segments: image, records, or split")
+	output     = flag.String("o", "", "write to `OUTPUT` instead of stdout")
+	syntax     = flag.String("syntax", "merlin", "source syntax: merlin or ca65")
+	config     = flag.String("config", "", "ld65-style memory map `FILE` for -syntax ca65")
+	target     = flag.String("target", "", "warn about memory reserved by `TARGET`: dos33, prodos, or rom")
+	showMap    = flag.Bool("map", false, "summarize the memory used and free")
+	charset    = flag.String("charset", "", "encode screen codes for `CHARSET`: IIE, II+, or IIE-ALT")
+	symbols    = flag.Bool("symbols", false, "write the symbol table to stderr")
+	locals     = flag.Bool("locals", false, "include local labels in the symbol table")
+	werror     = flag.Bool("Werror", false, "treat warnings as errors")
+	diagFormat = flag.String("diagnostics-format", "text", "write errors and warnings as `FORMAT`: text, json, or sarif")
+	warnings   = make(warningFlags)
+)
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "link":
+			link(os.Args[2:])
+			return
+		case "convert":
+			convert(os.Args[2:])
+			return
+		case "verify":
+			verify(os.Args[2:])
+			return
+		case "lsp":
+			serve(os.Args[2:])
+			return
+		case "fmt":
+			reformat(os.Args[2:])
+			return
+		case "lint":
+			lintSources(os.Args[2:])
+			return
+		}
+	}
+
+	flag.Var(warnings, "W", "turn on the warning `NAME`; -Wno-NAME turns it off")
 	flag.Usage = func() {
 		fmt.Print(usage)
 		flag.PrintDefaults()
+		warningUsage()
 	}
 
+	rewriteWarningFlags(flag.CommandLine, os.Args[1:])
 	flag.Parse()
 
 	if flag.NArg() == 0 {
@@ -33,20 +123,199 @@ func main() {
 		os.Exit(2)
 	}
 
-	fp := os.Stdin
-
 	src := flag.Arg(0)
-	if src != "-" {
-		var err error
-		if fp, err = os.Open(src); err != nil {
+
+	if *syntax == "ca65" {
+		fp := os.Stdin
+		if src != "-" {
+			var err error
+			if fp, err = os.Open(src); err != nil {
+				log.Fatalln(err)
+			}
+		}
+
+		segments, err := assembleCA65(fp, filepath.Dir(src))
+		if err != nil {
+			report(nil, err, src)
+		}
+
+		checkMemory(segments, src)
+
+		n, err := writeFormat(segments)
+		if err != nil {
 			log.Fatalln(err)
 		}
+
+		written(n)
+		return
+	} else if *syntax != "merlin" {
+		log.Fatalln("unknown syntax:", *syntax)
+	}
+
+	open, name, err := sourceOpener(src)
+	if err != nil {
+		report(nil, err, src)
+	}
+
+	result, err := a2asm.AssembleWithOptions(nil, a2asm.Options{
+		Name:     name,
+		Open:     open,
+		Charset:  *charset,
+		Locals:   *locals,
+		Target:   *target,
+		Warnings: warnings,
+	})
+	report(result, err, src)
+
+	if *symbols {
+		result.WriteSymbols(os.Stderr)
+	}
+
+	var n uint
+	if result.Relocatable {
+		fp := openOutput()
+		n, err = result.WriteREL(fp)
+		err = closeOutput(fp, err)
+	} else {
+		if *showMap {
+			writeMap(result.Segments)
+		}
+		n, err = writeFormat(result.Segments)
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	written(n)
+}
+
+// written notes how many bytes were written, unless the diagnostics are
+// being written for another program to read.
+func written(n uint) {
+	if *diagFormat == "text" {
+		log.Println(n, "bytes written")
+	}
+}
+
+// checkMemory reports the segments of src in memory reserved by the -target
+// as warnings, as for MERLIN sources, and writes the -map summary.
+func checkMemory(segments []a2asm.Segment, src string) {
+	result := &a2asm.Result{Object: &a2asm.Object{Name: src, Segments: segments}, CPU: "6502"}
+	if *target != "" && warningEnabled(a2asm.WarnMemory) {
+		for _, overlap := range targetMap().Check(segments).Overlaps {
+			result.Warnings = append(result.Warnings, a2asm.Warning{
+				Message:  overlap.String(),
+				Category: a2asm.WarnMemory,
+			})
+		}
+	}
+	report(result, nil, src)
+
+	if *showMap {
+		writeMap(segments)
+	}
+}
+
+// writeMap writes the -map summary.
+func writeMap(segments []a2asm.Segment) {
+	targetMap().Check(segments).WriteSummary(os.Stderr)
+}
+
+// targetMap returns the memory map of the -target.
+func targetMap() a2asm.MemoryMap {
+	if *target == "" {
+		return a2asm.MemoryMap{Name: "no target"}
 	}
 
-	n, err := a2asm.Assemble(os.Stdout, fp, *headless)
+	memory, ok := a2asm.MemoryMaps[*target]
+	if !ok {
+		log.Fatalln("unknown target:", *target)
+	}
+	return memory
+}
+
+func writeFormat(segments []a2asm.Segment) (n uint, err error) {
+	switch *format {
+	case "image":
+		fp := openOutput()
+		n, err = a2asm.WriteImage(fp, segments, *headless)
+		err = closeOutput(fp, err)
+	case "records":
+		fp := openOutput()
+		n, err = a2asm.WriteRecords(fp, segments)
+		err = closeOutput(fp, err)
+	case "split":
+		n, err = writeSplit(segments)
+	default:
+		log.Fatalln("unknown format:", *format)
+	}
+
+	return
+}
+
+func assembleCA65(src io.Reader, dir string) ([]a2asm.Segment, error) {
+	opts := a2asm.CA65Options{
+		Open: func(name string) (io.ReadCloser, error) {
+			return os.Open(filepath.Join(dir, name))
+		},
+	}
+
+	if *config != "" {
+		fp, err := os.Open(*config)
+		if err != nil {
+			return nil, err
+		}
+		defer fp.Close()
+		opts.Config = fp
+	}
+
+	return a2asm.AssembleCA65(src, opts)
+}
+
+func openOutput() *os.File {
+	if *output == "" || *output == "-" {
+		return os.Stdout
+	}
+
+	fp, err := os.Create(*output)
 	if err != nil {
 		log.Fatalln(err)
 	}
 
-	log.Println(n, "bytes written")
+	return fp
+}
+
+// closeOutput closes fp, unless it is stdout, once err was returned from
+// writing to it. An error closing it is a failed write.
+func closeOutput(fp *os.File, err error) error {
+	if fp == os.Stdout {
+		return err
+	}
+	if cerr := fp.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// writeSplit writes each segment to its own file, named after its origin.
+func writeSplit(segments []a2asm.Segment) (written uint, err error) {
+	if *output == "" || *output == "-" {
+		log.Fatalln("-format split requires -o")
+	}
+
+	for _, seg := range segments {
+		var buf bytes.Buffer
+		var n uint
+		if n, err = a2asm.WriteImage(&buf, []a2asm.Segment{seg}, *headless); err != nil {
+			return
+		}
+
+		name := fmt.Sprintf("%s.%04X", *output, seg.Origin)
+		if err = ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+			return
+		}
+		written += n
+	}
+
+	return
 }
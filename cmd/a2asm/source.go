@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/taeber/a2asm"
+	"github.com/taeber/a2asm/diskimage"
+)
+
+// imageExtensions are the disk images that may appear as image.dsk:FILENAME.
+var imageExtensions = map[string]bool{
+	".dsk": true, ".do": true, ".po": true, ".2mg": true, ".hdv": true,
+}
+
+// splitImagePath splits "image.dsk:FILENAME" into the path of the disk image
+// and the name of the file on it.
+func splitImagePath(path string) (image, name string, ok bool) {
+	i := strings.LastIndex(path, ":")
+	if i < 0 || !imageExtensions[strings.ToLower(filepath.Ext(path[:i]))] {
+		return "", "", false
+	}
+	return path[:i], path[i+1:], true
+}
+
+// sourceOpener returns how to open the source at path, and any files it
+// includes, along with the name to open it by. Paths may name a file on a
+// disk image (image.dsk:FILENAME), in which case included files are read
+// from the same image. Otherwise, included files are relative to the
+// source; "-" is the standard input.
+func sourceOpener(path string) (open a2asm.Opener, name string, err error) {
+	if image, name, ok := splitImagePath(path); ok {
+		img, err := diskimage.Open(image)
+		if err != nil {
+			return nil, "", err
+		}
+
+		return a2asm.FSOpener(img), name, nil
+	}
+
+	dir := filepath.Dir(path)
+	open = func(name string) (io.ReadCloser, error) {
+		if name == path {
+			if name == "-" {
+				return ioutil.NopCloser(os.Stdin), nil
+			}
+			return os.Open(name)
+		}
+		return os.Open(filepath.Join(dir, name))
+	}
+	return open, path, nil
+}
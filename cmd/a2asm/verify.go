@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/taeber/a2asm"
+	"github.com/taeber/a2asm/listing"
+)
+
+var verifyUsage = `Usage: a2asm verify <ASSEMBLY_FILE> <LISTING_FILE>
+
+Assembles the source and compares the result with a listing printed by
+MERLIN, either the assembler's own listing or a monitor dump. Every byte
+that differs is reported with the listed source line responsible.
+
+`
+
+func verify(args []string) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Print(verifyUsage)
+		flags.PrintDefaults()
+	}
+
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	open, name, err := sourceOpener(flags.Arg(0))
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	obj, err := a2asm.AssembleFile(name, open)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	records, err := listing.Open(flags.Arg(1))
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	diffs := listing.Compare(records, obj.Segments)
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+
+	if len(diffs) > 0 {
+		log.Fatalln(len(diffs), "bytes differ")
+	}
+}
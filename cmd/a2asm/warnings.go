@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/taeber/a2asm"
+)
+
+// warningFlags are the categories of warning turned on with -W NAME and off
+// with -Wno-NAME.
+type warningFlags map[string]bool
+
+func (w warningFlags) String() string {
+	var names []string
+	for name, on := range w {
+		if !on {
+			name = "no-" + name
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ",")
+}
+
+func (w warningFlags) Set(value string) error {
+	name := strings.TrimPrefix(value, "no-")
+	for _, category := range a2asm.WarningCategories {
+		if category.Name == name {
+			w[name] = name == value
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown warning: %s", name)
+}
+
+// warningEnabled is whether the category of warning is on, given the -W
+// flags.
+func warningEnabled(name string) bool {
+	if on, ok := warnings[name]; ok {
+		return on
+	}
+	for _, category := range a2asm.WarningCategories {
+		if category.Name == name {
+			return category.Default
+		}
+	}
+	return false
+}
+
+// rewriteWarningFlags rewrites -WNAME and -Wno-NAME as -W=NAME and
+// -W=no-NAME, which the flags can parse. Like the flag package, it stops at
+// the first argument that is not a flag, and it leaves the values of other
+// flags alone.
+func rewriteWarningFlags(flags *flag.FlagSet, args []string) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || len(arg) < 2 || arg[0] != '-' {
+			return
+		}
+
+		name := strings.TrimPrefix(arg[1:], "-")
+		if strings.Contains(name, "=") {
+			continue
+		}
+		if len(name) > 1 && name[0] == 'W' && name != "Werror" {
+			args[i] = "-W=" + name[1:]
+			continue
+		}
+		if f := flags.Lookup(name); f != nil && !isBoolFlag(f) {
+			i++ // its value
+		}
+	}
+}
+
+// isBoolFlag is whether f needs no value, as with -headless.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// warningUsage lists the categories of warning for -help.
+func warningUsage() {
+	fmt.Fprintln(os.Stderr, "\nWarnings (* are on by default):")
+	for _, category := range a2asm.WarningCategories {
+		mark := " "
+		if category.Default {
+			mark = "*"
+		}
+		fmt.Fprintf(os.Stderr, "  %s %-22s %s\n", mark, category.Name, category.Description)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRewriteWarningFlags(t *testing.T) {
+	flags := flag.NewFlagSet("a2asm", flag.ContinueOnError)
+	flags.Bool("headless", false, "")
+	flags.Bool("Werror", false, "")
+	flags.String("o", "", "")
+	flags.Var(make(warningFlags), "W", "")
+
+	tests := []struct{ args, expected string }{
+		{"-Wunused-label -Wno-truncation x.s", "-W=unused-label -W=no-truncation x.s"},
+		{"--Wunused-label -W truncation -Werror x.s", "-W=unused-label -W truncation -Werror x.s"},
+		{"-W=truncation -headless x.s", "-W=truncation -headless x.s"},
+		{"Wizard.s", "Wizard.s"},
+		{"-o Wout.bin x.s", "-o Wout.bin x.s"},
+		{"-o=Wout.bin -Wmemory x.s", "-o=Wout.bin -W=memory x.s"},
+		{"-headless x.s -Wmemory", "-headless x.s -Wmemory"},
+		{"- -Wmemory", "- -Wmemory"},
+		{"-- -Wmemory", "-- -Wmemory"},
+	}
+	for _, test := range tests {
+		args := strings.Fields(test.args)
+		rewriteWarningFlags(flags, args)
+		if expected := strings.Fields(test.expected); !reflect.DeepEqual(expected, args) {
+			t.Errorf("%s: expected %v; got %v", test.args, expected, args)
+		}
+	}
+}
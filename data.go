@@ -0,0 +1,178 @@
+package a2asm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/taeber/a2asm/syntax"
+)
+
+// fixup is data whose expression refers to labels that were not yet defined
+// when its line was read. It is written once every line has been read.
+type fixup struct {
+	Address   address
+	Size      int // 1 or 2
+	BigEndian bool
+	Expr      expression
+
+	File       string
+	LineNumber uint
+}
+
+// data handles the directives that write the value of each comma-separated
+// expression in their operand:
+//
+//	DFB  bytes; a leading < or > selects the low or high byte
+//	DA   little-endian words (also DW)
+//	DDB  big-endian words
+func (s *state) data(mneumonic string, args []syntax.Expr) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%s needs a value", mneumonic)
+	}
+
+	size, bigEndian := 2, mneumonic == "DDB"
+	if mneumonic == "DFB" {
+		size = 1
+	}
+
+	here := s.Address
+	for _, x := range args {
+		e := expression{x, here, s.CurrentLabel}
+		if err := s.writeExpression(e, size, bigEndian); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ds handles DS, which reserves bytes filled with an optional value:
+//
+//	DS count[,fill]
+//	DS \[,fill]       up to the next page boundary
+//
+// Both the count and the fill value must be defined before the DS.
+func (s *state) ds(operand string, args []syntax.Expr) error {
+	toPage := strings.HasPrefix(operand, "\\")
+	if !toPage && len(args) == 0 || len(args) > 2 || toPage && len(args) > 1 {
+		return fmt.Errorf("DS needs a count and an optional fill value")
+	}
+
+	var count, fill uint16
+	var err error
+
+	if toPage {
+		count = (0x100 - s.Address&0xFF) & 0xFF
+	} else {
+		if count, err = s.evalNow(args[0]); err != nil {
+			return err
+		}
+		args = args[1:]
+	}
+
+	if len(args) == 1 {
+		if fill, err = s.evalNow(args[0]); err != nil {
+			return err
+		}
+	}
+
+	if err = s.room(int(count)); err != nil {
+		return err
+	}
+
+	for i := uint16(0); i < count; i++ {
+		s.write(byte(fill))
+	}
+
+	return nil
+}
+
+// evalNow evaluates x, which may only refer to labels already defined.
+func (s *state) evalNow(x syntax.Expr) (uint16, error) {
+	value, _, err := s.eval(s.expression(x))
+	if undef, ok := err.(undefinedError); ok {
+		return 0, fmt.Errorf("label must be defined before use: %s", undef.Name)
+	}
+	return value, err
+}
+
+// writeExpression writes the value of e as size bytes, or leaves room for it
+// to be fixed up at the end if it refers to labels not yet defined.
+func (s *state) writeExpression(e expression, size int, bigEndian bool) error {
+	addr := s.Address
+	if err := s.room(size); err != nil {
+		return err
+	}
+
+	if s.Dummy != nil {
+		// Only reserve the space.
+		s.Address += address(size)
+		return nil
+	}
+
+	value, ref, err := s.eval(e)
+	switch err.(type) {
+	case nil:
+		s.putValue(addr, value, size, bigEndian)
+		s.relocateData(e, ref, addr, size, value, bigEndian)
+	case undefinedError:
+		s.Fixups = append(s.Fixups, &fixup{addr, size, bigEndian, e, s.File, s.LineNumber})
+	default:
+		return err
+	}
+
+	s.Address += address(size)
+	s.Written += uint16(size)
+	s.Top = s.Address == 0
+	return nil
+}
+
+// putValue stores value as size bytes at addr.
+func (s *state) putValue(addr address, value uint16, size int, bigEndian bool) {
+	switch {
+	case size == 1:
+		s.Memory[addr] = byte(value)
+	case bigEndian:
+		s.Memory[addr], s.Memory[addr+1] = byte(value>>8), byte(value)
+	default:
+		s.Memory[addr], s.Memory[addr+1] = byte(value), byte(value>>8)
+	}
+}
+
+// relocateData notes a data field, the value of e, that refers to ref, in
+// case it needs relocating by the linker. Words holding only the low or high
+// byte of a label cannot be relocated and are left as they are.
+func (s *state) relocateData(e expression, ref string, addr address, size int, value uint16, bigEndian bool) {
+	if ref != "" && (ref[0] == '<' || ref[0] == '>') {
+		if size == 2 {
+			return
+		}
+		if ref[0] == '>' {
+			// The linker also needs the low byte of the whole value.
+			if u, ok := e.X.(*syntax.Unary); ok {
+				e.X = u.X
+			}
+			value, _, _ = s.eval(e)
+		}
+	}
+
+	if r := s.relocate(ref, addr, uint16(size), value, true); r != nil {
+		r.Reversed = bigEndian
+	}
+}
+
+// resolveFixups writes the data left for when every label was defined.
+func (s *state) resolveFixups() error {
+	for _, fix := range s.Fixups {
+		value, ref, err := s.eval(fix.Expr)
+		if err != nil {
+			s.File, s.LineNumber = fix.File, fix.LineNumber
+			return s.error(err)
+		}
+
+		s.putValue(fix.Address, value, fix.Size, fix.BigEndian)
+		s.relocateData(fix.Expr, ref, fix.Address, fix.Size, value, fix.BigEndian)
+	}
+
+	return nil
+}
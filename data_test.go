@@ -0,0 +1,148 @@
+package a2asm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func assembleBytes(t *testing.T, src string) []byte {
+	t.Helper()
+
+	out := bytes.NewBuffer(nil)
+	if _, err := Assemble(out, strings.NewReader(src), true); err != nil {
+		t.Error(err)
+		return nil
+	}
+	return out.Bytes()
+}
+
+func TestDataDirectives(t *testing.T) {
+	actual := assembleBytes(t, `
+		ORG $300
+START	DA START,END
+		DW $1234
+		DDB START+1,$1234
+		DFB <END,>END,#$12,"A",'B'
+END		RTS
+`)
+
+	expected := []byte{
+		0x00, 0x03, 0x0F, 0x03,
+		0x34, 0x12,
+		0x03, 0x01, 0x12, 0x34,
+		0x0F, 0x03, 0x12, 0xC1, 0x42,
+		0x60,
+	}
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("Expected %x; got %x", expected, actual)
+	}
+}
+
+func TestDataForwardExpressions(t *testing.T) {
+	actual := assembleBytes(t, `
+		ORG $300
+		DA END-START,TABLE+2*2
+START	DFB >TABLE+$100,:LOCAL
+		DFB END-*
+:LOCAL	RTS
+END		HEX FF
+TABLE	EQU $1000
+`)
+
+	expected := []byte{
+		0x04, 0x00, 0x04, 0x20,
+		0x11, 0x07,
+		0x02,
+		0x60,
+		0xFF,
+	}
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("Expected %x; got %x", expected, actual)
+	}
+}
+
+func TestDS(t *testing.T) {
+	actual := assembleBytes(t, `
+		ORG $3FC
+		DS 2
+		DS 1,$EA
+		DS \
+		DFB 1
+		DS \,$FF
+		DFB 2
+`)
+
+	expected := make([]byte, 0, 0x106)
+	expected = append(expected, 0, 0, 0xEA, 0, 1)
+	for len(expected) < 0x104 {
+		expected = append(expected, 0xFF)
+	}
+	expected = append(expected, 2)
+
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("Expected %x; got %x", expected, actual)
+	}
+}
+
+func TestDSForwardCount(t *testing.T) {
+	_, err := AssembleSegments(strings.NewReader(`
+		DS SIZE
+SIZE	EQU 4
+`))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected an error on line 2; got %v", err)
+	}
+}
+
+func TestDataUnknownLabel(t *testing.T) {
+	_, err := AssembleSegments(strings.NewReader(`
+		ORG $300
+		DA NOWHERE
+		RTS
+`))
+	if err == nil || err.Error() != "line 3 - unknown label: NOWHERE" {
+		t.Errorf("Expected an unknown label on line 3; got %v", err)
+	}
+}
+
+func TestRELData(t *testing.T) {
+	obj, err := AssembleObject(strings.NewReader(`
+		REL
+START	DA START,$1234
+		DDB END
+		DFB >START,<END
+END		RTS
+`))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := []Relocation{
+		{Offset: 0, TwoBytes: true},
+		{Offset: 4, TwoBytes: true, Reversed: true, Low: 0x08},
+		{Offset: 6, HighByte: true},
+		{Offset: 7, Low: 0x08},
+	}
+	if len(obj.Relocations) != len(expected) {
+		t.Errorf("Expected %v; got %v", expected, obj.Relocations)
+		return
+	}
+	for i := range expected {
+		if expected[i] != obj.Relocations[i] {
+			t.Errorf("Expected %v; got %v", expected[i], obj.Relocations[i])
+		}
+	}
+
+	linked, err := LinkObjects(0x1000, []*Object{obj})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	code := []byte{0x00, 0x10, 0x34, 0x12, 0x10, 0x08, 0x10, 0x08, 0x60}
+	if !bytes.Equal(code, linked.Data) {
+		t.Errorf("Expected %x; got %x", code, linked.Data)
+	}
+}
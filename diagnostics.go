@@ -0,0 +1,101 @@
+package a2asm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/taeber/a2asm/syntax"
+)
+
+// Error is a problem with a line of source that stopped it assembling.
+type Error struct {
+	File string // the PUT or USE file, or empty for the source itself
+	Line uint
+
+	// Column and EndColumn are where the statement on the line starts and
+	// just past where it ends, counting from 1, or 0 if not known.
+	Column    int
+	EndColumn int
+
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.File != "" {
+		return fmt.Sprintf("%s: line %d - %s", e.File, e.Line, e.Message)
+	}
+	return fmt.Sprintf("line %d - %s", e.Line, e.Message)
+}
+
+// Diagnostic is an Error or Warning as reported to editors and other tools.
+type Diagnostic struct {
+	File      string `json:"file"`
+	Line      uint   `json:"line"`
+	Column    int    `json:"column,omitempty"`
+	EndColumn int    `json:"endColumn,omitempty"`
+	Severity  string `json:"severity"` // "error" or "warning"
+	Rule      string `json:"rule"`     // "error" or the warning's category
+	Message   string `json:"message"`
+}
+
+// ErrorRule is the Rule of every Diagnostic that is an error.
+const ErrorRule = "error"
+
+// Diagnostic returns e as a Diagnostic.
+func (e *Error) Diagnostic() Diagnostic {
+	return Diagnostic{e.File, e.Line, e.Column, e.EndColumn, "error", ErrorRule, e.Message}
+}
+
+// Diagnostics returns the warnings as Diagnostics, with the columns of the
+// statements they are about.
+func (result *Result) Diagnostics() []Diagnostic {
+	text := make(map[Position]string)
+	for _, line := range result.Lines {
+		file := line.File
+		if file == result.Name {
+			file = ""
+		}
+		text[Position{file, line.Number}] = line.Text
+	}
+
+	var diagnostics []Diagnostic
+	for _, w := range result.Warnings {
+		start, end := syntax.SplitLine(int(w.Line), text[Position{w.File, w.Line}]).Columns()
+		diagnostics = append(diagnostics, Diagnostic{w.File, w.Line, start, end, "warning", w.Category, w.Message})
+	}
+	return diagnostics
+}
+
+// ErrorDiagnostic returns err as a Diagnostic if it is, or wraps, an *Error.
+func ErrorDiagnostic(err error) (Diagnostic, bool) {
+	var e *Error
+	if !errors.As(err, &e) {
+		return Diagnostic{}, false
+	}
+	return e.Diagnostic(), true
+}
+
+// errorAt returns err as an *Error on the line at pos.
+func (s *state) errorAt(pos Position, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+
+	start, end := syntax.SplitLine(int(pos.Line), s.lineText(pos)).Columns()
+	return &Error{pos.File, pos.Line, start, end, err.Error()}
+}
+
+// lineText returns the text of the line at pos, if it has been read.
+func (s *state) lineText(pos Position) string {
+	for i := len(s.Lines) - 1; i >= 0; i-- {
+		if rec := s.Lines[i]; rec.File == pos.File && rec.Number == pos.Line {
+			return rec.Text
+		}
+	}
+	return ""
+}
@@ -0,0 +1,43 @@
+package a2asm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestErrorDiagnostic(t *testing.T) {
+	open := mapOpener(map[string]string{
+		"MAIN": " ORG $300\n PUT LIB\n",
+		"LIB":  "\n  LDA ($1234),Y  ; bad\n",
+	})
+
+	_, err := AssembleFile("MAIN", open)
+	if err == nil || err.Error() != "LIB: line 2 - $1234 is not a zero-page address" {
+		t.Fatalf("Expected a zero-page error in LIB; got %v", err)
+	}
+
+	d, ok := ErrorDiagnostic(err)
+	expected := Diagnostic{"LIB", 2, 3, 16, "error", ErrorRule, "$1234 is not a zero-page address"}
+	if !ok || d != expected {
+		t.Errorf("Expected %+v; got %+v", expected, d)
+	}
+}
+
+func TestWarningDiagnostics(t *testing.T) {
+	result, err := AssembleWithOptions(strings.NewReader(`
+		ORG $300
+START	LDA #$1234
+`), Options{Name: "MAIN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Diagnostic{{
+		"", 3, 1, 17, "warning", WarnTruncation,
+		"immediate value $1234 is truncated to $34; use < or > to pick a byte",
+	}}
+	if actual := result.Diagnostics(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %+v; got %+v", expected, actual)
+	}
+}
@@ -0,0 +1,143 @@
+package diskimage
+
+import (
+	"bytes"
+	"testing"
+)
+
+func highBit(text string) []byte {
+	b := []byte(text)
+	for i := range b {
+		b[i] |= 0x80
+	}
+	return b
+}
+
+// dos33Image builds a DOS 3.3 ordered image holding one text file.
+func dos33Image(name string, text []byte) []byte {
+	data := make([]byte, floppySize)
+	sector := func(t, s int) []byte {
+		off := (t*sectorsPerTrack + s) * sectorSize
+		return data[off : off+sectorSize]
+	}
+
+	vtoc := sector(17, 0)
+	vtoc[0x01], vtoc[0x02], vtoc[0x03] = 17, 15, 3
+	vtoc[0x27], vtoc[0x34], vtoc[0x35] = tsPairsPerList, 35, sectorsPerTrack
+
+	entry := sector(17, 15)[0x0B:]
+	entry[0], entry[1], entry[2] = 18, 0, 0x00
+	copy(entry[3:33], bytes.Repeat([]byte{0xA0}, 30))
+	copy(entry[3:], highBit(name))
+	entry[33] = 2
+
+	list := sector(18, 0)
+	list[0x0C], list[0x0D] = 18, 1
+	copy(sector(18, 1), text)
+
+	return data
+}
+
+// prodosImage builds a ProDOS ordered image holding a seedling file and a
+// sapling file in a subdirectory.
+func prodosImage(seedling, sapling []byte) []byte {
+	data := make([]byte, floppySize)
+	block := func(b int) []byte {
+		return data[b*blockSize : (b+1)*blockSize]
+	}
+
+	setEntry := func(entry []byte, storage byte, name string, fileType byte, key, eof int) {
+		entry[0] = storage<<4 | byte(len(name))
+		copy(entry[1:], name)
+		entry[0x10] = fileType
+		entry[0x11], entry[0x12] = byte(key), byte(key>>8)
+		entry[0x15], entry[0x16], entry[0x17] = byte(eof), byte(eof>>8), byte(eof>>16)
+	}
+
+	vol := block(volumeKeyBlock)
+	setEntry(vol[4:], storageVolHeader, "TEST", 0, 0, 0)
+	vol[4+0x1F], vol[4+0x20] = entryLen, entriesPerDir
+	setEntry(vol[4+entryLen:], storageSeedling, "HELLO.S", 0x04, 7, len(seedling))
+	setEntry(vol[4+2*entryLen:], storageSubdir, "LIB", 0x0F, 8, blockSize)
+	copy(block(7), seedling)
+
+	sub := block(8)
+	setEntry(sub[4:], storageSubHeader, "LIB", 0, 0, 0)
+	setEntry(sub[4+entryLen:], storageSapling, "BIG.S", 0x04, 9, len(sapling))
+	index := block(9)
+	index[0], index[1] = 10, 11
+	copy(block(10), sapling)
+	copy(block(11), sapling[blockSize:])
+
+	return data
+}
+
+// dosOrder reorders a ProDOS ordered 140K image into DOS 3.3 order.
+func dosOrder(po []byte) []byte {
+	do := make([]byte, len(po))
+	for t := 0; t < 35; t++ {
+		for s := 0; s < sectorsPerTrack; s++ {
+			src := (t*sectorsPerTrack + dosToProDOS[s]) * sectorSize
+			dst := (t*sectorsPerTrack + s) * sectorSize
+			copy(do[dst:dst+sectorSize], po[src:src+sectorSize])
+		}
+	}
+	return do
+}
+
+func TestDOS33(t *testing.T) {
+	text := highBit(" RTS\r")
+	img, err := Read(dos33Image("T.HELLO", append(text, 0, 0)), ".dsk")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if img.Format != "DOS 3.3" || len(img.Files) != 1 || img.Files[0].Type != "T" {
+		t.Fatalf("Unexpected catalog: %s %v", img.Format, img.Files)
+	}
+
+	data, err := img.ReadFile("t.hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(text, data) {
+		t.Errorf("Expected %v; got %v", text, data)
+	}
+}
+
+func TestProDOS(t *testing.T) {
+	seedling := highBit(" RTS\r")
+	sapling := bytes.Repeat(highBit(" NOP\r"), 150)
+	po := prodosImage(seedling, sapling)
+
+	for _, tc := range []struct {
+		data []byte
+		ext  string
+	}{{po, ".po"}, {dosOrder(po), ".dsk"}} {
+		img, err := Read(tc.data, tc.ext)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if img.Format != "ProDOS" || len(img.Files) != 2 {
+			t.Fatalf("Unexpected catalog: %s %v", img.Format, img.Files)
+		}
+
+		data, err := img.ReadFile("HELLO.S")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(seedling, data) {
+			t.Errorf("%s: Expected %v; got %v", tc.ext, seedling, data)
+		}
+
+		data, err = img.ReadFile("LIB/BIG.S")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(sapling, data) {
+			t.Errorf("%s: Expected %d bytes; got %d", tc.ext, len(sapling), len(data))
+		}
+	}
+}
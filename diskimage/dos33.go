@@ -0,0 +1,125 @@
+package diskimage
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	vtocTrack       = 17
+	catalogEntries  = 7
+	catalogEntryLen = 35
+	tsPairsPerList  = 122
+)
+
+var dos33Types = map[byte]string{
+	0x00: "T", 0x01: "I", 0x02: "A", 0x04: "B",
+	0x08: "S", 0x10: "R", 0x20: "A", 0x40: "B",
+}
+
+// isDOS33 reports whether d has a DOS 3.3 volume table of contents.
+func isDOS33(d disk) bool {
+	vtoc, err := d.sector(vtocTrack, 0)
+	if err != nil {
+		return false
+	}
+
+	return vtoc[0x01] > 0 && vtoc[0x01] < 35 && vtoc[0x02] < sectorsPerTrack &&
+		vtoc[0x03] == 3 && vtoc[0x27] == tsPairsPerList && vtoc[0x35] == sectorsPerTrack
+}
+
+func readDOS33(d disk) (*Image, error) {
+	img := &Image{Format: "DOS 3.3", disk: d}
+
+	vtoc, _ := d.sector(vtocTrack, 0)
+	t, s := int(vtoc[0x01]), int(vtoc[0x02])
+
+	for visited := 0; t != 0; visited++ {
+		if visited > 35*sectorsPerTrack {
+			return nil, fmt.Errorf("catalog loops")
+		}
+
+		catalog, err := d.sector(t, s)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := 0; i < catalogEntries; i++ {
+			entry := catalog[0x0B+i*catalogEntryLen:][:catalogEntryLen]
+			if entry[0] == 0 {
+				// Never used; the catalog ends here.
+				return img, nil
+			}
+			if entry[0] == 0xFF {
+				// Deleted
+				continue
+			}
+
+			name := make([]byte, 30)
+			for j := range name {
+				name[j] = entry[3+j] &^ 0x80
+			}
+
+			img.Files = append(img.Files, File{
+				Name:   strings.TrimRight(string(name), " "),
+				Type:   dos33Types[entry[2]&0x7F],
+				Size:   int(entry[33]) | int(entry[34])<<8,
+				track:  entry[0],
+				sector: entry[1],
+			})
+		}
+
+		t, s = int(catalog[0x01]), int(catalog[0x02])
+	}
+
+	return img, nil
+}
+
+func readDOS33File(d disk, f File) ([]byte, error) {
+	var data []byte
+
+	t, s := int(f.track), int(f.sector)
+	for visited := 0; t != 0; visited++ {
+		if visited > 35*sectorsPerTrack {
+			return nil, fmt.Errorf("%s: track/sector list loops", f.Name)
+		}
+
+		list, err := d.sector(t, s)
+		if err != nil {
+			return nil, err
+		}
+
+		offset := (int(list[0x05]) | int(list[0x06])<<8) * sectorSize
+		for i := 0; i < tsPairsPerList; i++ {
+			dt, ds := int(list[0x0C+i*2]), int(list[0x0D+i*2])
+			if dt == 0 && ds == 0 {
+				// A hole in a random access file or the end of the file
+				continue
+			}
+
+			sector, err := d.sector(dt, ds)
+			if err != nil {
+				return nil, err
+			}
+
+			pos := offset + i*sectorSize
+			for len(data) < pos {
+				data = append(data, 0)
+			}
+			data = append(data[:pos], sector...)
+		}
+
+		t, s = int(list[0x01]), int(list[0x02])
+	}
+
+	if f.Type == "T" {
+		for i, ch := range data {
+			if ch == 0 {
+				data = data[:i]
+				break
+			}
+		}
+	}
+
+	return data, nil
+}
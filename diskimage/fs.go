@@ -0,0 +1,148 @@
+package diskimage
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Open opens the named file for reading, so that an Image may be used as an
+// fs.FS. Names are compared without regard to case. "." is the volume and
+// ProDOS subdirectories open as directories.
+func (img *Image) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if f, ok := img.File(name); ok && name != "." {
+		data, err := img.ReadFile(name)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &openFile{bytes.NewReader(data), img.fileInfo(f)}, nil
+	}
+
+	entries, ok := img.readDir(name)
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	info := fileInfo{path.Base(name), 0, fs.ModeDir | 0555, File{Name: name}}
+	return &openDir{info, entries}, nil
+}
+
+// readDir returns the entries of the named directory, in order of name, and
+// whether it exists. Directories are only known by the files in them.
+func (img *Image) readDir(name string) ([]fs.DirEntry, bool) {
+	prefix := ""
+	if name != "." {
+		prefix = strings.ToUpper(name) + "/"
+	}
+
+	var entries []fs.DirEntry
+	seen := make(map[string]bool)
+	for _, f := range img.Files {
+		if !strings.HasPrefix(strings.ToUpper(f.Name), prefix) {
+			continue
+		}
+
+		rest := f.Name[len(prefix):]
+		if i := strings.Index(rest, "/"); i >= 0 {
+			dir := rest[:i]
+			if !seen[strings.ToUpper(dir)] {
+				seen[strings.ToUpper(dir)] = true
+				entries = append(entries, fileInfo{dir, 0, fs.ModeDir | 0555, File{Name: f.Name[:len(prefix)+i]}})
+			}
+			continue
+		}
+
+		if !seen[strings.ToUpper(rest)] {
+			seen[strings.ToUpper(rest)] = true
+			entries = append(entries, img.fileInfo(f))
+		}
+	}
+
+	if len(entries) == 0 && name != "." {
+		return nil, false
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, true
+}
+
+// fileInfo returns the fs.FileInfo of f, with the size its catalog entry
+// gives. For DOS 3.3 files, which are only counted in sectors, that is the
+// size of the sectors holding data; text files may end before it.
+func (img *Image) fileInfo(f File) fileInfo {
+	size := f.Size
+	if img.Format == "DOS 3.3" {
+		// Each track/sector list sector lists up to 122 data sectors.
+		lists := (f.Size + tsPairsPerList) / (tsPairsPerList + 1)
+		size = (f.Size - lists) * sectorSize
+	}
+	return fileInfo{path.Base(f.Name), int64(size), 0444, f}
+}
+
+// fileInfo describes a file or directory on an image. It is both the
+// fs.FileInfo and the fs.DirEntry.
+type fileInfo struct {
+	name string
+	size int64
+	mode fs.FileMode
+	file File
+}
+
+func (fi fileInfo) Name() string               { return fi.name }
+func (fi fileInfo) Size() int64                { return fi.size }
+func (fi fileInfo) Mode() fs.FileMode          { return fi.mode }
+func (fi fileInfo) ModTime() time.Time         { return time.Time{} }
+func (fi fileInfo) IsDir() bool                { return fi.mode.IsDir() }
+func (fi fileInfo) Sys() interface{}           { return fi.file }
+func (fi fileInfo) Type() fs.FileMode          { return fi.mode.Type() }
+func (fi fileInfo) Info() (fs.FileInfo, error) { return fi, nil }
+
+// openFile is a file opened for reading.
+type openFile struct {
+	*bytes.Reader
+	info fileInfo
+}
+
+func (f *openFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *openFile) Close() error               { return nil }
+
+// openDir is a directory opened for reading.
+type openDir struct {
+	info    fileInfo
+	entries []fs.DirEntry
+}
+
+func (d *openDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *openDir) Close() error               { return nil }
+
+func (d *openDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+func (d *openDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
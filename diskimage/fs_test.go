@@ -0,0 +1,56 @@
+package diskimage
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFS(t *testing.T) {
+	seedling := highBit(" RTS\r")
+	sapling := bytes.Repeat(highBit(" NOP\r"), 150)
+
+	img, err := Read(prodosImage(seedling, sapling), ".po")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fstest.TestFS(img, "HELLO.S", "LIB/BIG.S"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := fs.ReadFile(img, "lib/big.s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sapling, data) {
+		t.Errorf("Expected %d bytes; got %d", len(sapling), len(data))
+	}
+
+	if info, err := fs.Stat(img, "LIB/BIG.S"); err != nil || info.Size() != int64(len(sapling)) {
+		t.Errorf("Expected a size of %d; got %v, %v", len(sapling), info, err)
+	}
+}
+
+func TestFSDOS33(t *testing.T) {
+	text := highBit(" RTS\r")
+	img, err := Read(dos33Image("T.HELLO", append(text, 0, 0)), ".dsk")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fstest.TestFS(img, "T.HELLO"); err != nil {
+		t.Fatal(err)
+	}
+
+	// One sector of data and its track/sector list.
+	if info, err := fs.Stat(img, "T.HELLO"); err != nil || info.Size() != sectorSize {
+		t.Errorf("Expected a size of %d; got %v, %v", sectorSize, info, err)
+	}
+
+	if _, err := img.Open("T.GOODBYE"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist; got %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+// Package diskimage reads files from Apple II disk images formatted with DOS
+// 3.3 or ProDOS.
+//
+// 140K images (.dsk, .do, .po) may be in either DOS 3.3 or ProDOS sector
+// order; larger images (.po, .hdv) are ProDOS ordered. 2IMG (.2mg) images are
+// also understood.
+//
+// An Image is an fs.FS, so its files may be read with the io/fs functions or
+// assembled with a2asm.Options.FS.
+package diskimage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	sectorSize      = 256
+	blockSize       = 512
+	sectorsPerTrack = 16
+
+	floppySize = 35 * sectorsPerTrack * sectorSize // 140K
+)
+
+// File describes a file on a disk image.
+type File struct {
+	Name string // full path for files in ProDOS subdirectories
+	Type string // T, I, A, B, S, R for DOS 3.3; TXT, BIN, etc. for ProDOS
+	Size int    // in bytes, or sectors used for DOS 3.3 files
+
+	// DOS 3.3: the first track/sector list.
+	track, sector byte
+
+	// ProDOS: where the file's data starts and how it is indexed.
+	storage byte
+	key     uint16
+	eof     int
+}
+
+// Image is a disk image with a DOS 3.3 or ProDOS file system.
+type Image struct {
+	Format string // "DOS 3.3" or "ProDOS"
+	Files  []File
+
+	disk disk
+}
+
+// Open reads the disk image at path.
+func Open(path string) (*Image, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := Read(data, filepath.Ext(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return img, nil
+}
+
+// Read interprets data as a disk image. The file extension (such as ".po")
+// is used as a hint for the sector order of 140K images.
+func Read(data []byte, ext string) (*Image, error) {
+	prodosOrder := strings.EqualFold(ext, ".po")
+
+	if bytes.HasPrefix(data, []byte("2IMG")) {
+		var err error
+		if data, prodosOrder, err = read2IMG(data); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(data) < floppySize || len(data)%blockSize != 0 {
+		return nil, fmt.Errorf("not a disk image: unexpected size %d", len(data))
+	}
+
+	orders := []bool{prodosOrder, !prodosOrder}
+	if len(data) != floppySize {
+		orders = []bool{true}
+	}
+
+	for _, prodos := range orders {
+		d := disk{data, prodos}
+		if isDOS33(d) {
+			return readDOS33(d)
+		}
+		if isProDOS(d) {
+			return readProDOS(d)
+		}
+	}
+
+	return nil, fmt.Errorf("no DOS 3.3 or ProDOS file system found")
+}
+
+// read2IMG returns the disk data within a 2IMG image and whether it is in
+// ProDOS order.
+func read2IMG(data []byte) ([]byte, bool, error) {
+	if len(data) < 64 {
+		return nil, false, fmt.Errorf("2IMG header is too short")
+	}
+
+	format := binary.LittleEndian.Uint32(data[12:])
+	offset := binary.LittleEndian.Uint32(data[24:])
+	length := binary.LittleEndian.Uint32(data[28:])
+
+	if format > 1 {
+		return nil, false, fmt.Errorf("unsupported 2IMG format: %d", format)
+	}
+	if uint64(offset)+uint64(length) > uint64(len(data)) {
+		return nil, false, fmt.Errorf("2IMG data extends past the end of the file")
+	}
+
+	return data[offset : offset+length], format == 1, nil
+}
+
+// File returns the named file. Names are compared without regard to case.
+func (img *Image) File(name string) (File, bool) {
+	name = strings.Trim(name, "/")
+	for _, f := range img.Files {
+		if strings.EqualFold(f.Name, name) {
+			return f, true
+		}
+	}
+	return File{}, false
+}
+
+// ReadFile returns the contents of the named file. Text files end at the
+// first NUL. As with fs.ReadFile, names must not begin with a slash.
+func (img *Image) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+
+	f, ok := img.File(name)
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+
+	if img.Format == "DOS 3.3" {
+		return readDOS33File(img.disk, f)
+	}
+	return readProDOSFile(img.disk, f)
+}
+
+// disk gives access to the sectors and blocks of an image in either order.
+type disk struct {
+	data   []byte
+	prodos bool // ProDOS (block) order rather than DOS 3.3 order
+}
+
+// dosToProDOS maps a DOS 3.3 logical sector to its position within a track of
+// a ProDOS ordered image. The mapping is its own inverse.
+var dosToProDOS = [sectorsPerTrack]int{0, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1, 15}
+
+// sector returns DOS 3.3 track t, sector s.
+func (d disk) sector(t, s int) ([]byte, error) {
+	if s >= sectorsPerTrack || (t*sectorsPerTrack+s+1)*sectorSize > len(d.data) {
+		return nil, fmt.Errorf("track %d, sector %d is outside the disk", t, s)
+	}
+	if d.prodos {
+		s = dosToProDOS[s]
+	}
+	off := (t*sectorsPerTrack + s) * sectorSize
+	return d.data[off : off+sectorSize], nil
+}
+
+// block returns ProDOS block b.
+func (d disk) block(b int) ([]byte, error) {
+	if (b+1)*blockSize > len(d.data) {
+		return nil, fmt.Errorf("block %d is outside the disk", b)
+	}
+	if d.prodos {
+		return d.data[b*blockSize : (b+1)*blockSize], nil
+	}
+
+	// Each block is two sectors of a DOS 3.3 ordered track.
+	t, half := b/8, (b%8)*2
+	block := make([]byte, 0, blockSize)
+	for _, s := range []int{dosToProDOS[half], dosToProDOS[half+1]} {
+		off := (t*sectorsPerTrack + s) * sectorSize
+		block = append(block, d.data[off:off+sectorSize]...)
+	}
+	return block, nil
+}
@@ -0,0 +1,175 @@
+package diskimage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+const (
+	volumeKeyBlock = 2
+	entryLen       = 0x27
+	entriesPerDir  = 13
+)
+
+// ProDOS storage types
+const (
+	storageSeedling  = 1
+	storageSapling   = 2
+	storageTree      = 3
+	storageSubdir    = 0xD
+	storageSubHeader = 0xE
+	storageVolHeader = 0xF
+)
+
+var prodosTypes = map[byte]string{
+	0x00: "NON", 0x01: "BAD", 0x04: "TXT", 0x06: "BIN", 0x0F: "DIR",
+	0xF8: "LNK", 0xFC: "BAS", 0xFD: "VAR", 0xFE: "REL", 0xFF: "SYS",
+}
+
+// isProDOS reports whether d has a ProDOS volume directory.
+func isProDOS(d disk) bool {
+	key, err := d.block(volumeKeyBlock)
+	if err != nil {
+		return false
+	}
+
+	return binary.LittleEndian.Uint16(key[0:]) == 0 &&
+		key[4]>>4 == storageVolHeader && key[4]&0x0F > 0 &&
+		key[0x23] == entryLen && key[0x24] == entriesPerDir
+}
+
+func readProDOS(d disk) (*Image, error) {
+	img := &Image{Format: "ProDOS", disk: d}
+	if err := img.readDirectory(volumeKeyBlock, "", 0); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+func (img *Image) readDirectory(block uint16, path string, depth int) error {
+	if depth > 16 {
+		return fmt.Errorf("%s: directories nested too deeply", path)
+	}
+
+	for visited := 0; block != 0; visited++ {
+		if visited > len(img.disk.data)/blockSize {
+			return fmt.Errorf("%s: directory loops", path)
+		}
+
+		dir, err := img.disk.block(int(block))
+		if err != nil {
+			return err
+		}
+
+		for i := 0; i < entriesPerDir; i++ {
+			entry := dir[4+i*entryLen:][:entryLen]
+			storage := entry[0] >> 4
+			name := path + string(entry[1:1+entry[0]&0x0F])
+
+			switch storage {
+			case 0, storageSubHeader, storageVolHeader:
+				// Deleted or a directory header
+				continue
+			case storageSubdir:
+				key := binary.LittleEndian.Uint16(entry[0x11:])
+				if err := img.readDirectory(key, name+"/", depth+1); err != nil {
+					return err
+				}
+				continue
+			}
+
+			fileType, ok := prodosTypes[entry[0x10]]
+			if !ok {
+				fileType = fmt.Sprintf("$%02X", entry[0x10])
+			}
+
+			eof := int(entry[0x15]) | int(entry[0x16])<<8 | int(entry[0x17])<<16
+			img.Files = append(img.Files, File{
+				Name:    name,
+				Type:    fileType,
+				Size:    eof,
+				storage: storage,
+				key:     binary.LittleEndian.Uint16(entry[0x11:]),
+				eof:     eof,
+			})
+		}
+
+		block = binary.LittleEndian.Uint16(dir[2:])
+	}
+
+	return nil
+}
+
+func readProDOSFile(d disk, f File) ([]byte, error) {
+	var blocks []uint16
+
+	switch f.storage {
+	case storageSeedling:
+		blocks = []uint16{f.key}
+	case storageSapling:
+		index, err := d.block(int(f.key))
+		if err != nil {
+			return nil, err
+		}
+		blocks = indexBlocks(index)
+	case storageTree:
+		master, err := d.block(int(f.key))
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range indexBlocks(master) {
+			if b == 0 {
+				blocks = append(blocks, make([]uint16, 256)...)
+				continue
+			}
+			index, err := d.block(int(b))
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, indexBlocks(index)...)
+		}
+	default:
+		return nil, fmt.Errorf("%s: unsupported storage type %d", f.Name, f.storage)
+	}
+
+	data := make([]byte, 0, f.eof)
+	for _, b := range blocks {
+		if len(data) >= f.eof {
+			break
+		}
+		if b == 0 {
+			// Sparse
+			data = append(data, make([]byte, blockSize)...)
+			continue
+		}
+		block, err := d.block(int(b))
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, block...)
+	}
+
+	if len(data) < f.eof {
+		return nil, fmt.Errorf("%s: file is shorter than its length", f.Name)
+	}
+	data = data[:f.eof]
+
+	if f.Type == "TXT" {
+		if i := strings.IndexByte(string(data), 0); i >= 0 {
+			data = data[:i]
+		}
+	}
+
+	return data, nil
+}
+
+// indexBlocks returns the block numbers in an index block, which holds the
+// low bytes in its first half and the high bytes in its second.
+func indexBlocks(index []byte) []uint16 {
+	blocks := make([]uint16, 256)
+	for i := range blocks {
+		blocks[i] = uint16(index[i]) | uint16(index[256+i])<<8
+	}
+	return blocks
+}
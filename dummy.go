@@ -0,0 +1,64 @@
+package a2asm
+
+import (
+	"fmt"
+
+	"github.com/taeber/a2asm/syntax"
+)
+
+// dummy is where assembly resumes once a DUM section ends.
+type dummy struct {
+	Address    address
+	Top        bool
+	Written    uint16
+	LineNumber uint
+}
+
+// dum handles DUM, which starts (or moves) a dummy section at the address in
+// args. Labels in a dummy section are given addresses, counting up from there
+// as DS and the data directives reserve space, but nothing is written. It is
+// how zero-page variables and parameter blocks are usually laid out:
+//
+//	        DUM $06
+//	PTR     DS 2
+//	COUNT   DS 1
+//	        DEND
+//
+// The labels are absolute, so they are never relocated in REL files.
+func (s *state) dum(args []syntax.Expr) error {
+	x, err := single("DUM", args)
+	if err != nil {
+		return err
+	}
+	addr, err := s.evalNow(x)
+	if err != nil {
+		return err
+	}
+
+	if s.Dummy == nil {
+		s.Dummy = &dummy{s.Address, s.Top, s.Written, s.LineNumber}
+	}
+
+	s.Address, s.Top = addr, false
+	return nil
+}
+
+// dend handles DEND, which ends a dummy section and returns to where the
+// assembly left off.
+func (s *state) dend() error {
+	if s.Dummy == nil {
+		return fmt.Errorf("DEND without DUM")
+	}
+
+	s.Address, s.Top, s.Written = s.Dummy.Address, s.Dummy.Top, s.Dummy.Written
+	s.Dummy = nil
+	return nil
+}
+
+// finishDummy reports a dummy section that was never ended.
+func (s *state) finishDummy() error {
+	if s.Dummy == nil {
+		return nil
+	}
+	return s.errorAt(Position{"", s.Dummy.LineNumber}, fmt.Errorf("DUM without DEND"))
+}
@@ -0,0 +1,71 @@
+package a2asm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDUM(t *testing.T) {
+	actual := assembleBytes(t, `
+		ORG $300
+		DUM $06
+PTR		DS 2
+COUNT	DFB 0
+		DEND
+		DUM $42
+CMD		DS 1
+UNIT	DS 1
+		DEND
+START	LDA #0
+		STA PTR
+		STA COUNT
+		LDA UNIT
+		RTS
+`)
+
+	expected := []byte("\xA9\x00\x85\x06\x85\x08\xA5\x43\x60")
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("Expected %x; got %x", expected, actual)
+	}
+}
+
+func TestDUMInREL(t *testing.T) {
+	obj, err := AssembleObject(strings.NewReader(`
+		REL
+		DUM 0
+PTR		DS 2
+		DEND
+START	LDA PTR
+		JMP START
+`))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := []byte("\xA5\x00\x4C\x00\x80")
+	if !bytes.Equal(expected, obj.Code()) {
+		t.Errorf("Expected %x; got %x", expected, obj.Code())
+	}
+
+	if len(obj.Relocations) != 1 || obj.Relocations[0].Offset != 3 {
+		t.Errorf("Expected only JMP START to be relocated; got %v", obj.Relocations)
+	}
+}
+
+func TestDUMErrors(t *testing.T) {
+	tests := map[string]string{
+		" DEND":                    "line 1 - DEND without DUM",
+		" DUM $06\nPTR DS 2":       "line 1 - DUM without DEND",
+		" DUM $06\n LDA #0\n DEND": "line 2 - LDA is not allowed in a DUM section; only DS and data",
+		" DUM $06\n ORG $300":      "line 2 - ORG is not allowed in a DUM section",
+	}
+
+	for src, expected := range tests {
+		_, err := AssembleSegments(strings.NewReader(src))
+		if err == nil || err.Error() != expected {
+			t.Errorf("%q: expected %q; got %v", src, expected, err)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package a2asm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/taeber/a2asm/syntax"
+)
+
+// equate is an EQU whose expression refers to labels not yet defined. It is
+// evaluated once every line has been read.
+type equate struct {
+	Name       string
+	Expr       expression
+	File       string
+	LineNumber uint
+}
+
+// equ handles EQU (or =), which defines label as the value of the expression
+// in args. Expressions may refer to labels defined later in the source:
+//
+//	BUFEND  EQU BUFFER+$100
+//	        ...
+//	BUFFER  DS $100
+//
+// Such an EQU is resolved at the end, so until then BUFEND is treated like
+// any other label not yet defined.
+func (s *state) equ(label string, args []syntax.Expr) error {
+	if label == "" {
+		return fmt.Errorf("EQU without a label")
+	}
+
+	// The label is a constant, not the address of the line.
+	delete(s.Labels, label)
+
+	x, err := single("EQU", args)
+	if err != nil {
+		return err
+	}
+
+	e := s.expression(x)
+	value, _, err := s.eval(e)
+	switch err.(type) {
+	case nil:
+		s.Constants[label] = value
+	case undefinedError:
+		s.Equates = append(s.Equates, &equate{label, e, s.File, s.LineNumber})
+	default:
+		return err
+	}
+
+	return nil
+}
+
+// resolveEquates evaluates the EQUs that referred to labels defined after
+// them, in whatever order they depend on each other.
+func (s *state) resolveEquates() error {
+	pending := make(map[string]*equate)
+	for _, eq := range s.Equates {
+		pending[eq.Name] = eq
+	}
+
+	var chain []string
+	var resolve func(eq *equate) error
+	resolve = func(eq *equate) error {
+		for i, name := range chain {
+			if name == eq.Name {
+				s.File, s.LineNumber = eq.File, eq.LineNumber
+				return s.errorf("circular EQU: %s -> %s", strings.Join(chain[i:], " -> "), eq.Name)
+			}
+		}
+		chain = append(chain, eq.Name)
+		defer func() { chain = chain[:len(chain)-1] }()
+
+		for {
+			value, _, err := s.eval(eq.Expr)
+			if undef, ok := err.(undefinedError); ok {
+				if next, ok := pending[undef.Name]; ok {
+					if err = resolve(next); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+			if err != nil {
+				s.File, s.LineNumber = eq.File, eq.LineNumber
+				return s.error(err)
+			}
+
+			s.Constants[eq.Name] = value
+			delete(pending, eq.Name)
+			return nil
+		}
+	}
+
+	for _, eq := range s.Equates {
+		if _, ok := pending[eq.Name]; !ok {
+			continue
+		}
+		if err := resolve(eq); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package a2asm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestEQU(t *testing.T) {
+	actual := assembleBytes(t, `
+COUT	EQU $FDED
+CH		= $24
+		ORG $300
+		LDA #"A"
+		STA CH
+		JSR COUT
+`)
+
+	expected := []byte("\xA9\xC1\x85\x24\x20\xED\xFD")
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("Expected %x; got %x", expected, actual)
+	}
+}
+
+func TestEQUForwardReference(t *testing.T) {
+	actual := assembleBytes(t, `
+		ORG $300
+BUFEND	EQU BUFFER+$100
+LAST	EQU BUFEND-1
+		LDA LAST
+		DA BUFEND
+		LDX #>BUFEND
+		RTS
+BUFFER	DS 2
+`)
+
+	expected := []byte("\xAD\x07\x04\x08\x04\xA2\x04\x60\x00\x00")
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("Expected %x; got %x", expected, actual)
+	}
+}
+
+func TestEQUUnknownLabel(t *testing.T) {
+	_, err := AssembleSegments(strings.NewReader(`
+		ORG $300
+BUFEND	EQU BUFFER+$100
+		RTS
+`))
+	if err == nil || err.Error() != "line 3 - unknown label: BUFFER" {
+		t.Errorf("Expected an unknown label error; got %v", err)
+	}
+}
+
+func TestEQUCycle(t *testing.T) {
+	_, err := AssembleSegments(strings.NewReader(`
+		ORG $300
+A		EQU B+1
+B		EQU C+1
+C		EQU A+1
+		RTS
+`))
+	if err == nil || err.Error() != "line 3 - circular EQU: A -> B -> C -> A" {
+		t.Errorf("Expected a circular EQU error; got %v", err)
+	}
+}
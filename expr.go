@@ -0,0 +1,215 @@
+package a2asm
+
+import (
+	"fmt"
+
+	"github.com/taeber/a2asm/syntax"
+)
+
+// expression is an operand that may need evaluating after the line it is on,
+// once the labels it refers to are defined. It keeps what it needs from that
+// line: the address of the line, for *, and the global label before it, for
+// local labels.
+type expression struct {
+	X     syntax.Expr
+	Here  address
+	Scope string
+}
+
+// undefinedError is returned by eval for a label that is not defined yet.
+type undefinedError struct {
+	Name string
+}
+
+func (e undefinedError) Error() string {
+	return fmt.Sprintf("unknown label: %s", e.Name)
+}
+
+// expression returns x as an expression evaluated from the current line.
+func (s *state) expression(x syntax.Expr) expression {
+	return expression{x, s.Address, s.CurrentLabel}
+}
+
+// eval returns the value of the expression e. The terms of an expression are
+// numbers, characters ('A' or "A"), labels and * (the address of the line),
+// combined from left to right with +, -, *, /, & (and) and ! (exclusive or),
+// or compared with <, =, > and # (not equal), which give 1 if true and 0 if
+// not. A leading < or > selects the low or high byte of the result.
+//
+// ref is the label the value is relative to, with its selector, when e is a
+// single label plus or minus numbers; it is what needs relocating in REL
+// files. When a label is not defined yet, err is an undefinedError.
+func (s *state) eval(e expression) (value uint16, ref string, err error) {
+	ev, err := s.evaluate(e)
+	if err != nil {
+		return 0, "", err
+	}
+	if ev.Undefined != "" {
+		return 0, "", undefinedError{ev.Undefined}
+	}
+
+	ref = ev.Ref
+	if ref != "" && ev.Selector != 0 {
+		ref = string(ev.Selector) + ref
+	}
+	return ev.selected(), ref, nil
+}
+
+// evaluation is what evaluating an expression finds.
+type evaluation struct {
+	Value    uint16 // before the selector is applied
+	Selector byte   // < or > to select the low or high byte, or 0
+
+	// Ref is the only label of an expression that is a label plus or minus
+	// numbers, and Offset is Value less the value of the label.
+	Ref    string
+	Offset uint16
+
+	// Undefined is the first label that is not defined yet. It counts as 0.
+	Undefined string
+}
+
+// selected returns the value with the selector applied.
+func (ev evaluation) selected() uint16 {
+	switch ev.Selector {
+	case '<':
+		return ev.Value & 0xFF
+	case '>':
+		return ev.Value >> 8
+	}
+	return ev.Value
+}
+
+// single returns the one expression in the operand of mneumonic.
+func single(mneumonic string, args []syntax.Expr) (syntax.Expr, error) {
+	switch {
+	case len(args) == 0:
+		return nil, fmt.Errorf("%s needs an expression", mneumonic)
+	case len(args) > 1:
+		return nil, fmt.Errorf("%s takes one expression", mneumonic)
+	}
+	return args[0], nil
+}
+
+// evaluate evaluates e as eval does, but labels that are not defined yet do
+// not stop it.
+func (s *state) evaluate(e expression) (ev evaluation, err error) {
+	x := e.X
+	if u, ok := x.(*syntax.Unary); ok && (u.Op == '<' || u.Op == '>') {
+		ev.Selector, x = u.Op, u.X
+	}
+
+	var labels int
+	var refValue uint16
+	simple := true
+
+	var walk func(x syntax.Expr) (uint16, error)
+	walk = func(x syntax.Expr) (uint16, error) {
+		switch x := x.(type) {
+		case *syntax.Number:
+			return x.Value, nil
+
+		case *syntax.Char:
+			return x.Value, nil
+
+		case *syntax.Here:
+			labels++
+			ev.Ref, refValue = "*", e.Here
+			return e.Here, nil
+
+		case *syntax.Ident:
+			name := x.Name
+			if name[0] == '.' || name[0] == ':' {
+				name = e.Scope + name
+			}
+			s.use(name)
+
+			var value uint16
+			if def, ok := s.Constants[name]; ok {
+				value = def
+			} else if addr, ok := s.Labels[name]; ok {
+				value = addr
+			} else if !s.isExternal(name) && ev.Undefined == "" {
+				ev.Undefined = name
+			}
+			labels++
+			ev.Ref, refValue = name, value
+			return value, nil
+
+		case *syntax.Unary:
+			// Leading minus
+			n := labels
+			value, err := walk(x.X)
+			simple = simple && labels == n
+			return -value, err
+
+		case *syntax.Binary:
+			value, err := walk(x.X)
+			if err != nil {
+				return 0, err
+			}
+			n := labels
+			term, err := walk(x.Y)
+			if err != nil {
+				return 0, err
+			}
+			switch x.Op {
+			case '+':
+			case '-':
+				simple = simple && labels == n
+			default:
+				simple = false
+			}
+			return operate(x.Op, value, term)
+		}
+		return 0, fmt.Errorf("invalid expression: %s", x)
+	}
+
+	if ev.Value, err = walk(x); err != nil {
+		return evaluation{}, err
+	}
+
+	if labels != 1 || !simple {
+		ev.Ref = ""
+	} else {
+		ev.Offset = ev.Value - refValue
+	}
+	return ev, nil
+}
+
+// operate returns value op term.
+func operate(op byte, value, term uint16) (uint16, error) {
+	switch op {
+	case '+':
+		return value + term, nil
+	case '-':
+		return value - term, nil
+	case '*':
+		return value * term, nil
+	case '/':
+		if term == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return value / term, nil
+	case '&':
+		return value & term, nil
+	case '!':
+		return value ^ term, nil
+	case '<':
+		return boolValue(value < term), nil
+	case '=':
+		return boolValue(value == term), nil
+	case '>':
+		return boolValue(value > term), nil
+	case '#':
+		return boolValue(value != term), nil
+	}
+	return 0, fmt.Errorf("invalid arithmetic operator: %c", op)
+}
+
+func boolValue(b bool) uint16 {
+	if b {
+		return 1
+	}
+	return 0
+}
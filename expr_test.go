@@ -0,0 +1,84 @@
+package a2asm
+
+import (
+	"testing"
+
+	"github.com/taeber/a2asm/syntax"
+)
+
+// evalText parses and evaluates text as the operand of a line at $310 after
+// the label START.
+func evalText(s *state, text string) (uint16, string, error) {
+	x, err := syntax.ParseExpr(text, 1)
+	if err != nil {
+		return 0, "", err
+	}
+	return s.eval(expression{x, 0x310, "START"})
+}
+
+func TestEval(t *testing.T) {
+	s := newState(nil)
+	s.Labels["START"] = 0x300
+	s.Labels["START:LOOP"] = 0x305
+	s.Constants["BELL"] = 0xFBDD
+
+	tests := []struct {
+		Text  string
+		Value uint16
+		Ref   string
+	}{
+		{"$12", 0x12, ""},
+		{"%101", 5, ""},
+		{"2+3*5", 25, ""},
+		{"-1", 0xFFFF, ""},
+		{"START+1", 0x301, "START"},
+		{"START-1", 0x2FF, "START"},
+		{">START", 0x03, ">START"},
+		{"<BELL+2", 0xDF, "<BELL"},
+		{"*", 0x310, "*"},
+		{"*-START", 0x10, ""},
+		{":LOOP", 0x305, "START:LOOP"},
+		{"START*2", 0x600, ""},
+		{"$FF&$0F", 0x0F, ""},
+		{"$FF!$0F", 0xF0, ""},
+		{`"A"`, 0xC1, ""},
+		{`'A'+1`, 0x42, ""},
+		{"*<$4000", 1, ""},
+		{"START>$300", 0, ""},
+		{"START=$300", 1, ""},
+		{"START#$300", 0, ""},
+	}
+
+	for _, test := range tests {
+		value, ref, err := evalText(s, test.Text)
+		if err != nil {
+			t.Errorf("%s: %v", test.Text, err)
+			continue
+		}
+		if value != test.Value || ref != test.Ref {
+			t.Errorf("%s: expected $%04X, %q; got $%04X, %q", test.Text, test.Value, test.Ref, value, ref)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	s := newState(nil)
+
+	tests := map[string]string{
+		"LATER+1": "unknown label: LATER",
+		"1/0":     "division by zero",
+		"1+":      "missing term after +",
+		"1?2":     "invalid arithmetic operator: ?",
+	}
+
+	for text, expected := range tests {
+		_, _, err := evalText(s, text)
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected %q; got %v", text, expected, err)
+		}
+	}
+
+	if _, _, err := evalText(s, "LATER"); err != (undefinedError{"LATER"}) {
+		t.Errorf("Expected an undefinedError; got %v", err)
+	}
+}
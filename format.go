@@ -0,0 +1,111 @@
+package a2asm
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/taeber/a2asm/syntax"
+)
+
+// FormatOptions are the columns, counting from 0, that Format starts the
+// opcode, operand and comment fields in. Zero picks the default.
+type FormatOptions struct {
+	Opcode  int
+	Operand int
+	Comment int
+}
+
+// DefaultFormatOptions are MERLIN's own tab stops.
+var DefaultFormatOptions = FormatOptions{Opcode: 9, Operand: 15, Comment: 26}
+
+// Format lays out each line of src in columns, as the MERLIN editor shows
+// them, padding with spaces. Mnemonics and hex numbers are uppercased, and
+// lines that are all comment are kept as they are. Fields too long for
+// their column are followed by a single space.
+//
+// Sources in native MERLIN format are read as plain text, which is what
+// Format returns. Lines may be any length.
+func Format(src []byte, opts FormatOptions) ([]byte, error) {
+	if opts.Opcode == 0 {
+		opts.Opcode = DefaultFormatOptions.Opcode
+	}
+	if opts.Operand == 0 {
+		opts.Operand = DefaultFormatOptions.Operand
+	}
+	if opts.Comment == 0 {
+		opts.Comment = DefaultFormatOptions.Comment
+	}
+
+	var out bytes.Buffer
+	r := bufio.NewReader(readSource(bytes.NewReader(src)))
+	for {
+		line, err := r.ReadString('\n')
+		if len(line) > 0 {
+			out.WriteString(formatLine(strings.TrimSuffix(line, "\n"), opts))
+			out.WriteByte('\n')
+		}
+		if err == io.EOF {
+			return out.Bytes(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func formatLine(line string, opts FormatOptions) string {
+	line = strings.TrimRight(line, " \t\r")
+
+	fields := splitMerlinFields(line)
+	if fields[1] == "" && fields[3] == "" {
+		// Blank lines, labels alone and whole-line comments.
+		return fields[0]
+	}
+
+	fields[1] = strings.ToUpper(fields[1])
+	fields[2] = formatOperand(fields[1], fields[2])
+
+	var b strings.Builder
+	b.WriteString(fields[0])
+	for i, column := range []int{opts.Opcode, opts.Operand, opts.Comment} {
+		if fields[i+1] == "" {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		for b.Len() < column {
+			b.WriteByte(' ')
+		}
+		b.WriteString(fields[i+1])
+	}
+	return b.String()
+}
+
+// formatOperand uppercases the hex numbers in the operand of opcode, leaving
+// strings and characters as they are. Operands that do not scan are kept as
+// written.
+func formatOperand(opcode, operand string) string {
+	if opcode == "HEX" {
+		return strings.ToUpper(operand)
+	}
+	if syntax.IsString(opcode) {
+		return operand
+	}
+
+	tokens, err := syntax.Scan(operand, 1)
+	if err != nil {
+		return operand
+	}
+
+	var b strings.Builder
+	for _, tok := range tokens {
+		if tok.Kind == syntax.NumberToken && tok.Text[0] == '$' {
+			tok.Text = strings.ToUpper(tok.Text)
+		}
+		b.WriteString(tok.Text)
+	}
+	return b.String()
+}
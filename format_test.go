@@ -0,0 +1,116 @@
+package a2asm
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func format(t *testing.T, src []byte, opts FormatOptions) string {
+	t.Helper()
+
+	out, err := Format(src, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestFormat(t *testing.T) {
+	src := "* HELLO, WORLD\n" +
+		"COUT = $fded\n" +
+		"\torg $300\n" +
+		"START\tlda\t#\"a\"\n" +
+		"  jsr COUT   ;print it\n" +
+		"\tldx #$0a ; $ff stays\n" +
+		"\tasc \"$ab cd\"\n" +
+		"\thex 0a0b\n" +
+		"\tlda: $10,x\n" +
+		"; flush comment\n" +
+		"   ; indented comment\n" +
+		"VERYLONGLABEL lda 'b'\n" +
+		"DONE   \n" +
+		"\n" +
+		"\trts\n"
+
+	expected := "* HELLO, WORLD\n" +
+		"COUT     =     $FDED\n" +
+		"         ORG   $300\n" +
+		"START    LDA   #\"a\"\n" +
+		"         JSR   COUT       ;print it\n" +
+		"         LDX   #$0A       ; $ff stays\n" +
+		"         ASC   \"$ab cd\"\n" +
+		"         HEX   0A0B\n" +
+		"         LDA:  $10,x\n" +
+		"; flush comment\n" +
+		"                          ; indented comment\n" +
+		"VERYLONGLABEL LDA 'b'\n" +
+		"DONE\n" +
+		"\n" +
+		"         RTS\n"
+
+	actual := format(t, []byte(src), FormatOptions{})
+	if actual != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, actual)
+	}
+
+	if again := format(t, []byte(actual), FormatOptions{}); again != actual {
+		t.Errorf("Expected formatting to be stable; got:\n%s", again)
+	}
+}
+
+func TestFormatColumns(t *testing.T) {
+	actual := format(t, []byte("START LDA #1 ; ONE\n"), FormatOptions{Opcode: 8, Operand: 12, Comment: 20})
+	expected := "START   LDA #1      ; ONE\n"
+	if actual != expected {
+		t.Errorf("Expected %q; got %q", expected, actual)
+	}
+}
+
+func TestFormatNative(t *testing.T) {
+	actual := format(t, highBit(" lda #$c1\r"), FormatOptions{})
+	expected := "         LDA   #$C1\n"
+	if actual != expected {
+		t.Errorf("Expected %q; got %q", expected, actual)
+	}
+}
+
+// TestFormatAssembles checks that formatting the example programs changes
+// nothing they assemble to.
+func TestFormatAssembles(t *testing.T) {
+	paths, err := filepath.Glob("6502progs/*.s")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var expected, actual bytes.Buffer
+		if _, err := Assemble(&expected, bytes.NewReader(src), true); err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		if _, err := Assemble(&actual, strings.NewReader(format(t, src, FormatOptions{})), true); err != nil {
+			t.Errorf("%s formatted: %v", path, err)
+			continue
+		}
+		if !bytes.Equal(expected.Bytes(), actual.Bytes()) {
+			t.Errorf("%s assembles differently once formatted", path)
+		}
+	}
+}
+
+func TestFormatLongLine(t *testing.T) {
+	comment := "; " + strings.Repeat("-", 70000)
+	actual := format(t, []byte(" RTS "+comment+"\n LDA #1\n"), FormatOptions{})
+	expected := "         RTS              " + comment + "\n         LDA   #1\n"
+	if actual != expected {
+		t.Errorf("Expected %d bytes; got %d", len(expected), len(actual))
+	}
+}
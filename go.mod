@@ -1,3 +1,3 @@
 module github.com/taeber/a2asm
 
-go 1.13
+go 1.16
@@ -0,0 +1,108 @@
+package a2asm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+)
+
+// Opener opens a source file by name.
+type Opener func(name string) (io.ReadCloser, error)
+
+// FSOpener returns an Opener for the files in fsys, such as an embed.FS,
+// fstest.MapFS, zip.Reader or diskimage.Image.
+func FSOpener(fsys fs.FS) Opener {
+	return func(name string) (io.ReadCloser, error) {
+		return fsys.Open(name)
+	}
+}
+
+// maxIncludeDepth limits how deeply PUT and USE files may be nested.
+const maxIncludeDepth = 16
+
+// include is where to resume reading once a PUT or USE file ends.
+type include struct {
+	Reader     *bufio.Reader
+	LineNumber uint
+	File       string
+	Closer     io.Closer
+}
+
+// AssembleFile assembles the named MERLIN source. The source and any files it
+// includes with PUT or USE are opened with open, trying MERLIN's names for
+// source files (T.NAME for DOS 3.3 and NAME.S for ProDOS) when name itself
+// cannot be opened.
+func AssembleFile(name string, open Opener) (*Object, error) {
+	result, err := AssembleWithOptions(nil, Options{Name: name, Open: open})
+	if err != nil {
+		return nil, err
+	}
+	return result.Object, nil
+}
+
+// SourceNames returns the names MERLIN might have saved the source name as,
+// starting with name itself.
+func SourceNames(name string) []string {
+	return []string{name, "T." + name, name + ".S"}
+}
+
+// openSource opens the first of the SourceNames of name that exists.
+func openSource(open Opener, name string) (fp io.ReadCloser, opened string, err error) {
+	var firstErr error
+	for _, opened = range SourceNames(name) {
+		if fp, err = open(opened); err == nil {
+			return
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return nil, "", firstErr
+}
+
+// include handles PUT and USE, which read the source of another file as if it
+// appeared in place of the line. There are no macros to define, so USE is the
+// same as PUT.
+func (s *state) include(name string) error {
+	if name == "" {
+		return fmt.Errorf("missing file name")
+	}
+
+	if s.Open == nil {
+		return fmt.Errorf("cannot open %s without a file system", name)
+	}
+
+	if len(s.Includes) == maxIncludeDepth {
+		return fmt.Errorf("%s: files included too deeply", name)
+	}
+
+	fp, opened, err := openSource(s.Open, name)
+	if err != nil {
+		return err
+	}
+
+	s.Includes = append(s.Includes, &include{s.Reader, s.LineNumber, s.File, fp})
+	s.Reader = bufio.NewReader(readSource(fp))
+	s.LineNumber = 0
+	s.File = opened
+	if s.Dir != "" {
+		s.File = path.Join(s.Dir, opened)
+	}
+
+	return nil
+}
+
+// endInclude resumes reading the file that included the one just finished.
+func (s *state) endInclude() error {
+	last := s.Includes[len(s.Includes)-1]
+	s.Includes = s.Includes[:len(s.Includes)-1]
+
+	s.Reader = last.Reader
+	s.LineNumber = last.LineNumber
+	s.File = last.File
+
+	return last.Closer.Close()
+}
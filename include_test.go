@@ -0,0 +1,77 @@
+package a2asm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func mapOpener(files map[string]string) Opener {
+	return func(name string) (io.ReadCloser, error) {
+		src, ok := files[name]
+		if !ok {
+			return nil, fmt.Errorf("%s: file not found", name)
+		}
+		return ioutil.NopCloser(strings.NewReader(src)), nil
+	}
+}
+
+func TestPUT(t *testing.T) {
+	open := mapOpener(map[string]string{
+		"MAIN.S": `
+		ORG $300
+		PUT EQUATES
+		JSR BELL
+		RTS
+`,
+		"T.EQUATES": `
+BELL	EQU $FBDD
+`,
+	})
+
+	obj, err := AssembleFile("MAIN", open)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := []byte("\x20\xDD\xFB\x60")
+	actual := obj.Segments[0].Data
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("Expected %v; got %v", expected, actual)
+	}
+}
+
+func TestPUTErrorNamesFile(t *testing.T) {
+	open := mapOpener(map[string]string{
+		"MAIN": " PUT BAD\n",
+		"BAD":  "\n XYZ\n",
+	})
+
+	_, err := AssembleFile("MAIN", open)
+	if err == nil || !strings.HasPrefix(err.Error(), "BAD: line 2 - ") {
+		t.Errorf("Expected an error on line 2 of BAD; got %v", err)
+	}
+}
+
+func TestPUTFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"src/MAIN.S":    {Data: []byte(" ORG $300\n PUT EQUATES\n JSR BELL\n")},
+		"src/T.EQUATES": {Data: []byte("BELL EQU $FBDD\n")},
+	}
+
+	result, err := AssembleWithOptions(nil, Options{Name: "src/MAIN", FS: fsys})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte("\x20\xDD\xFB")
+	actual := result.Segments[0].Data
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("Expected %v; got %v", expected, actual)
+	}
+}
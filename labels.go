@@ -0,0 +1,54 @@
+package a2asm
+
+import (
+	"fmt"
+)
+
+// definition is where a label was defined.
+type definition struct {
+	File       string
+	LineNumber uint
+	Scope      string // the global label a local label belongs to
+}
+
+func (d definition) String() string {
+	if d.File != "" {
+		return fmt.Sprintf("%s: line %d", d.File, d.LineNumber)
+	}
+	return fmt.Sprintf("line %d", d.LineNumber)
+}
+
+// define notes that label is defined on the current line and returns the name
+// it is known by. Following MERLIN:
+//
+//   - Global labels may only be defined once and each starts a new scope for
+//     the local labels after it.
+//   - Local labels (:LOOP, or .LOOP) belong to the global label before them,
+//     so the same name may be used again after the next global label, but
+//     there must be a global label first.
+//   - Variables (]COUNT) may be redefined and do not start a new scope.
+func (s *state) define(label string) (string, error) {
+	def := definition{s.File, s.LineNumber, ""}
+
+	switch label[0] {
+	case ']':
+		return label, nil
+
+	case ':', '.':
+		if s.CurrentLabel == "" {
+			return "", fmt.Errorf("local label %s must follow a global label", label)
+		}
+		def.Scope = s.CurrentLabel
+		label = s.CurrentLabel + label
+
+	default:
+		s.CurrentLabel = label
+	}
+
+	if first, ok := s.Definitions[label]; ok {
+		return "", fmt.Errorf("duplicate label %s; first defined on %v", label, first)
+	}
+
+	s.Definitions[label] = def
+	return label, nil
+}
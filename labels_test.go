@@ -0,0 +1,172 @@
+package a2asm
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLocalLabelScopes(t *testing.T) {
+	actual := assembleBytes(t, `
+		ORG $300
+FIRST	LDX #2
+:LOOP	DEX
+		BNE :LOOP
+SECOND	LDY #2
+:LOOP	DEY
+		BNE :LOOP
+]COUNT	= 1
+]COUNT	= 2
+		LDA #]COUNT
+		RTS
+`)
+
+	expected := []byte("\xA2\x02\xCA\xD0\xFD\xA0\x02\x88\xD0\xFD\xA9\x02\x60")
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("Expected %x; got %x", expected, actual)
+	}
+}
+
+func TestLabelErrors(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{`
+		ORG $300
+START	NOP
+START	RTS
+`, "line 4 - duplicate label START; first defined on line 3"},
+		{`
+COUT	EQU $FDED
+		ORG $300
+COUT	RTS
+`, "line 4 - duplicate label COUT; first defined on line 2"},
+		{`
+		ORG $300
+:LOOP	DEX
+`, "line 3 - local label :LOOP must follow a global label"},
+		{`
+		ORG $300
+START	DEX
+:LOOP	DEX
+:LOOP	RTS
+`, "line 5 - duplicate label START:LOOP; first defined on line 4"},
+	}
+
+	for _, test := range tests {
+		_, err := AssembleSegments(strings.NewReader(test.src))
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("Expected %q; got %v", test.expected, err)
+		}
+	}
+}
+
+func TestDuplicateLabelInPUT(t *testing.T) {
+	open := mapOpener(map[string]string{
+		"MAIN": " ORG $300\nSTART NOP\n PUT LIB\n",
+		"LIB":  "START RTS\n",
+	})
+
+	_, err := AssembleFile("MAIN", open)
+	if err == nil || err.Error() != "LIB: line 1 - duplicate label START; first defined on line 2" {
+		t.Errorf("Expected both definitions of START; got %v", err)
+	}
+}
+
+func TestSymbolsWithLocals(t *testing.T) {
+	src := `
+		ORG $300
+START	LDX #2
+:LOOP	DEX
+		BNE :LOOP
+		RTS
+`
+	result, err := AssembleWithOptions(strings.NewReader(src), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Symbols) != 1 {
+		t.Errorf("Expected only START without Locals; got %v", result.Symbols)
+	}
+
+	if result, err = AssembleWithOptions(strings.NewReader(src), Options{Locals: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := result.WriteSymbols(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "START            $0300  label\n  :LOOP          $0302  label\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+	}
+}
+
+func TestSymbolsWithPrefixedScopes(t *testing.T) {
+	result, err := AssembleWithOptions(strings.NewReader(`
+		ORG $300
+START	LDX #2
+:LOOP	DEX
+		BNE :LOOP
+START1	LDY #2
+:LOOP	DEY
+		BNE :LOOP
+:DONE	RTS
+`), Options{Locals: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := result.WriteSymbols(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "START            $0300  label\n  :LOOP          $0302  label\n" +
+		"START1           $0305  label\n  :DONE          $030A  label\n  :LOOP          $0307  label\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+	}
+}
+
+func TestSymbolPositions(t *testing.T) {
+	open := func(name string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(" JSR PRINT\n")), nil
+	}
+	result, err := AssembleWithOptions(strings.NewReader(`
+		ORG $300
+START	LDX #2
+:LOOP	DEX
+		BNE :LOOP
+		JMP END
+		PUT LIB
+END		JMP START
+PRINT	RTS
+`), Options{Open: open, Locals: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][2]interface{}{
+		"START": {Position{"", 3}, []Position{{"", 8}}},
+		":LOOP": {Position{"", 4}, []Position{{"", 5}}},
+		"END":   {Position{"", 8}, []Position{{"", 6}}},
+		"PRINT": {Position{"", 9}, []Position{{"LIB", 1}}},
+	}
+	for _, sym := range result.Symbols {
+		want, ok := expected[sym.Name]
+		if !ok {
+			t.Errorf("Unexpected symbol %v", sym)
+			continue
+		}
+		if sym.Defined != want[0] || !reflect.DeepEqual(sym.References, want[1]) {
+			t.Errorf("Expected %s defined on %v and used on %v; got %v and %v",
+				sym.Name, want[0], want[1], sym.Defined, sym.References)
+		}
+	}
+}
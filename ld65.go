@@ -0,0 +1,345 @@
+package a2asm
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// ldConfig is the subset of an ld65 linker configuration used to place the
+// segments of a ca65-style source.
+type ldConfig struct {
+	Memory   []*ldMemory
+	Segments []*ldSegment
+}
+
+// ldMemory is an area of memory from the MEMORY block.
+type ldMemory struct {
+	Name    string
+	Start   int
+	Size    int
+	File    bool // written to the output
+	Fill    bool // padded to its full size
+	FillVal byte
+}
+
+// ldSegment says where a segment from the SEGMENTS block is loaded.
+type ldSegment struct {
+	Name     string
+	Load     string
+	Type     string // ro, rw, bss or zp
+	Start    int    // or -1 to follow the previous segment
+	Align    int
+	Optional bool
+}
+
+func (cfg *ldConfig) memory(name string) *ldMemory {
+	for _, mem := range cfg.Memory {
+		if mem.Name == name {
+			return mem
+		}
+	}
+	return nil
+}
+
+func (cfg *ldConfig) segment(name string) *ldSegment {
+	for _, seg := range cfg.Segments {
+		if seg.Name == name {
+			return seg
+		}
+	}
+	return nil
+}
+
+// layout places the segments one after another within their memory areas, in
+// the order of the SEGMENTS block, and returns where each one starts.
+func (cfg *ldConfig) layout(sizes map[string]int, used []string) (map[string]address, error) {
+	bases := make(map[string]address)
+	next := make(map[string]int)
+	for _, mem := range cfg.Memory {
+		next[mem.Name] = mem.Start
+	}
+
+	isUsed := make(map[string]bool)
+	for _, name := range used {
+		isUsed[name] = true
+	}
+
+	for _, seg := range cfg.Segments {
+		if !isUsed[seg.Name] {
+			continue
+		}
+
+		mem := cfg.memory(seg.Load)
+		addr := next[mem.Name]
+		if seg.Start >= 0 {
+			if seg.Start < addr {
+				return nil, fmt.Errorf("segment %s at $%04X overlaps the segment before it", seg.Name, seg.Start)
+			}
+			addr = seg.Start
+		}
+		if seg.Align > 1 && addr%seg.Align != 0 {
+			addr += seg.Align - addr%seg.Align
+		}
+
+		end := addr + sizes[seg.Name]
+		if end > mem.Start+mem.Size {
+			return nil, fmt.Errorf("segment %s overflows memory area %s by %d bytes",
+				seg.Name, mem.Name, end-(mem.Start+mem.Size))
+		}
+
+		bases[seg.Name] = address(addr)
+		next[mem.Name] = end
+	}
+
+	return bases, nil
+}
+
+// parseLdConfig reads the MEMORY and SEGMENTS blocks of an ld65 linker
+// configuration.
+func parseLdConfig(src io.Reader) (*ldConfig, error) {
+	text, err := ioutil.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := ldParser{tokens: tokenizeLdConfig(string(text))}
+	cfg := &ldConfig{}
+
+	for !p.done() {
+		block := p.next()
+		if err := p.expect("{"); err != nil {
+			return nil, err
+		}
+
+		for !p.done() && p.peek() != "}" {
+			name := p.next()
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+
+			attrs, err := p.attributes()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+
+			switch block {
+			case "MEMORY":
+				mem, err := newLdMemory(name, attrs)
+				if err != nil {
+					return nil, fmt.Errorf("MEMORY %s: %v", name, err)
+				}
+				cfg.Memory = append(cfg.Memory, mem)
+			case "SEGMENTS":
+				seg, err := newLdSegment(name, attrs)
+				if err != nil {
+					return nil, fmt.Errorf("SEGMENTS %s: %v", name, err)
+				}
+				cfg.Segments = append(cfg.Segments, seg)
+			default:
+				return nil, fmt.Errorf("unsupported linker configuration block: %s", block)
+			}
+		}
+
+		if err := p.expect("}"); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, seg := range cfg.Segments {
+		if cfg.memory(seg.Load) == nil {
+			return nil, fmt.Errorf("segment %s loads into unknown memory area %s", seg.Name, seg.Load)
+		}
+	}
+
+	return cfg, nil
+}
+
+func newLdMemory(name string, attrs map[string]string) (mem *ldMemory, err error) {
+	mem = &ldMemory{Name: name, File: true} // ld65 writes to %O by default
+	for key, value := range attrs {
+		switch key {
+		case "start":
+			mem.Start, err = parseLdNumber(value)
+		case "size":
+			mem.Size, err = parseLdNumber(value)
+		case "file":
+			mem.File = value != `""`
+		case "fill":
+			mem.Fill = value == "yes"
+		case "fillval":
+			var n int
+			n, err = parseLdNumber(value)
+			mem.FillVal = byte(n)
+		case "type", "define":
+		default:
+			err = fmt.Errorf("unsupported attribute: %s", key)
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	if mem.Start+mem.Size > 0x10000 {
+		err = fmt.Errorf("extends past $FFFF")
+	}
+	return
+}
+
+func newLdSegment(name string, attrs map[string]string) (seg *ldSegment, err error) {
+	seg = &ldSegment{Name: name, Type: "ro", Start: -1}
+	for key, value := range attrs {
+		switch key {
+		case "load":
+			seg.Load = value
+		case "type":
+			seg.Type = value
+			if value != "ro" && value != "rw" && value != "bss" && value != "zp" {
+				err = fmt.Errorf("unsupported type: %s", value)
+			}
+		case "start":
+			seg.Start, err = parseLdNumber(value)
+		case "align":
+			seg.Align, err = parseLdNumber(value)
+		case "optional":
+			seg.Optional = value == "yes"
+		case "define", "run":
+		default:
+			err = fmt.Errorf("unsupported attribute: %s", key)
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	if seg.Load == "" {
+		err = fmt.Errorf("missing load")
+	}
+	return
+}
+
+// parseLdNumber reads a number, or a sum or difference of numbers.
+func parseLdNumber(text string) (int, error) {
+	total, sign := 0, 1
+	for _, term := range strings.Fields(strings.NewReplacer("+", " + ", "-", " - ").Replace(text)) {
+		switch term {
+		case "+":
+			sign = 1
+			continue
+		case "-":
+			sign = -1
+			continue
+		}
+
+		var n uint64
+		var err error
+		switch term[0] {
+		case '$':
+			n, err = strconv.ParseUint(term[1:], 16, 32)
+		case '%':
+			n, err = strconv.ParseUint(term[1:], 2, 32)
+		default:
+			n, err = strconv.ParseUint(term, 10, 32)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("invalid number: %s", text)
+		}
+		total += sign * int(n)
+	}
+	return total, nil
+}
+
+type ldParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *ldParser) done() bool { return p.pos >= len(p.tokens) }
+
+func (p *ldParser) peek() string {
+	if p.done() {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *ldParser) next() string {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+func (p *ldParser) expect(tok string) error {
+	if got := p.next(); got != tok {
+		return fmt.Errorf("expected %s in linker configuration; got %q", tok, got)
+	}
+	return nil
+}
+
+// attributes reads "key = value, ...;" up to and including the semicolon.
+func (p *ldParser) attributes() (map[string]string, error) {
+	attrs := make(map[string]string)
+	for {
+		key := p.next()
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+
+		var value []string
+		for !p.done() && p.peek() != "," && p.peek() != ";" {
+			value = append(value, p.next())
+		}
+		attrs[strings.ToLower(key)] = strings.Join(value, "")
+
+		switch p.next() {
+		case ",":
+			if p.peek() == ";" {
+				p.next()
+				return attrs, nil
+			}
+		case ";":
+			return attrs, nil
+		default:
+			return nil, fmt.Errorf("expected ; in linker configuration")
+		}
+	}
+}
+
+// tokenizeLdConfig splits text into words, quoted strings and punctuation,
+// dropping # comments.
+func tokenizeLdConfig(text string) (tokens []string) {
+	for i := 0; i < len(text); {
+		ch := text[i]
+		switch {
+		case ch == '#':
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+		case ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n':
+			i++
+		case strings.IndexByte("{}:,;=+-", ch) >= 0:
+			tokens = append(tokens, string(ch))
+			i++
+		case ch == '"':
+			j := i + 1
+			for j < len(text) && text[j] != '"' {
+				j++
+			}
+			if j < len(text) {
+				j++
+			}
+			tokens = append(tokens, text[i:j])
+			i = j
+		default:
+			j := i
+			for j < len(text) && strings.IndexByte(" \t\r\n#{}:,;=+-\"", text[j]) < 0 {
+				j++
+			}
+			tokens = append(tokens, text[i:j])
+			i = j
+		}
+	}
+	return
+}
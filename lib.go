@@ -3,13 +3,15 @@ package a2asm
 // Super simple assembler
 import (
 	"bufio"
-	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
-	"strconv"
+	"sort"
 	"strings"
 
 	"io"
+
+	"github.com/taeber/a2asm/syntax"
 )
 
 const highASCII = 0b1000_0000
@@ -17,16 +19,55 @@ const highASCII = 0b1000_0000
 // Assemble reads MERLIN-style 6502 assembly from src and writes the
 // corresponding binary to dst. It returns how many bytes were written or if
 // an error (err) occurred.
+//
+// When the source uses more than one ORG, the segments are written as a
+// single image with any gaps between them filled with zeros. Use
+// AssembleSegments to control how discontiguous output is written.
+//
+// Assemble is kept for compatibility; AssembleWithOptions returns more.
 func Assemble(dst io.Writer, src io.Reader, headless bool) (written uint, err error) {
-	s := state{
-		Reader:     bufio.NewReader(src),
-		Labels:     make(map[string]address),
-		Constants:  make(map[string]uint16),
-		References: make(map[string][]*reference),
+	result, err := AssembleWithOptions(src, Options{})
+	if err != nil {
+		return
+	}
+
+	return WriteImage(dst, result.Segments, headless)
+}
+
+// AssembleSegments reads MERLIN-style 6502 assembly from src and returns the
+// assembled segments, one for each ORG that was followed by code, ordered by
+// where they appear in the source. Overlapping segments are an error.
+func AssembleSegments(src io.Reader) (segments []Segment, err error) {
+	var obj *Object
+	if obj, err = AssembleObject(src); err != nil {
+		return
+	}
+
+	segments = obj.Segments
+	return
+}
+
+func assemble(src io.Reader, dir string, opts Options) (s *state, err error) {
+	s = newState(readSource(src))
+	s.Open, s.Dir = opts.Open, dir
+
+	if err = s.setWarnings(opts.Warnings); err != nil {
+		return
+	}
+
+	if opts.Charset != "" {
+		var ok bool
+		if s.Charset, ok = charsetNames[strings.ToUpper(opts.Charset)]; !ok {
+			err = fmt.Errorf("unknown character set: %s; expected IIE, II+ or IIE-ALT", opts.Charset)
+			return
+		}
 	}
 
 	for err == nil {
-		err = parseLine(&s)
+		err = parseLine(s)
+		if err == nil && s.Wrapped {
+			err = fmt.Errorf("code wraps around past $FFFF")
+		}
 	}
 
 	if err != io.EOF {
@@ -34,9 +75,48 @@ func Assemble(dst io.Writer, src io.Reader, headless bool) (written uint, err er
 		return
 	}
 
-	err = nil
+	err = s.finish()
+	return
+}
+
+func newState(src io.Reader) *state {
+	return &state{
+		Reader:      bufio.NewReader(src),
+		Labels:      make(map[string]address),
+		Definitions: make(map[string]definition),
+		Uses:        make(map[string][]Position),
+		Constants:   make(map[string]uint16),
+		References:  make(map[string][]*reference),
+		Externals:   make(map[string]byte),
+	}
+}
+
+// finish resolves the references left once every line has been read, fills
+// in checksums and checks the resulting segments.
+func (s *state) finish() (err error) {
+	s.Resolving = true
+
+	if err = s.finishDummy(); err != nil {
+		return
+	}
+
+	s.closeSegment()
 
+	if err = s.resolveEquates(); err != nil {
+		return
+	}
+
+	if err = s.resolveFixups(); err != nil {
+		return
+	}
+
+	labels := make([]string, 0, len(s.References))
 	for lbl := range s.References {
+		labels = append(labels, lbl)
+	}
+	sort.Strings(labels)
+
+	for _, lbl := range labels {
 		if lbl[0] == '<' || lbl[0] == '>' {
 			// TODO: handle self-ref #>* and #<*
 			var num uint16
@@ -52,6 +132,10 @@ func Assemble(dst io.Writer, src io.Reader, headless bool) (written uint, err er
 			}
 			for _, ref := range s.References[lbl] {
 				value := num + uint16(s.Memory[ref.Address])
+				if ref.Implied && value > 0xFF {
+					s.warnAt(Position{ref.File, ref.LineNumber}, WarnTruncation,
+						"immediate value %s ($%04X) is truncated to $%02X; use < or > to pick a byte", lbl[1:], value, byte(value))
+				}
 				if lbl[0] == '>' {
 					// Produce high-byte of expression
 					s.Memory[ref.Address] = uint8((value >> 8) & 0xff)
@@ -66,6 +150,10 @@ func Assemble(dst io.Writer, src io.Reader, headless bool) (written uint, err er
 		num, ok := s.Constants[lbl]
 		if ok {
 			for _, ref := range s.References[lbl] {
+				if ref.ZeroPage && num > 0xFF {
+					s.File, s.LineNumber = ref.File, ref.LineNumber
+					return s.errorf("%s ($%04X) is not a zero-page address", lbl, num)
+				}
 				if num <= 0xFF {
 					s.Memory[ref.Address] += uint8(num)
 				} else {
@@ -84,13 +172,31 @@ func Assemble(dst io.Writer, src io.Reader, headless bool) (written uint, err er
 
 			for _, ref := range s.References[lbl] {
 				pos := ref.Address
-				num := binary.LittleEndian.Uint16(s.Memory[pos:])
-				if !ref.Relative {
-					binary.LittleEndian.PutUint16(s.Memory[pos:], num+addr)
-					continue
-				}
+				switch {
+				case ref.ZeroPage:
+					value := uint16(s.Memory[pos]) + addr
+					if value > 0xFF {
+						s.File, s.LineNumber = ref.File, ref.LineNumber
+						return s.errorf("%s ($%04X) is not a zero-page address", lbl, value)
+					}
+					s.Memory[pos] = uint8(value)
+
+				case ref.Relative:
+					offset := int(addr) - int(pos+1)
+					if offset < -128 || offset > 127 {
+						s.File, s.LineNumber = ref.File, ref.LineNumber
+						return s.errorf("branch to %s is out of range (%d bytes away)", lbl, offset)
+					}
+					s.checkBranch(Position{ref.File, ref.LineNumber}, lbl, offset)
+					s.Memory[pos] = uint8(offset)
 
-				s.Memory[pos] = uint8(addr - (pos + 1))
+				default:
+					num := binary.LittleEndian.Uint16(s.Memory[pos:]) + addr
+					binary.LittleEndian.PutUint16(s.Memory[pos:], num)
+					if ref.Indirect {
+						s.checkIndirectJMP(Position{ref.File, ref.LineNumber}, num)
+					}
+				}
 			}
 		} else {
 			// self reference
@@ -110,29 +216,27 @@ func Assemble(dst io.Writer, src io.Reader, headless bool) (written uint, err er
 		}
 	}
 
+	if err = s.checkAssertions(); err != nil {
+		return
+	}
+
 	for _, chk := range s.Checkpoints {
 		var xor uint8
-		for _, b := range s.Memory[s.Origin:chk] {
+		for _, b := range s.Memory[chk.Start:chk.Address] {
 			xor ^= b
 		}
-		s.Memory[chk] = xor
+		s.Memory[chk.Address] = xor
 	}
 
-	written = uint(s.Written)
-	if !headless {
-		if err = binary.Write(dst, binary.LittleEndian, s.Origin); err != nil {
-			return
-		}
-		written += 2
-
-		if err = binary.Write(dst, binary.LittleEndian, s.Written); err != nil {
-			return
-		}
-		written += 2
+	if err = s.checkOverlaps(); err != nil {
+		return
 	}
 
-	dst.Write(s.Memory[s.Origin:s.Address])
+	if err = s.finishRelocations(); err != nil {
+		return
+	}
 
+	s.warnUnused()
 	return
 }
 
@@ -143,24 +247,90 @@ type state struct {
 	Reader       *bufio.Reader
 	Labels       map[string]address
 	CurrentLabel string
+	Definitions  map[string]definition
 	Constants    map[string]uint16
 	References   map[string][]*reference
-	Checkpoints  []address
-
-	Memory  [0xFFFF]byte
-	Origin  address
-	Address address
-	Written uint16
+	Fixups       []*fixup
+	Equates      []*equate
+	Assertions   []*assertion
+	Checkpoints  []checkpoint
+	Segments     []span
+
+	Relocatable bool
+	Relocations []*relocation
+	Entries     []string
+	Externals   map[string]byte
+
+	// Charset is the character set SCR, INV, FLS and MTX encode for.
+	Charset charset
+
+	Memory     [0x10000]byte
+	Origin     address
+	OriginLine uint
+	Address    address
+	Written    uint16
 
 	LineNumber uint
 	Line       []byte
 
+	// File is the name of the PUT or USE file being read, if any. Dir is
+	// the directory that names opened with Open are in, if not the current
+	// one; File keeps it in the name.
+	File     string
+	Dir      string
+	Includes []*include
+	Open     Opener
+
+	// Dummy is set while in a DUM section.
+	Dummy *dummy
+
+	// Top is set when the last byte written was at $FFFF, leaving the
+	// address at the top of memory ($10000). Writing more sets Wrapped.
+	Top     bool
+	Wrapped bool
+
+	// Lines and Warnings are returned in the Result.
+	Lines    []lineRecord
+	Warnings []Warning
+
+	// Enabled is whether each category of warning is on. Ignores are the
+	// a2asm:ignore comments that turn warnings off, by line.
+	Enabled map[string]bool
+	Ignores map[Position]string
+
+	// Uses are the lines that refer to each label. Resolving is set once
+	// every line has been read, when labels are evaluated again rather than
+	// referred to anew.
+	Uses      map[string][]Position
+	Resolving bool
+
 	Label string
 }
 
 type reference struct {
 	Address  address
 	Relative bool
+	ZeroPage bool // a one-byte address, as in ($12),Y
+	Implied  bool // the low byte of LABEL, as in LDA #LABEL
+	Indirect bool // the address of JMP ($1234)
+
+	File       string
+	LineNumber uint
+}
+
+// span is the range of memory [Start, End) assembled after an ORG. End is an
+// int as it may be $10000.
+type span struct {
+	Start address
+	End   int
+
+	LineNumber uint
+}
+
+// checkpoint is where a CHK stores the checksum of the bytes before it.
+type checkpoint struct {
+	Start   address
+	Address address
 }
 
 type addressingMode uint
@@ -188,253 +358,161 @@ func isLetter(ch byte) bool {
 	return ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z')
 }
 
-func readLabel(line []byte) (label string, remaining []byte) {
-	remaining = line
-	for i, ch := range line {
-		if ch != ' ' && ch != '\t' {
-			continue
-		}
-
-		label = string(line[0:i])
-		remaining = line[i:]
-
-		break
-	}
-
-	return
-}
-
-func readMneumonic(line []byte) (mneumonic string, remaining []byte) {
-	remaining = line
-	i := 0
-
-	for ; i < len(line); i++ {
-		if line[i] != ' ' && line[i] != '\t' {
-			break
-		}
-	}
-
-	if line[i] == '=' {
-		mneumonic = "EQU"
-		i = i + 1
-	} else if i+3 > len(line) {
-		return
-	} else {
-		mneumonic = string(line[i : i+3])
-		mneumonic = strings.ToUpper(mneumonic)
-		i = i + 3
-	}
-
-	if i < len(line) {
-		if line[i] == ' ' || line[i] == '\t' {
-			i++
-		}
-	}
-
-	remaining = line[i:]
-	return
-}
-
-// readNumber parses text for a number (decimal, hex, or binary) and returns
-// the uint16 representation of it along with the remaining text. If parsing
-// fails, an error is returned and the other returned values should be ignored.
-func readNumber(text []byte) (uint16, []byte, error) {
-	if text[0] == '$' {
-		// Read hex literal.
-		var i int
-		for i = 1; i < len(text); i++ {
-			if !isHex(text[i]) {
-				break
-			}
-		}
-
-		num, err := strconv.ParseUint(string(text[1:i]), 16, 16)
-		if err != nil {
-			return 0, text, err
-		}
-
-		return uint16(num), text[i:], err
-	}
-
-	if text[0] == '%' {
-		// Read binary literal.
-		var i int
-		for i = 1; i < len(text); i++ {
-			if text[i] != '0' && text[i] != '1' {
-				break
-			}
-		}
-
-		num, err := strconv.ParseUint(string(text[1:i]), 2, 16)
-		if err != nil {
-			return 0, text, err
-		}
-
-		return uint16(num), text[i:], err
-	}
-
-	if isDigit(text[0]) {
-		var i int
-		for i = 0; i < len(text); i++ {
-			if !isDigit(text[i]) {
-				break
-			}
-		}
-
-		num, err := strconv.ParseUint(string(text[0:i]), 10, 16)
-		if err != nil {
-			return 0, text, err
-		}
-
-		return uint16(num), text[i:], err
-	}
-
-	if len(text) >= 3 {
-		// ASCII character
-		if text[0] == '\'' && text[2] == '\'' {
-			// low-ASCII (high-bit off)
-			return uint16(text[1]), text[3:], nil
-		}
-		if text[0] == '"' && text[2] == '"' {
-			// high-ASCII (high-bit on)
-			return uint16(text[1] | highASCII), text[3:], nil
-		}
-	}
-
-	return 0, text, fmt.Errorf("expected hex, binary, or decimal literal; got %s", text)
-}
-
 func parseLine(s *state) (err error) {
 	var isPrefix bool
 
 	if s.Line, isPrefix, err = s.Reader.ReadLine(); err != nil {
+		if err == io.EOF && len(s.Includes) > 0 {
+			err = s.endInclude()
+		}
 		return
 	}
 
 	s.LineNumber++
 
 	if isPrefix {
-		err = fmt.Errorf("line %d is too long", s.LineNumber)
+		err = fmt.Errorf("line is too long")
 		return
 	}
 
-	if len(s.Line) == 0 {
-		// Skip empty lines.
-		return
-	}
+	defer s.noteLine(s.File, s.LineNumber, string(s.Line), s.Address, s.Written)
 
-	trimmed := string(s.Line)
-	trimmed = strings.Trim(trimmed, " \t")
-	if len(trimmed) == 0 || trimmed[0] == '*' || trimmed[0] == ';' {
-		// Skip comments.
+	fields, operandErr := syntax.ParseLine(int(s.LineNumber), string(s.Line))
+	s.noteIgnores(fields.Comment.Text)
+	if operandErr != nil {
+		// Only the message; the line is added to any error.
+		operandErr = errors.New(operandErr.(*syntax.Error).Msg)
+	}
+	if fields.IsComment() {
+		// Skip comments and empty lines.
 		return
 	}
 
-	line := s.Line
-
-	var label string
-	label, line = readLabel(line)
+	label := fields.Label.Text
 
 	// Note the address of the label, if there is one.
 	if label != "" {
-		if label[0] != '.' && label[0] != ':' {
-			s.CurrentLabel = label
+		if label, err = s.define(label); err != nil {
+			return
+		}
+		if s.Dummy != nil {
+			s.Constants[label] = s.Address
 		} else {
-			// Local Label
-			label = s.CurrentLabel + label
+			s.Labels[label] = s.Address
 		}
-		s.Labels[label] = s.Address
 	}
 
-	var mneumonic string
-	mneumonic, line = readMneumonic(line)
+	mneumonic := fields.Mnemonic()
+	if mneumonic == "" {
+		// Only a label.
+		return
+	}
+
+	if operandErr != nil && fields.Instruction == "" && fields.Operand.Text != "" {
+		// A directive with an operand it cannot use. Those with none say
+		// what they need themselves.
+		return operandErr
+	}
+	args, operand := fields.Args, fields.Operand.Text
 
 	switch mneumonic {
 	case "ORG":
-		s.Address, _, err = readNumber(line)
+		if s.Dummy != nil {
+			err = fmt.Errorf("ORG is not allowed in a DUM section")
+			return
+		}
+		if s.Relocatable {
+			err = fmt.Errorf("ORG is not allowed in a REL file")
+			return
+		}
+		if len(args) == 0 {
+			err = fmt.Errorf("missing address")
+			return
+		}
+		var origin syntax.Expr
+		if origin, err = single(mneumonic, args); err != nil {
+			return
+		}
+		var addr uint16
+		if addr, err = s.evalNow(origin); err != nil {
+			return
+		}
+		s.closeSegment()
+		s.Address = addr
 		s.Origin = s.Address
+		s.Top = false
+		s.OriginLine = s.LineNumber
 		return
 
 	case "EQU":
-		var def uint16
-		var ref string
-		def, ref, err = parseOperandValue(line)
-		if aliasedValue, ok := s.Constants[ref]; ok {
-			def = aliasedValue
-		} else if aliasedValue, ok := s.Labels[ref]; ok {
-			def = aliasedValue
-		}
-		s.Constants[label] = def
+		err = s.equ(label, args)
 		return
 
 	case "CHK":
-		s.Checkpoints = append(s.Checkpoints, s.Address)
+		if s.Dummy != nil {
+			err = fmt.Errorf("CHK is not allowed in a DUM section")
+			return
+		}
+		s.Checkpoints = append(s.Checkpoints, checkpoint{s.Origin, s.Address})
 		s.write(0x00)
 		return
 
-	case "DFB":
-		refs := bytes.Split(line, []byte{','})
-
-		for _, txt := range refs {
-			var num uint16
-			var ref string
-			num, ref, err = parseOperandValue(txt)
+	case "DFB", "DA", "DW", "DDB":
+		err = s.data(mneumonic, args)
+		return
 
-			if ref == "" {
-				s.writeShort(num)
-				continue
-			}
+	case "DS":
+		err = s.ds(operand, args)
+		return
 
-			// num, line, err = readNumber([]bytes(line)
-			num, ok := s.Constants[ref]
-			if !ok {
-				num, _, err = readNumber([]byte(ref))
-				if err != nil {
-					err = fmt.Errorf("unknown constant: %s", ref)
-					return
-				}
-			}
-			s.writeShort(num)
+	case "HEX":
+		var data []byte
+		if data, err = parseHex(operand); err != nil {
+			return
 		}
+		for _, b := range data {
+			s.write(b)
+		}
+		return
 
+	case "ASC", "DCI", "INV", "FLS", "REV", "STR", "SCR", "MTX":
+		err = s.str(mneumonic, operand)
 		return
 
-	case "HEX":
-		var num uint16
-		for i := 0; i+1 < len(line); i += 2 {
-			if line[i] == ' ' {
-				break
-			}
-			num, _, err = readNumber(append([]byte{'$'}, line[i:i+2]...))
-			if err != nil {
-				return
-			}
-			s.writeShort(num)
-		}
+	case "CHARSET":
+		err = s.setCharset(operand)
 		return
 
-	case "ASC":
-		if !(line[0] == '\'' || line[0] == '"') {
-			err = fmt.Errorf("unexpected character: %c", line[0])
-			return
-		}
+	case "REL":
+		err = s.rel()
+		return
 
-		var mask uint8
-		if line[0] == '"' {
-			mask = highASCII
-		}
+	case "ENT":
+		err = s.ent(label, operand)
+		return
 
-		quote := line[0]
+	case "EXT":
+		err = s.ext(label)
+		return
 
-		for prev, ch := range line[1:] {
-			escaped := line[prev] == '\\'
-			if ch == quote && !escaped {
-				return
-			}
-			s.write(ch | mask)
-		}
+	case "PUT", "USE":
+		err = s.include(operand)
+		return
+
+	case "DUM":
+		err = s.dum(args)
+		return
+
+	case "ERR":
+		err = s.err(operand, args)
+		return
+
+	case "ASSERT":
+		err = s.assert(args)
+		return
 
-		err = fmt.Errorf("unterminated string")
+	case "DEND":
+		err = s.dend()
 		return
 
 	case "LST":
@@ -442,6 +520,22 @@ func parseLine(s *state) (err error) {
 		return
 	}
 
+	if s.Dummy != nil {
+		return fmt.Errorf("%s is not allowed in a DUM section; only DS and data", mneumonic)
+	}
+
+	return s.instruction(fields, operandErr)
+}
+
+// instruction encodes the 6502 instruction parsed into l. operandErr is the
+// error parsing its operand, if any; the operand of an implied instruction is
+// a comment.
+func (s *state) instruction(l *syntax.Line, operandErr error) (err error) {
+	mneumonic := l.Instruction
+	if mneumonic == "" {
+		return fmt.Errorf(`unknown mneumonic: "%s"`, l.Mnemonic())
+	}
+
 	// TODO: Consider using two lookup tables (opcode, lengths) instead.
 	//  opcode $F2 = Invalid mode
 	//  opcode $02 = Ambiguous; could be Absolute or Zero Page
@@ -507,39 +601,90 @@ func parseLine(s *state) (err error) {
 	return
 
 TRYMORE:
-	var mode addressingMode
-	var value []byte
-	mode, value, err = parseOperand(line)
-	if err != nil {
-		return
+	if operandErr != nil {
+		return operandErr
 	}
+	mode := addressingModes[l.Mode]
+	size := l.Size
 
 	var num uint16
 	var ref string
-	num, ref, err = parseOperandValue(value)
-
 	var refAdded *reference
+	var fix *fixup
+	var resolved bool
 
-	if ref != "" {
-		if ref[0] == '.' || ref[0] == ':' {
-			// Local label
-			ref = s.CurrentLabel + ref
+	opAddress := s.Address
+
+	if len(l.Args) > 0 {
+		e := s.expression(l.Args[0])
+		var ev evaluation
+		if ev, err = s.evaluate(e); err != nil {
+			return
 		}
 
-		if def, ok := s.Constants[ref]; ok {
-			num += def
-		} else if refAddr, ok := s.Labels[ref]; ok {
-			num += refAddr
-		} else {
-			if mode == immediate && ref[0] != '<' && ref[0] != '>' {
+		num, ref = ev.selected(), ev.Ref
+		if ref != "" && ev.Selector != 0 {
+			ref = string(ev.Selector) + ref
+		}
+
+		switch {
+		case ev.Undefined != "" && ev.Undefined != ev.Ref:
+			// Written once every label is defined, as data is.
+			fix = &fixup{Address: s.Address + 1, Expr: e, File: s.File, LineNumber: s.LineNumber}
+			num = 0
+
+		case s.isExternal(ref):
+			// The linker supplies the value, so keep only the offset and
+			// never assume zero page.
+			refAdded = &reference{Address: s.Address + 1}
+
+		case ev.Undefined != "" || ev.Ref == "*" || (ref != "" && ev.Selector != 0):
+			// A label not defined yet, *, or a byte of a label: finish adds
+			// the label to the offset.
+			num = ev.Offset
+			refAdded = &reference{
+				Address:    s.Address + 1,
+				ZeroPage:   mode == indexedIndirect || mode == indirectIndex,
+				File:       s.File,
+				LineNumber: s.LineNumber,
+			}
+			if mode == immediate && ev.Selector == 0 {
 				// Handle "LDA #ENTRY" as if it were "LDA #<ENTRY"
 				ref = "<" + ref
+				refAdded.Implied = true
 			}
-			refAdded = &reference{s.Address + 1, false}
 			s.References[ref] = append(s.References[ref], refAdded)
+
+		case ref != "":
+			_, resolved = s.Labels[ref]
+		}
+	}
+
+	if refAdded == nil && fix == nil {
+		if err = s.checkOperand(mode, num); err != nil {
+			return
 		}
 	}
 
+	zeroPage := num <= 0xFF && refAdded == nil && fix == nil
+	switch size {
+	case syntax.Absolute:
+		zeroPage = false
+	case syntax.ZeroPage:
+		if s.isExternal(ref) {
+			err = fmt.Errorf("cannot force zero page for external label: %s", ref)
+			return
+		}
+		if refAdded == nil && num > 0xFF {
+			err = fmt.Errorf("$%04X does not fit in zero page", num)
+			return
+		}
+		if refAdded != nil {
+			refAdded.ZeroPage = true
+		}
+		zeroPage = true
+	}
+
 	switch mneumonic {
 	case "LDA":
 		switch mode {
@@ -553,7 +698,7 @@ TRYMORE:
 			s.write(0xB1)
 			s.writeShort(num)
 		case absoluteX:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page,X
 				s.write(0xB5)
 				s.writeShort(num)
@@ -567,7 +712,7 @@ TRYMORE:
 			s.write(0xB9)
 			s.writeNumber(num)
 		case absolute:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page
 				s.write(0xA5)
 				s.writeShort(num)
@@ -590,7 +735,7 @@ TRYMORE:
 			s.write(0x91)
 			s.writeShort(num)
 		case absoluteX:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page,X
 				s.write(0x95)
 				s.writeShort(num)
@@ -604,7 +749,7 @@ TRYMORE:
 			s.write(0x99)
 			s.writeNumber(num)
 		case absolute:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page
 				s.write(0x85)
 				s.writeShort(num)
@@ -621,7 +766,7 @@ TRYMORE:
 	case "DEC":
 		switch mode {
 		case absoluteX:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page,X
 				s.write(0xD6)
 				s.writeShort(num)
@@ -631,7 +776,7 @@ TRYMORE:
 			s.write(0xDE)
 			s.writeNumber(num)
 		case absolute:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page
 				s.write(0xC6)
 				s.writeShort(num)
@@ -648,7 +793,7 @@ TRYMORE:
 	case "INC":
 		switch mode {
 		case absoluteX:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page,X
 				s.write(0xF6)
 				s.writeShort(num)
@@ -658,7 +803,7 @@ TRYMORE:
 			s.write(0xFE)
 			s.writeNumber(num)
 		case absolute:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page
 				s.write(0xE6)
 				s.writeShort(num)
@@ -678,7 +823,7 @@ TRYMORE:
 			s.write(0xA2)
 			s.writeShort(num)
 		case absoluteY:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				s.write(0xB6)
 				s.writeShort(num)
 				break
@@ -686,7 +831,7 @@ TRYMORE:
 			s.write(0xBE)
 			s.writeNumber(num)
 		case absolute:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page
 				s.write(0xA6)
 				s.writeShort(num)
@@ -703,7 +848,7 @@ TRYMORE:
 	case "STX":
 		switch mode {
 		case absolute:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page
 				s.write(0x86)
 				s.writeShort(num)
@@ -714,7 +859,7 @@ TRYMORE:
 			s.writeNumber(num)
 
 		case absoluteY:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				s.write(0x96)
 				s.writeShort(num)
 				break
@@ -732,7 +877,7 @@ TRYMORE:
 			s.write(0xA0)
 			s.writeShort(num)
 		case absoluteX:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				s.write(0xB4)
 				s.writeShort(num)
 				break
@@ -740,7 +885,7 @@ TRYMORE:
 			s.write(0xBC)
 			s.writeNumber(num)
 		case absolute:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page
 				s.write(0xA4)
 				s.writeShort(num)
@@ -757,7 +902,7 @@ TRYMORE:
 	case "STY":
 		switch mode {
 		case absolute:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page
 				s.write(0x84)
 				s.writeShort(num)
@@ -768,7 +913,7 @@ TRYMORE:
 			s.writeNumber(num)
 
 		case absoluteX:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				s.write(0x94)
 				s.writeShort(num)
 				break
@@ -788,6 +933,11 @@ TRYMORE:
 		case indirect:
 			s.write(0x6C)
 			s.writeNumber(num)
+			if refAdded != nil {
+				refAdded.Indirect = true
+			} else {
+				s.checkIndirectJMP(Position{s.File, s.LineNumber}, num)
+			}
 		default:
 			err = fmt.Errorf("invalid mode for %s: %v", mneumonic, mode)
 			return
@@ -806,7 +956,7 @@ TRYMORE:
 			err = fmt.Errorf("invalid mode for %s: %v", mneumonic, mode)
 			return
 		}
-		if num < 0xFF && refAdded == nil {
+		if zeroPage {
 			// Zero Page
 			s.write(0x24)
 			s.writeShort(num)
@@ -828,7 +978,7 @@ TRYMORE:
 			s.write(0x71)
 			s.writeShort(num)
 		case absoluteX:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page,X
 				s.write(0x75)
 				s.writeShort(num)
@@ -842,7 +992,7 @@ TRYMORE:
 			s.write(0x79)
 			s.writeNumber(num)
 		case absolute:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page
 				s.write(0x65)
 				s.writeShort(num)
@@ -868,7 +1018,7 @@ TRYMORE:
 			s.write(0xF1)
 			s.writeShort(num)
 		case absoluteX:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page,X
 				s.write(0xF5)
 				s.writeShort(num)
@@ -882,7 +1032,7 @@ TRYMORE:
 			s.write(0xF9)
 			s.writeNumber(num)
 		case absolute:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page
 				s.write(0xE5)
 				s.writeShort(num)
@@ -908,7 +1058,7 @@ TRYMORE:
 			s.write(0x51)
 			s.writeShort(num)
 		case absoluteX:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page,X
 				s.write(0x55)
 				s.writeShort(num)
@@ -922,7 +1072,7 @@ TRYMORE:
 			s.write(0x59)
 			s.writeNumber(num)
 		case absolute:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page
 				s.write(0x45)
 				s.writeShort(num)
@@ -948,7 +1098,7 @@ TRYMORE:
 			s.write(0x11)
 			s.writeShort(num)
 		case absoluteX:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page,X
 				s.write(0x15)
 				s.writeShort(num)
@@ -962,7 +1112,7 @@ TRYMORE:
 			s.write(0x19)
 			s.writeNumber(num)
 		case absolute:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page
 				s.write(0x05)
 				s.writeShort(num)
@@ -988,7 +1138,7 @@ TRYMORE:
 			s.write(0x31)
 			s.writeShort(num)
 		case absoluteX:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page,X
 				s.write(0x35)
 				s.writeShort(num)
@@ -1002,7 +1152,7 @@ TRYMORE:
 			s.write(0x39)
 			s.writeNumber(num)
 		case absolute:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page
 				s.write(0x25)
 				s.writeShort(num)
@@ -1028,7 +1178,7 @@ TRYMORE:
 			s.write(0xD1)
 			s.writeShort(num)
 		case absoluteX:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page,X
 				s.write(0xD5)
 				s.writeShort(num)
@@ -1042,7 +1192,7 @@ TRYMORE:
 			s.write(0xD9)
 			s.writeNumber(num)
 		case absolute:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page
 				s.write(0xC5)
 				s.writeShort(num)
@@ -1062,7 +1212,7 @@ TRYMORE:
 			s.write(0xE0)
 			s.writeShort(num)
 		case absolute:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page
 				s.write(0xE4)
 				s.writeShort(num)
@@ -1082,7 +1232,7 @@ TRYMORE:
 			s.write(0xC0)
 			s.writeShort(num)
 		case absolute:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page
 				s.write(0xC4)
 				s.writeShort(num)
@@ -1101,7 +1251,7 @@ TRYMORE:
 		case implied:
 			s.write(0x0A)
 		case absoluteX:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page,X
 				s.write(0x16)
 				s.writeShort(num)
@@ -1111,7 +1261,7 @@ TRYMORE:
 			s.write(0x1E)
 			s.writeNumber(num)
 		case absolute:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page
 				s.write(0x06)
 				s.writeShort(num)
@@ -1130,7 +1280,7 @@ TRYMORE:
 		case implied:
 			s.write(0x2A)
 		case absoluteX:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page,X
 				s.write(0x36)
 				s.writeShort(num)
@@ -1140,7 +1290,7 @@ TRYMORE:
 			s.write(0x3E)
 			s.writeNumber(num)
 		case absolute:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page
 				s.write(0x26)
 				s.writeShort(num)
@@ -1159,7 +1309,7 @@ TRYMORE:
 		case implied:
 			s.write(0x4A)
 		case absoluteX:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page,X
 				s.write(0x56)
 				s.writeShort(num)
@@ -1169,7 +1319,7 @@ TRYMORE:
 			s.write(0x5E)
 			s.writeNumber(num)
 		case absolute:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page
 				s.write(0x46)
 				s.writeShort(num)
@@ -1188,7 +1338,7 @@ TRYMORE:
 		case implied:
 			s.write(0x6A)
 		case absoluteX:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page,X
 				s.write(0x76)
 				s.writeShort(num)
@@ -1198,7 +1348,7 @@ TRYMORE:
 			s.write(0x7E)
 			s.writeNumber(num)
 		case absolute:
-			if num < 0xFF && refAdded == nil {
+			if zeroPage {
 				// Zero Page
 				s.write(0x66)
 				s.writeShort(num)
@@ -1216,13 +1366,48 @@ TRYMORE:
 		goto TRYBRANCH
 	}
 
+	if s.Address-opAddress == 2 && mode <= absoluteY {
+		if size == syntax.AnySize && ref != "" {
+			s.warn(WarnImplicitZPage, "%s ($%02X) is assembled as zero page; use z: or a: to say which", ref, num)
+		}
+	} else if size == syntax.ZeroPage {
+		err = fmt.Errorf("%s has no zero-page form for this operand", mneumonic)
+		return
+	}
+
+	if fix != nil {
+		fix.Size = int(s.Address - (opAddress + 1))
+		s.Fixups = append(s.Fixups, fix)
+	}
+
+	s.relocate(ref, opAddress+1, s.Address-(opAddress+1), num, resolved)
 	return
 
 TRYBRANCH:
+	if fix != nil {
+		err = fmt.Errorf("branch to %s needs its labels defined before it", fix.Expr.X)
+		return
+	}
+	if s.isExternal(ref) {
+		err = fmt.Errorf("cannot branch to external label: %s", ref)
+		return
+	}
+
 	if refAdded != nil {
 		refAdded.Relative = true
 	} else {
+		target := num
 		num -= (s.Address + 2)
+		offset := int16(num)
+		if offset < -128 || offset > 127 {
+			err = fmt.Errorf("branch to $%04X is out of range (%d bytes away)", target, offset)
+			return
+		}
+		name := ref
+		if name == "" {
+			name = fmt.Sprintf("$%04X", target)
+		}
+		s.checkBranch(Position{s.File, s.LineNumber}, name, int(offset))
 	}
 
 	switch mneumonic {
@@ -1252,183 +1437,107 @@ TRYBRANCH:
 	return
 }
 
-func parseOperand(text []byte) (mode addressingMode, val []byte, err error) {
-	var i int
-
-	if len(text) == 0 || text[0] == ' ' || text[0] == ';' || string(text) == "A" {
-		mode = implied
-		return
-	}
-
-	if text[0] == '#' {
-		mode = immediate
-		for i = 1; i < len(text); i++ {
-			if text[i] == ' ' {
-				break
-			}
+// checkOperand checks that the value of an operand fits its addressing mode.
+// The indirect modes need a zero-page address. Immediate values larger than a
+// byte are truncated, with a warning, unless < or > picks the byte.
+func (s *state) checkOperand(mode addressingMode, num uint16) error {
+	switch mode {
+	case immediate:
+		if num > 0xFF {
+			s.warn(WarnTruncation, "immediate value $%04X is truncated to $%02X; use < or > to pick a byte", num, byte(num))
+		}
+	case indexedIndirect, indirectIndex:
+		if num > 0xFF {
+			return fmt.Errorf("$%04X is not a zero-page address", num)
 		}
-		val = text[1:i]
-		return
 	}
+	return nil
+}
 
-	if text[0] != '(' {
-		for i = 0; i < len(text); i++ {
-			ch := text[i]
+// addressingModes are the addressing modes of each way an operand is written.
+var addressingModes = map[syntax.Mode]addressingMode{
+	syntax.NoOperand:   implied,
+	syntax.Accumulator: implied,
+	syntax.Immediate:   immediate,
+	syntax.Direct:      absolute,
+	syntax.DirectX:     absoluteX,
+	syntax.DirectY:     absoluteY,
+	syntax.Indirect:    indirect,
+	syntax.IndirectX:   indexedIndirect,
+	syntax.IndirectY:   indirectIndex,
+}
 
-			if ch == ' ' {
-				break
-			}
+// error returns err as an *Error on the current line.
+func (s *state) error(err error) error {
+	return s.errorAt(Position{s.File, s.LineNumber}, err)
+}
 
-			if ch == ',' {
-				switch text[i+1] {
-				case 'X':
-					mode = absoluteX
-				case 'Y':
-					mode = absoluteY
-				default:
-					err = fmt.Errorf("invalid character after comma")
-				}
-				break
-			}
-		}
-		val = text[0:i]
+func (s *state) errorf(format string, a ...interface{}) error {
+	return s.error(fmt.Errorf(format, a...))
+}
 
+// closeSegment records the bytes assembled since the last ORG, if any.
+func (s *state) closeSegment() {
+	if s.end() == int(s.Origin) {
 		return
 	}
 
-	// text[0] == '('
-	for i = 1; i < len(text); i++ {
-		ch := text[i]
-		if ch == ')' {
-			val = text[1:i]
-			mode = indirect
-
-			if i+1 == len(text) || text[i+1] == ' ' {
-				return
-			}
-
-			if i+2 >= len(text) || text[i+1] != ',' || text[i+2] != 'Y' {
-				err = fmt.Errorf("expected ),Y")
-				return
-			}
+	s.Segments = append(s.Segments, span{s.Origin, s.end(), s.OriginLine})
+}
 
-			mode = indirectIndex
-			return
-		}
-
-		if ch == ',' {
-			if i+2 >= len(text) || text[i+1] != 'X' || text[i+2] != ')' {
-				err = fmt.Errorf("expected ,X)")
-				return
-			}
-
-			val = text[1:i]
-			mode = indexedIndirect
-
-			return
+// checkOverlaps returns an error if any two segments share an address.
+func (s *state) checkOverlaps() error {
+	sorted := make([]span, len(s.Segments))
+	copy(sorted, s.Segments)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+
+	for i := 1; i < len(sorted); i++ {
+		prev, next := sorted[i-1], sorted[i]
+		if int(next.Start) < prev.End {
+			return s.errorAt(Position{"", next.LineNumber}, fmt.Errorf(
+				"segment $%04X-$%04X overlaps segment $%04X-$%04X from line %d",
+				next.Start, next.End-1, prev.Start, prev.End-1, prev.LineNumber))
 		}
 	}
 
-	err = fmt.Errorf("missing rparen")
-	return
+	return nil
 }
 
-func parseOperandValue(val []byte) (num uint16, ref string, err error) {
-	if len(val) == 0 {
+func (s *state) write(b byte) {
+	if s.Dummy != nil {
+		// Only reserve the space.
+		s.Address++
 		return
 	}
 
-	end := len(val)
-	isLiteral := false
-	if end >= 3 {
-		isLiteral = (val[0] == '"' && val[2] == '"') || (val[0] == '\'' && val[2] == '\'')
-		if isLiteral {
-			end = 3
-		}
-	}
-
-	if !isLiteral {
-		for i, ch := range val {
-			if ch == '-' || ch == '+' || ch == ' ' {
-				end = i
-				break
-			}
-		}
-	}
-
-	if isLetter(val[0]) || val[0] == '<' || val[0] == '>' {
-		ref = string(val[0:end])
-	} else if (val[0] == '.' || val[0] == ':') && len(val) > 1 {
-		ref = string(val[0:end])
-	} else if val[0] == '*' {
-		ref = string(val[0])
-	} else {
-		num, _, err = readNumber(val[0:end])
-		if err != nil {
-			return
-		}
-	}
-
-	val = val[end:]
-
-	// According to the Merlin manual, the "assembler supports four arithmetic
-	// operations: +, -, /, and *." "All ... operations are done from left to
-	// right (2+3*5 would assemble as 25 and not 17)."
-	for len(val) > 0 {
-		var num2 uint16
-		switch val[0] {
-		case ' ':
-			// Assume the rest of the line is a comment.
-			return
-		case '+':
-			num2, val, err = readNumber(val[1:])
-			if err != nil {
-				return
-			}
-			num += num2
-		case '-':
-			num2, val, err = readNumber(val[1:])
-			if err != nil {
-				return
-			}
-			num -= num2
-		case '*':
-			num2, val, err = readNumber(val[1:])
-			if err != nil {
-				return
-			}
-			num *= num2
-		case '/':
-			num2, val, err = readNumber(val[1:])
-			if err != nil {
-				return
-			}
-			num /= num2
-		default:
-			err = fmt.Errorf("invalid arithmetic operator: %c", val[0])
-			return
-		}
+	if s.Top {
+		s.Wrapped = true
+		return
 	}
 
-	return
+	s.Memory[s.Address] = b
+	s.Address++
+	s.Written++
+	s.Top = s.Address == 0
 }
 
-func (s *state) error(err error) error {
-	if err == nil {
-		return nil
+// end returns the address after the last byte written, which is $10000 once
+// the top of memory is reached.
+func (s *state) end() int {
+	if s.Top {
+		return len(s.Memory)
 	}
-
-	return fmt.Errorf("line %d - %s", s.LineNumber, err.Error())
+	return int(s.Address)
 }
 
-func (s *state) errorf(format string, a ...interface{}) error {
-	return s.error(fmt.Errorf(format, a...))
-}
-
-func (s *state) write(b byte) {
-	s.Memory[s.Address] = b
-	s.Address++
-	s.Written++
+// room returns an error unless size more bytes fit below the top of memory.
+func (s *state) room(size int) error {
+	if s.end()+size > len(s.Memory) {
+		return fmt.Errorf("code wraps around past $FFFF")
+	}
+	return nil
 }
 
 func (s *state) writeShort(num uint16) {
@@ -1436,7 +1545,12 @@ func (s *state) writeShort(num uint16) {
 }
 
 func (s *state) writeNumber(num uint16) {
-	binary.LittleEndian.PutUint16(s.Memory[s.Address:], num)
-	s.Address += 2
-	s.Written += 2
+	s.write(byte(num))
+	s.write(byte(num >> 8))
+}
+
+// writeData writes the value of x as size bytes (1 or 2), leaving labels
+// that are not yet defined to be filled in at the end.
+func (s *state) writeData(x syntax.Expr, size int) error {
+	return s.writeExpression(s.expression(x), size, false)
 }
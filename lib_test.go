@@ -3,8 +3,11 @@ package a2asm
 import (
 	"bufio"
 	"bytes"
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/taeber/a2asm/syntax"
 )
 
 // Modes:
@@ -161,82 +164,107 @@ func TestRTS(t *testing.T) {
 }
 
 func TestParseOperand(t *testing.T) {
-	var mode addressingMode
-	var val []byte
-	var err error
+	tests := []struct {
+		operand string
+		mode    addressingMode
+		value   string
+	}{
+		{"042", absolute, "042"},
+		{"BELL  Jumps to BELL", absolute, "BELL"},
+		{"BELL+1  COMMENT", absolute, "BELL+1"},
+		{"$1234,X", absoluteX, "$1234"},
+		{"#1234  This is a comment", immediate, "1234"},
+		{"($4321)", indirect, "$4321"},
+		{"($40,X)", indexedIndirect, "$40"},
+		{"($40),Y", indirectIndex, "$40"},
+		{"#$12", immediate, "$12"},
+	}
 
-	check := func(expMode addressingMode, expVal string) {
+	for _, test := range tests {
+		l, err := syntax.ParseLine(1, " LDA "+test.operand)
 		if err != nil {
 			t.Error(err)
-			return
+			continue
 		}
-
-		if mode != expMode {
-			t.Errorf("Wrong mode. Expected %v; got %v", expMode, mode)
-			return
+		if mode := addressingModes[l.Mode]; mode != test.mode {
+			t.Errorf("Wrong mode for %s. Expected %v; got %v", test.operand, test.mode, mode)
 		}
-
-		if string(val) != expVal {
-			t.Errorf("wrong value. Expected %s; got %s", expVal, val)
-			return
+		if len(l.Args) != 1 || l.Args[0].String() != test.value {
+			t.Errorf("Wrong value for %s. Expected %s; got %v", test.operand, test.value, l.Args)
 		}
 	}
-
-	mode, val, err = parseOperand([]byte("042"))
-	check(absolute, "042")
-
-	mode, val, err = parseOperand([]byte("BELL  Jumps to BELL"))
-	check(absolute, "BELL")
-
-	mode, val, err = parseOperand([]byte("BELL+1  COMMENT"))
-	check(absolute, "BELL+1")
-
-	mode, val, err = parseOperand([]byte("$1234,X"))
-	check(absoluteX, "$1234")
-
-	mode, val, err = parseOperand([]byte("#1234  This is a comment"))
-	check(immediate, "1234")
-
-	mode, val, err = parseOperand([]byte("($4321)"))
-	check(indirect, "$4321")
-
-	mode, val, err = parseOperand([]byte("($40,X)"))
-	check(indexedIndirect, "$40")
-
-	mode, val, err = parseOperand([]byte("($40),Y"))
-	check(indirectIndex, "$40")
-
-	mode, val, err = parseOperand([]byte("#$12"))
-	check(immediate, "$12")
 }
 
-func TestParseOperandValue(t *testing.T) {
-	var num uint16
-	var ref string
+func TestEvaluateOffset(t *testing.T) {
+	s := newState(strings.NewReader(""))
+	s.Labels["START"] = 0x300
+
+	tests := []struct {
+		text   string
+		offset uint16
+		ref    string
+	}{
+		{"BELL+1", 1, "BELL"},
+		{"$0000+15", 0, ""},
+		{"BELL-1", 0xFFFF, "BELL"},
+		{">START+$101", 0x101, "START"},
+		{"BELL*2", 0, ""},
+	}
 
-	check := func(expNum uint16, expRef string) {
-		if num != expNum {
-			t.Errorf("expected: %d; got %d", expNum, num)
-			return
+	for _, test := range tests {
+		x, err := syntax.ParseExpr(test.text, 1)
+		if err != nil {
+			t.Error(err)
+			continue
 		}
-
-		if string(ref) != expRef {
-			t.Errorf("expected: %s; got %s", expRef, ref)
-			return
+		ev, err := s.evaluate(s.expression(x))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if ev.Offset != test.offset || ev.Ref != test.ref {
+			t.Errorf("%s: expected %s+$%04X; got %s+$%04X", test.text, test.ref, test.offset, ev.Ref, ev.Offset)
 		}
 	}
+}
 
-	num, ref, _ = parseOperandValue([]byte("BELL+1"))
-	check(1, "BELL")
-
-	num, ref, _ = parseOperandValue([]byte("$0000+15"))
-	check(0x000F, "")
+func TestOperandExpressions(t *testing.T) {
+	actual := assembleBytes(t, `
+		ORG $300
+ZP		= $10
+LBL		= $20
+START	LDA #-1
+		LDA LBL*2
+		LDA LBL+ZP
+		LDA #<START*2
+		STA END*2
+		LDA (ZP+2),Y
+END		RTS
+`)
+
+	expected := []byte("\xA9\xFF\xA5\x40\xA5\x30\xA9\x00\x8D\x1A\x06\xB1\x12\x60")
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("Expected %x; got %x", expected, actual)
+	}
+}
 
-	num, ref, _ = parseOperandValue([]byte("BELL-1"))
-	check(0xFFFF, "BELL")
+func TestOrgExpression(t *testing.T) {
+	segments, err := AssembleSegments(strings.NewReader(`
+START	EQU $300
+		ORG START+$100
+		RTS
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 1 || segments[0].Origin != 0x400 {
+		t.Errorf("Expected one segment at $0400; got %v", segments)
+	}
 
-	num, ref, _ = parseOperandValue([]byte("$0A  ; BUFFER PTR"))
-	check(0x0A, "")
+	_, err = AssembleSegments(strings.NewReader(" ORG LATER\nLATER RTS\n"))
+	if err == nil || err.Error() != "line 1 - label must be defined before use: LATER" {
+		t.Errorf("Expected LATER to be undefined; got %v", err)
+	}
 }
 
 func TestLocalLabels(t *testing.T) {
@@ -519,3 +547,228 @@ func test(t *testing.T, assembly, expected string) {
 		return
 	}
 }
+
+func TestMultipleOrigins(t *testing.T) {
+	segments, err := AssembleSegments(strings.NewReader(`
+		ORG $300
+START	JSR NEXT
+		RTS
+		ORG $308
+NEXT	LDA #1
+		RTS
+	`))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(segments) != 2 {
+		t.Errorf("Expected 2 segments; got %d", len(segments))
+		return
+	}
+
+	if segments[0].Origin != 0x300 || segments[1].Origin != 0x308 {
+		t.Errorf("Wrong origins: $%04X, $%04X", segments[0].Origin, segments[1].Origin)
+	}
+
+	expected := []byte("\x20\x08\x03\x60")
+	if !bytes.Equal(expected, segments[0].Data) {
+		t.Errorf("Expected %v; got %v", expected, segments[0].Data)
+	}
+
+	expected = []byte("\xA9\x01\x60")
+	if !bytes.Equal(expected, segments[1].Data) {
+		t.Errorf("Expected %v; got %v", expected, segments[1].Data)
+	}
+}
+
+func TestOverlappingOrigins(t *testing.T) {
+	_, err := AssembleSegments(strings.NewReader(`
+		ORG $300
+		NOP
+		NOP
+		ORG $301
+		RTS
+	`))
+	if err == nil {
+		t.Error("Expected overlapping segments to be an error")
+	}
+}
+
+func TestTopOfMemory(t *testing.T) {
+	segments, err := AssembleSegments(strings.NewReader(`
+		ORG $FFFA
+		DA NMI,RESET,IRQ
+		ORG $F000
+NMI		RTI
+RESET	JMP RESET
+IRQ		RTI
+`))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(segments) != 2 {
+		t.Fatalf("Expected 2 segments; got %v", segments)
+	}
+
+	vectors := segments[0]
+	expected := []byte("\x00\xF0\x01\xF0\x04\xF0")
+	if vectors.Origin != 0xFFFA || !bytes.Equal(expected, vectors.Data) || vectors.End() != 0x10000 {
+		t.Errorf("Expected %x at $FFFA; got %x at $%04X", expected, vectors.Data, vectors.Origin)
+	}
+
+	out := bytes.NewBuffer(nil)
+	if _, err = WriteImage(out, segments, false); err != nil {
+		t.Error(err)
+		return
+	}
+	if out.Len() != 4+0x1000 {
+		t.Errorf("Expected a $1000-byte image from $F000; got %d bytes", out.Len()-4)
+	}
+}
+
+func TestPastTopOfMemory(t *testing.T) {
+	tests := map[string]string{
+		" ORG $FFFF\n RTS\n RTS":   "line 3 - code wraps around past $FFFF",
+		" ORG $FFFF\n DA 0":        "line 2 - code wraps around past $FFFF",
+		" ORG $FFFE\n DS 2\n DS 1": "line 3 - code wraps around past $FFFF",
+	}
+
+	for src, expected := range tests {
+		_, err := AssembleSegments(strings.NewReader(src))
+		if err == nil || err.Error() != expected {
+			t.Errorf("%q: expected %q; got %v", src, expected, err)
+		}
+	}
+
+	if _, err := AssembleSegments(strings.NewReader(" ORG $FFFE\n DS 2")); err != nil {
+		t.Errorf("Expected DS to fill up to $FFFF; got %v", err)
+	}
+}
+
+func TestZeroPageFF(t *testing.T) {
+	actual := assembleBytes(t, `
+		ORG $300
+		LDA $FF
+		STA $FF,X
+		LDA $100
+`)
+
+	expected := []byte("\xA5\xFF\x95\xFF\xAD\x00\x01")
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("Expected %x; got %x", expected, actual)
+	}
+}
+
+func TestOperandWidthErrors(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{`
+		ORG $300
+		LDA ($1234),Y
+`, "line 3 - $1234 is not a zero-page address"},
+		{`
+		ORG $300
+		LDA (PTR,X)
+PTR		RTS
+`, "line 3 - PTR ($0302) is not a zero-page address"},
+		{`
+		ORG $300
+		BNE FAR
+		DS 200
+FAR		RTS
+`, "line 3 - branch to FAR is out of range (200 bytes away)"},
+		{`
+		ORG $300
+START	DS 200
+		BNE START
+`, "line 4 - branch to $0300 is out of range (-202 bytes away)"},
+	}
+
+	for _, test := range tests {
+		_, err := AssembleSegments(strings.NewReader(test.src))
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("Expected %q; got %v", test.expected, err)
+		}
+	}
+}
+
+func TestImmediateTruncation(t *testing.T) {
+	result, err := AssembleWithOptions(strings.NewReader(`
+		ORG $300
+START	LDA #$1234
+		LDA #START
+		LDA #<START
+		LDA #>START
+		LDA #ENTRY
+ENTRY	RTS
+`), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Warning{
+		{"", 3, "immediate value $1234 is truncated to $34; use < or > to pick a byte", WarnTruncation},
+		{"", 4, "immediate value $0300 is truncated to $00; use < or > to pick a byte", WarnTruncation},
+		{"", 7, "immediate value ENTRY ($030A) is truncated to $0A; use < or > to pick a byte", WarnTruncation},
+	}
+	if !reflect.DeepEqual(expected, result.Warnings) {
+		t.Errorf("Expected %v; got %v", expected, result.Warnings)
+	}
+
+	code := []byte("\xA9\x34\xA9\x00\xA9\x00\xA9\x03\xA9\x0A\x60")
+	if !bytes.Equal(code, result.Segments[0].Data) {
+		t.Errorf("Expected %x; got %x", code, result.Segments[0].Data)
+	}
+}
+
+func TestForcedAddressSize(t *testing.T) {
+	actual := assembleBytes(t, `
+		ORG $300
+		LDA: $10
+		STA a:$10,X
+		LDX $10
+		LDY z:PTR
+		STX z:PTR,Y
+		RTS
+PTR		= $EB
+`)
+
+	expected := []byte("\xAD\x10\x00\x9D\x10\x00\xA6\x10\xA4\xEB\x96\xEB\x60")
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("Expected %x; got %x", expected, actual)
+	}
+}
+
+func TestForcedZeroPageErrors(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{" LDA z:$1234\n", "line 1 - $1234 does not fit in zero page"},
+		{" LDA z:$12,Y\n", "line 1 - LDA has no zero-page form for this operand"},
+		{" ORG $300\n LDA z:END\nEND RTS\n", "line 2 - END ($0302) is not a zero-page address"},
+	}
+
+	for _, test := range tests {
+		_, err := AssembleSegments(strings.NewReader(test.src))
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("Expected %q; got %v", test.expected, err)
+		}
+	}
+}
+
+func TestColumnsOfBlanks(t *testing.T) {
+	actual := assembleBytes(t, "         ORG   $300\n"+
+		"START    LDA   #\"A\"       ; LETTER\n"+
+		"         ASC   \"HI\"\n"+
+		"         RTS              ; DONE\n")
+	expected := []byte{0xA9, 0xC1, 0xC8, 0xC9, 0x60}
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("Expected % X; got % X", expected, actual)
+	}
+}
@@ -0,0 +1,225 @@
+package a2asm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/taeber/a2asm/syntax"
+)
+
+// defaultLinkOrigin is where the linker places code until told otherwise.
+const defaultLinkOrigin = 0x8000
+
+// LinkObjects places the relocatable objects one after another starting at
+// origin, resolves each EXTernal label against the ENTry labels of the other
+// objects and returns the linked code. Every duplicate and undefined label is
+// reported in the error.
+func LinkObjects(origin uint16, objects []*Object) (linked Segment, err error) {
+	type entry struct {
+		Value  uint16
+		Object string
+	}
+
+	var problems []string
+
+	entries := make(map[string]entry)
+	bases := make([]uint16, len(objects))
+	size := 0
+
+	for i, obj := range objects {
+		if !obj.Relocatable {
+			return linked, fmt.Errorf("%s is not relocatable; missing REL", obj.Name)
+		}
+
+		bases[i] = origin + uint16(size)
+		size += len(obj.Code())
+		if int(origin)+size > 0x10000 {
+			return linked, fmt.Errorf("%s does not fit below $FFFF", obj.Name)
+		}
+
+		names := make([]string, 0, len(obj.Entries))
+		for name := range obj.Entries {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if prev, ok := entries[name]; ok {
+				problems = append(problems, fmt.Sprintf(
+					"duplicate entry label %s in %s and %s",
+					name, prev.Object, obj.Name))
+				continue
+			}
+			entries[name] = entry{bases[i] + obj.Entries[name], obj.Name}
+		}
+	}
+
+	linked.Origin = origin
+	linked.Data = make([]byte, 0, size)
+
+	for i, obj := range objects {
+		code := append([]byte(nil), obj.Code()...)
+		delta := bases[i] - relOrigin
+
+		for _, r := range obj.Relocations {
+			if int(r.Offset) >= len(code) || (r.TwoBytes && int(r.Offset)+1 >= len(code)) {
+				return linked, fmt.Errorf("%s: relocation at offset $%04X is outside the code", obj.Name, r.Offset)
+			}
+
+			value, low := delta, r.Low
+			if r.External != "" {
+				ent, ok := entries[r.External]
+				if !ok {
+					problems = append(problems, fmt.Sprintf(
+						"undefined external label %s in %s", r.External, obj.Name))
+					continue
+				}
+				value, low = ent.Value, 0
+			}
+
+			field := code[r.Offset:]
+			switch {
+			case r.TwoBytes && r.Reversed:
+				num := binary.BigEndian.Uint16(field)
+				binary.BigEndian.PutUint16(field, num+value)
+			case r.TwoBytes:
+				num := binary.LittleEndian.Uint16(field)
+				binary.LittleEndian.PutUint16(field, num+value)
+			case r.HighByte:
+				num := uint16(field[0])<<8 | uint16(low)
+				field[0] = byte((num + value) >> 8)
+			default:
+				field[0] += byte(value)
+			}
+		}
+
+		linked.Data = append(linked.Data, code...)
+	}
+
+	if len(problems) > 0 {
+		return linked, fmt.Errorf("%s", strings.Join(problems, "\n"))
+	}
+
+	return
+}
+
+// Link runs the MERLIN linker command file read from script. Each line holds
+// one command in the opcode column:
+//
+//	ORG addr   where the next linked file will start (default $8000)
+//	ASM file   assemble a REL source and add it to the link
+//	LNK file   add a REL file to the link
+//	SAV file   link everything added since the last SAV and save it
+//
+// Files are read with open and the linked code is handed to save.
+func Link(script io.Reader, open Opener, save func(name string, linked Segment) error) error {
+	s := state{Reader: bufio.NewReader(script)}
+
+	origin := uint16(defaultLinkOrigin)
+	var objects []*Object
+
+	for {
+		line, isPrefix, err := s.Reader.ReadLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		s.LineNumber++
+
+		if isPrefix {
+			return fmt.Errorf("line %d is too long", s.LineNumber)
+		}
+
+		fields := syntax.SplitLine(int(s.LineNumber), string(line))
+		if fields.IsComment() || fields.Opcode.Text == "" {
+			continue
+		}
+
+		command := fields.Mnemonic()
+		arg := fields.Operand.Text
+		if i := strings.IndexAny(arg, " \t"); i >= 0 {
+			arg = arg[:i]
+		}
+
+		switch command {
+		case "ORG":
+			if len(arg) == 0 {
+				return s.errorf("ORG needs an address")
+			}
+			x, err := syntax.ParseExpr(arg, fields.Operand.Pos)
+			if err != nil {
+				return s.error(err)
+			}
+			num, ok := x.(*syntax.Number)
+			if !ok {
+				return s.errorf("ORG needs a number; got %s", arg)
+			}
+			origin = num.Value
+
+		case "ASM", "LNK":
+			if arg == "" {
+				return s.errorf("%s needs a file name", command)
+			}
+
+			obj, err := loadObject(command, arg, open)
+			if err != nil {
+				return s.error(err)
+			}
+			objects = append(objects, obj)
+
+		case "SAV":
+			if arg == "" {
+				return s.errorf("SAV needs a file name")
+			}
+
+			linked, err := LinkObjects(origin, objects)
+			if err != nil {
+				return s.error(err)
+			}
+			if err = save(arg, linked); err != nil {
+				return s.error(err)
+			}
+			objects = nil
+
+		default:
+			return s.errorf(`unknown linker command: "%s"`, command)
+		}
+	}
+
+	if len(objects) > 0 {
+		return fmt.Errorf("files linked but never saved; missing SAV")
+	}
+
+	return nil
+}
+
+// loadObject assembles (ASM) or reads (LNK) the named file.
+func loadObject(command, name string, open Opener) (obj *Object, err error) {
+	if command == "ASM" {
+		obj, err = AssembleFile(name, open)
+	} else {
+		var fp io.ReadCloser
+		if fp, err = open(name); err != nil {
+			return
+		}
+		obj, err = ReadObject(fp)
+		fp.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	obj.Name = name
+	if !obj.Relocatable {
+		return nil, fmt.Errorf("%s is not relocatable; missing REL", name)
+	}
+
+	return
+}
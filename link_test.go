@@ -0,0 +1,116 @@
+package a2asm
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func assembleREL(t *testing.T, name, src string) *Object {
+	obj, err := AssembleObject(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj.Name = name
+	return obj
+}
+
+func TestLinkObjects(t *testing.T) {
+	main := assembleREL(t, "MAIN", `
+		REL
+PRINT	EXT
+		LDA #>MSG
+		JSR PRINT
+		RTS
+MSG		HEX 00
+	`)
+	printer := assembleREL(t, "PRINT", `
+		REL
+PRINT	ENT
+		JMP PRINT
+	`)
+
+	linked, err := LinkObjects(0x300, []*Object{main, printer})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := []byte("\xA9\x03\x20\x07\x03\x60\x00\x4C\x07\x03")
+	if linked.Origin != 0x300 || !bytes.Equal(expected, linked.Data) {
+		t.Errorf("Expected %v; got $%04X %v", expected, linked.Origin, linked.Data)
+	}
+}
+
+func TestLinkErrors(t *testing.T) {
+	a := assembleREL(t, "A", `
+		REL
+MISSING	EXT
+DUP		ENT
+		JMP MISSING
+	`)
+	b := assembleREL(t, "B", `
+		REL
+DUP		ENT
+		RTS
+	`)
+
+	_, err := LinkObjects(0x300, []*Object{a, b})
+	if err == nil {
+		t.Error("Expected duplicate and undefined labels to be errors")
+		return
+	}
+
+	for _, msg := range []string{"duplicate entry label DUP in A and B", "undefined external label MISSING in A"} {
+		if !strings.Contains(err.Error(), msg) {
+			t.Errorf("Expected %q in %q", msg, err)
+		}
+	}
+}
+
+func TestLink(t *testing.T) {
+	files := map[string]string{
+		"MAIN.S": `
+		REL
+DONE	EXT
+		JMP DONE
+`,
+		"DONE.S": `
+		REL
+DONE	ENT
+		RTS
+`,
+	}
+
+	open := func(name string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(files[name])), nil
+	}
+
+	var saved Segment
+	save := func(name string, linked Segment) error {
+		if name != "PROG" {
+			t.Errorf("Expected PROG; got %s", name)
+		}
+		saved = linked
+		return nil
+	}
+
+	err := Link(strings.NewReader(`
+* Link the program
+		ORG $800
+		ASM MAIN.S
+		ASM DONE.S
+		SAV PROG
+`), open, save)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := []byte("\x4C\x03\x08\x60")
+	if saved.Origin != 0x800 || !bytes.Equal(expected, saved.Data) {
+		t.Errorf("Expected %v; got $%04X %v", expected, saved.Origin, saved.Data)
+	}
+}
@@ -0,0 +1,340 @@
+// Package lint looks for common mistakes in 6502 programs: code that is
+// legal, and assembles, but probably does not do what was meant.
+//
+// Check works on an assembled program, so that it knows the value of every
+// symbol and which lines became code, and parses each line with the syntax
+// package. A comment of the form "; a2asm:ignore NAME" turns a rule off for
+// its line, as it does for the assembler's warnings.
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/taeber/a2asm"
+	"github.com/taeber/a2asm/syntax"
+)
+
+// Rule is a kind of mistake that Check looks for.
+type Rule struct {
+	Name        string
+	Description string
+}
+
+// Rule names
+const (
+	ADCCarry      = "adc-carry"
+	SBCCarry      = "sbc-carry"
+	JMPIndirect   = a2asm.WarnJMPIndirectBug
+	Unused        = "unused"
+	Unreachable   = "unreachable"
+	TailCall      = "tail-call"
+	BranchOutside = "branch-outside-routine"
+)
+
+// Rules are the rules Check applies, in the order listed by a2asm lint -help.
+var Rules = []Rule{
+	{ADCCarry, "ADC with no CLC or SEC before it in its block"},
+	{SBCCarry, "SBC with no SEC before it in its block"},
+	{JMPIndirect, "JMP ($xxFF), which the 6502 reads from the wrong page"},
+	{Unused, "labels and constants that are never referred to"},
+	{Unreachable, "code after JMP, RTS, RTI or BRA that has no label"},
+	{TailCall, "JSR followed by RTS, which could be a JMP"},
+	{BranchOutside, "branches to a label in another routine"},
+}
+
+// unconditional are the instructions that never go on to the next line. BRA
+// is the 65C02's branch always.
+var unconditional = map[string]bool{"JMP": true, "RTS": true, "RTI": true, "BRA": true}
+
+// branches are the relative branches.
+var branches = map[string]bool{
+	"BCC": true, "BCS": true, "BEQ": true, "BMI": true, "BNE": true, "BPL": true,
+	"BVC": true, "BVS": true, "BRA": true,
+}
+
+// line is a line of the program and what it assembled to.
+type line struct {
+	*syntax.Line
+	File  string // as in a Diagnostic: empty for the source itself
+	Bytes []byte
+}
+
+// isCode is whether the line is an instruction that was assembled.
+func (l *line) isCode() bool {
+	return l.Instruction != "" && len(l.Bytes) > 0
+}
+
+// target returns the label that the operand of the line names, if it is
+// only a label.
+func (l *line) target() string {
+	if len(l.Args) != 1 {
+		return ""
+	}
+	if ident, ok := l.Args[0].(*syntax.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
+
+type checker struct {
+	result *a2asm.Result
+	lines  []line
+	at     map[a2asm.Position]int // the index of the line at each position
+	found  []finding
+}
+
+// finding is a mistake on the line at index Line.
+type finding struct {
+	Line       int
+	Diagnostic a2asm.Diagnostic
+}
+
+// Check returns the mistakes found in the program that result was assembled
+// from, in the order of its lines. Local labels are only checked for use if
+// they are among the result's Symbols, as with Options.Locals, and JMP
+// indirect is only reported if the assembler's warning of that name was on.
+func Check(result *a2asm.Result) []a2asm.Diagnostic {
+	c := &checker{result: result, at: make(map[a2asm.Position]int)}
+	for i, rl := range result.Lines {
+		// The program assembled, so any error is in an operand that the
+		// syntax package reads differently; the fields are still known.
+		l, _ := syntax.ParseLine(int(rl.Number), rl.Text)
+
+		file := rl.File
+		if file == result.Name {
+			file = ""
+		}
+		c.lines = append(c.lines, line{l, file, rl.Bytes})
+		c.at[a2asm.Position{File: file, Line: rl.Number}] = i
+	}
+
+	c.checkCarry()
+	c.checkIndirectJMP()
+	c.checkUnused()
+	c.checkUnreachable()
+	c.checkTailCalls()
+	c.checkBranches()
+
+	sort.SliceStable(c.found, func(i, j int) bool {
+		return c.found[i].Line < c.found[j].Line
+	})
+
+	var diagnostics []a2asm.Diagnostic
+	for _, f := range c.found {
+		diagnostics = append(diagnostics, f.Diagnostic)
+	}
+	return diagnostics
+}
+
+// report notes a mistake on the line at index i, unless a comment turns the
+// rule off there. The columns are those of the whole statement.
+func (c *checker) report(i int, rule, format string, a ...interface{}) {
+	start, end := c.lines[i].Columns()
+	c.reportAt(i, start, end, rule, format, a...)
+}
+
+// reportAt notes a mistake between the columns of the line at index i.
+func (c *checker) reportAt(i, start, end int, rule, format string, a ...interface{}) {
+	l := c.lines[i]
+	if a2asm.IsIgnored(l.Comment.Text, rule) {
+		return
+	}
+
+	c.found = append(c.found, finding{i, a2asm.Diagnostic{
+		File:      l.File,
+		Line:      uint(l.Number),
+		Column:    start,
+		EndColumn: end,
+		Severity:  "warning",
+		Rule:      rule,
+		Message:   fmt.Sprintf(format, a...),
+	}})
+}
+
+// checkCarry reports ADC and SBC that use whatever the carry happens to be.
+// A block starts at each label, where the code may be entered from
+// anywhere, and after each JSR, which may leave the carry either way.
+func (c *checker) checkCarry() {
+	var clc, sec bool
+	for i, l := range c.lines {
+		if l.Label.Text != "" || l.Mnemonic() == "ORG" {
+			clc, sec = false, false
+		}
+		if !l.isCode() {
+			continue
+		}
+
+		switch l.Instruction {
+		case "CLC":
+			clc = true
+		case "SEC":
+			sec = true
+		case "JSR":
+			clc, sec = false, false
+		case "ADC":
+			if !clc && !sec {
+				c.report(i, ADCCarry, "ADC without CLC or SEC before it adds the carry left by earlier code")
+			}
+		case "SBC":
+			if !sec {
+				c.report(i, SBCCarry, "SBC without SEC before it subtracts the borrow left by earlier code")
+			}
+		}
+	}
+}
+
+// checkIndirectJMP reports the assembler's warnings about JMP (addr) where
+// addr is the last byte of a page, which the NMOS 6502 reads from the wrong
+// page.
+func (c *checker) checkIndirectJMP() {
+	for _, w := range c.result.Warnings {
+		if w.Category != JMPIndirect {
+			continue
+		}
+		if i, ok := c.at[a2asm.Position{File: w.File, Line: w.Line}]; ok {
+			c.report(i, JMPIndirect, "%s", w.Message)
+		}
+	}
+}
+
+// checkUnused reports the labels and constants that nothing refers to.
+// Entry points are not reported: ENT labels and those at the start of a
+// segment, where the program is run from. Neither are variables, nor the
+// constants of PUT and USE files, which often name every ROM routine.
+func (c *checker) checkUnused() {
+	starts := make(map[uint16]bool)
+	for _, seg := range c.result.Segments {
+		starts[seg.Origin] = true
+	}
+
+	for _, sym := range c.result.Symbols {
+		if len(sym.References) > 0 || sym.Kind == a2asm.ExternalSymbol || strings.HasPrefix(sym.Name, "]") {
+			continue
+		}
+		if _, ok := c.result.Entries[sym.Name]; ok {
+			continue
+		}
+		if sym.Kind == a2asm.LabelSymbol && starts[sym.Value] {
+			continue
+		}
+		if sym.Kind == a2asm.ConstantSymbol && sym.Defined.File != "" {
+			continue
+		}
+
+		i, ok := c.at[sym.Defined]
+		if !ok {
+			continue
+		}
+		label := c.lines[i].Label
+		c.reportAt(i, label.Pos, label.Pos+len(label.Text), Unused, "%s %s is never used", sym.Kind, sym.Name)
+	}
+}
+
+// checkUnreachable reports the first instruction after an unconditional
+// jump, return or branch that nothing can reach, having no label.
+func (c *checker) checkUnreachable() {
+	var after string
+	for i, l := range c.lines {
+		if l.Label.Text != "" || l.Mnemonic() == "ORG" {
+			after = ""
+		}
+		if !l.isCode() {
+			continue
+		}
+
+		if after != "" {
+			c.report(i, Unreachable, "unreachable code after %s", after)
+			after = ""
+			continue
+		}
+		if unconditional[l.Instruction] {
+			after = l.Instruction
+		}
+	}
+}
+
+// checkTailCalls reports a JSR followed by an RTS that nothing else
+// reaches: JMP does the same, in fewer bytes and cycles.
+func (c *checker) checkTailCalls() {
+	for i, l := range c.lines {
+		if l.Instruction != "JSR" || !l.isCode() {
+			continue
+		}
+
+		next, ok := c.next(i)
+		if ok && c.lines[next].Instruction == "RTS" && c.lines[next].Label.Text == "" {
+			c.report(i, TailCall, "JSR %s followed by RTS can be JMP %s", l.Operand.Text, l.Operand.Text)
+		}
+	}
+}
+
+// next returns the index of the statement after the line at index i,
+// skipping blank lines and comments.
+func (c *checker) next(i int) (int, bool) {
+	for i++; i < len(c.lines); i++ {
+		if !c.lines[i].IsComment() {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// checkBranches reports branches to a global label in another routine. A
+// routine starts at each label that is called with JSR, or is an entry
+// point, and runs to the start of the next one.
+func (c *checker) checkBranches() {
+	starts := make(map[string]bool)
+	for _, l := range c.lines {
+		if name := l.target(); l.Instruction == "JSR" && name != "" {
+			starts[name] = true
+		}
+	}
+	for name := range c.result.Entries {
+		starts[name] = true
+	}
+
+	// routines holds the routine each line is in.
+	routines := make([]string, len(c.lines))
+	var routine string
+	for i, l := range c.lines {
+		if starts[l.Label.Text] {
+			routine = l.Label.Text
+		}
+		routines[i] = routine
+	}
+
+	defined := make(map[string]a2asm.Position)
+	for _, sym := range c.result.Symbols {
+		if sym.Scope == "" {
+			defined[sym.Name] = sym.Defined
+		}
+	}
+
+	for i, l := range c.lines {
+		if !branches[l.Instruction] || !l.isCode() {
+			continue
+		}
+
+		name := l.target()
+		if name == "" || strings.ContainsRune(":.]", rune(name[0])) {
+			// Local labels and variables belong to where they are used.
+			continue
+		}
+		pos, ok := defined[name]
+		if !ok {
+			continue
+		}
+		j, ok := c.at[pos]
+		if !ok || routines[j] == routines[i] {
+			continue
+		}
+
+		if routines[i] == "" {
+			c.report(i, BranchOutside, "branch to %s, in the routine %s", name, routines[j])
+		} else {
+			c.report(i, BranchOutside, "branch to %s leaves the routine %s", name, routines[i])
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package lint
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/taeber/a2asm"
+)
+
+// check assembles src, with the PUT files in files, and returns what Check
+// finds as "LINE RULE" or "FILE:LINE RULE".
+func check(t *testing.T, src string, files map[string]string) []string {
+	t.Helper()
+
+	result, err := a2asm.AssembleWithOptions(strings.NewReader(src), a2asm.Options{
+		Name: "MAIN",
+		Open: func(name string) (io.ReadCloser, error) {
+			text, ok := files[name]
+			if !ok {
+				return nil, fmt.Errorf("no file %s", name)
+			}
+			return ioutil.NopCloser(strings.NewReader(text)), nil
+		},
+		Locals: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found []string
+	for _, d := range Check(result) {
+		pos := fmt.Sprint(d.Line)
+		if d.File != "" {
+			pos = d.File + ":" + pos
+		}
+		found = append(found, pos+" "+d.Rule)
+	}
+	return found
+}
+
+func TestCarry(t *testing.T) {
+	found := check(t, `
+		ORG $300
+START	CLC
+		LDA $06
+		ADC #1
+		STA $06
+		LDA $07
+		ADC #0		; the carry from the low byte
+		STA $07
+		JSR $FDED
+		ADC #1
+		SEC
+		SBC #1
+ADD		ADC #1
+		CLC
+		SBC #1
+		RTS
+`, nil)
+
+	expected := []string{"11 adc-carry", "14 adc-carry", "14 unused", "16 sbc-carry"}
+	if !reflect.DeepEqual(expected, found) {
+		t.Errorf("Expected %v; got %v", expected, found)
+	}
+}
+
+func TestControlFlow(t *testing.T) {
+	found := check(t, `
+		ORG $300
+START	JSR PRINT
+		JMP (VECTOR)
+		LDA #0
+		JSR PRINT
+		RTS
+PRINT	LDA $06
+		BEQ DONE
+		BNE START
+:LOOP	JSR $FDED
+		RTS
+
+DONE	RTS
+		DS $3FF-*
+VECTOR	DA START
+`, nil)
+
+	expected := []string{
+		"4 jmp-indirect-page-bug",
+		"5 unreachable",
+		"6 tail-call",
+		"10 branch-outside-routine",
+		"11 unused",
+		"11 tail-call",
+	}
+	if !reflect.DeepEqual(expected, found) {
+		t.Errorf("Expected %v; got %v", expected, found)
+	}
+}
+
+func TestUnused(t *testing.T) {
+	found := check(t, `
+		PUT ROM
+		ORG $300
+START	LDA #>MSG
+		LDX #0
+]COUNT	= 3
+LIMIT	= 40
+		RTS
+MSG		ASC "HI"
+OLD		DFB 0
+		PUT LIB
+`, map[string]string{
+		"ROM": "COUT	= $FDED\nHOME	= $FC58\n",
+		"LIB": "HELPER	RTS\n",
+	})
+
+	expected := []string{"7 unused", "10 unused", "LIB:1 unused"}
+	if !reflect.DeepEqual(expected, found) {
+		t.Errorf("Expected %v; got %v", expected, found)
+	}
+}
+
+func TestIgnore(t *testing.T) {
+	found := check(t, `
+		ORG $300
+START	ADC #1		; a2asm:ignore adc-carry
+		ADC #1		; a2asm:ignore unused, adc-carry
+		SBC #1		; a2asm:ignore
+		SBC #1		; a2asm:ignore adc-carry
+		RTS
+`, nil)
+
+	expected := []string{"6 sbc-carry"}
+	if !reflect.DeepEqual(expected, found) {
+		t.Errorf("Expected %v; got %v", expected, found)
+	}
+}
+
+func TestDiagnostic(t *testing.T) {
+	result, err := a2asm.AssembleWithOptions(strings.NewReader(" ORG $300\nSTART JSR $FDED ; print\n RTS\n"), a2asm.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []a2asm.Diagnostic{
+		{Line: 2, Column: 1, EndColumn: 16, Severity: "warning", Rule: TailCall, Message: "JSR $FDED followed by RTS can be JMP $FDED"},
+	}
+	if found := Check(result); !reflect.DeepEqual(expected, found) {
+		t.Errorf("Expected %v; got %v", expected, found)
+	}
+}
@@ -0,0 +1,229 @@
+// Package listing reads the listings MERLIN prints while assembling, and
+// compares them with what a2asm assembles from the same source.
+//
+// Two kinds of lines carry object code. Assembler listing lines give the
+// address, up to three bytes, the line number and the source line:
+//
+//	0300: A9 C1    3  START    LDA   #"A"
+//	0302: 20 ED FD 4           JSR   $FDED
+//	0305: C8 C5 CC
+//
+// where a line without a line number continues the bytes of the one before
+// it. Monitor dump lines give the address and up to 16 bytes, with ".."
+// where nothing was assembled:
+//
+//	$0300: A9 C1 20 ED FD .. .. .. .. .. .. .. .. .. .. ..
+//
+// All other lines, such as headers and symbol tables, are ignored.
+package listing
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/taeber/a2asm"
+)
+
+const (
+	// bytesColumn is where the bytes end on an assembler listing line.
+	bytesColumn = 15
+
+	// dumpWidth is the most bytes on a monitor dump line.
+	dumpWidth = 16
+)
+
+// Record is a run of bytes the listing says were assembled at Address.
+type Record struct {
+	Address uint16
+	Bytes   []byte
+	Line    int    // line number of the source responsible, if listed
+	Source  string // source line responsible, if listed
+}
+
+// Open parses the listing file at path.
+func Open(path string) ([]Record, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	records, err := Parse(fp)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return records, nil
+}
+
+// Parse reads a listing and returns the records of object code in it.
+func Parse(src io.Reader) (records []Record, err error) {
+	var line int
+	var source string
+
+	scanner := bufio.NewScanner(src)
+	for scanner.Scan() {
+		text := strings.TrimRight(scanner.Text(), " \t\r")
+
+		if strings.HasPrefix(text, "$") {
+			records = append(records, parseDump(text)...)
+			continue
+		}
+
+		addr, ok := parseAddress(text)
+		if !ok {
+			continue
+		}
+
+		rec := Record{Address: addr}
+
+		field := text[5:]
+		rest := ""
+		if len(text) > bytesColumn {
+			field, rest = text[5:bytesColumn], text[bytesColumn:]
+		}
+		for _, tok := range strings.Fields(field) {
+			b, err := strconv.ParseUint(tok, 16, 8)
+			if err != nil || len(tok) != 2 {
+				return nil, fmt.Errorf("invalid byte %q in %q", tok, text)
+			}
+			rec.Bytes = append(rec.Bytes, byte(b))
+		}
+
+		rest = strings.TrimLeft(rest, " ")
+		num := rest
+		if i := strings.IndexByte(rest, ' '); i >= 0 {
+			num = rest[:i]
+		}
+		if n, err := strconv.Atoi(num); err == nil {
+			line = n
+			source = strings.TrimLeft(rest[len(num):], " ")
+		} else if rest != "" {
+			return nil, fmt.Errorf("missing line number in %q", text)
+		}
+
+		rec.Line, rec.Source = line, source
+		if len(rec.Bytes) > 0 {
+			records = append(records, rec)
+		}
+	}
+
+	return records, scanner.Err()
+}
+
+// parseAddress reads the "XXXX:" at the start of an assembler listing line.
+func parseAddress(text string) (uint16, bool) {
+	if len(text) < 5 || text[4] != ':' {
+		return 0, false
+	}
+	addr, err := strconv.ParseUint(text[:4], 16, 16)
+	return uint16(addr), err == nil
+}
+
+// parseDump reads a monitor dump line, returning a record for each run of
+// bytes between the ".." placeholders.
+func parseDump(text string) (records []Record) {
+	fields := strings.Fields(text[1:])
+	if len(fields) == 0 {
+		return
+	}
+
+	addr, err := strconv.ParseUint(strings.TrimSuffix(fields[0], ":"), 16, 16)
+	if err != nil {
+		return
+	}
+
+	var rec *Record
+	for i, tok := range fields[1:] {
+		if i == dumpWidth {
+			break
+		}
+
+		b, err := strconv.ParseUint(tok, 16, 8)
+		if err != nil || len(tok) != 2 {
+			rec = nil
+			if tok == ".." {
+				continue
+			}
+			break
+		}
+
+		if rec == nil {
+			records = append(records, Record{Address: uint16(addr) + uint16(i)})
+			rec = &records[len(records)-1]
+		}
+		rec.Bytes = append(rec.Bytes, byte(b))
+	}
+
+	return
+}
+
+// Difference is a byte that the listing and the assembled segments disagree
+// on.
+type Difference struct {
+	Address uint16
+	Want    int     // byte in the listing, or -1 if it lists none
+	Got     int     // byte assembled, or -1 if none was
+	Record  *Record // listing record responsible, if any
+}
+
+func (d Difference) String() string {
+	show := func(b int) string {
+		if b < 0 {
+			return "nothing"
+		}
+		return fmt.Sprintf("$%02X", b)
+	}
+
+	msg := fmt.Sprintf("$%04X: listing has %s; assembled %s", d.Address, show(d.Want), show(d.Got))
+	if d.Record != nil && d.Record.Line > 0 {
+		msg += fmt.Sprintf(" (line %d: %s)", d.Record.Line, d.Record.Source)
+	}
+	return msg
+}
+
+// Compare returns every byte that differs between the listing records and the
+// assembled segments, in address order.
+func Compare(records []Record, segments []a2asm.Segment) (diffs []Difference) {
+	type listed struct {
+		Value  byte
+		Record *Record
+	}
+
+	want := make(map[int]listed)
+	for i := range records {
+		rec := &records[i]
+		for j, b := range rec.Bytes {
+			want[int(rec.Address)+j] = listed{b, rec}
+		}
+	}
+
+	got := make(map[int]byte)
+	for _, seg := range segments {
+		for j, b := range seg.Data {
+			got[int(seg.Origin)+j] = b
+		}
+	}
+
+	for addr := 0; addr < 0x10000; addr++ {
+		w, inListing := want[addr]
+		g, assembled := got[addr]
+
+		d := Difference{Address: uint16(addr), Want: -1, Got: -1, Record: w.Record}
+		if inListing {
+			d.Want = int(w.Value)
+		}
+		if assembled {
+			d.Got = int(g)
+		}
+
+		if d.Want != d.Got {
+			diffs = append(diffs, d)
+		}
+	}
+
+	return
+}
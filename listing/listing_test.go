@@ -0,0 +1,129 @@
+package listing
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/taeber/a2asm"
+)
+
+func TestParseAssemblerListing(t *testing.T) {
+	src := `
+               1  * TEST
+               2          ORG $300
+0300: A9 C1    3  START   LDA #"A"
+0302: 20 ED FD 4          JSR $FDED
+0305: C8 C5 CC 5  MSG     ASC "HELLO"
+0308: CC CF
+               6  BELL    EQU $FBDD
+
+--End assembly, 10 bytes, Errors: 0
+`
+
+	expected := []Record{
+		{0x300, []byte{0xA9, 0xC1}, 3, `START   LDA #"A"`},
+		{0x302, []byte{0x20, 0xED, 0xFD}, 4, "JSR $FDED"},
+		{0x305, []byte{0xC8, 0xC5, 0xCC}, 5, `MSG     ASC "HELLO"`},
+		{0x308, []byte{0xCC, 0xCF}, 5, `MSG     ASC "HELLO"`},
+	}
+
+	actual, err := Parse(strings.NewReader(src))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %v; got %v", expected, actual)
+	}
+}
+
+func TestParseMonitorDump(t *testing.T) {
+	src := `
+*300.30F
+$0300: .. .. A9 C1 .. 60 .. .. .. .. .. .. .. .. .. ..
+`
+
+	expected := []Record{
+		{Address: 0x302, Bytes: []byte{0xA9, 0xC1}},
+		{Address: 0x305, Bytes: []byte{0x60}},
+	}
+
+	actual, err := Parse(strings.NewReader(src))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %v; got %v", expected, actual)
+	}
+}
+
+func TestCompareReportsEveryDifference(t *testing.T) {
+	records := []Record{
+		{0x300, []byte{0xA9, 0xC1}, 3, `LDA #"A"`},
+		{0x302, []byte{0x60}, 4, "RTS"},
+	}
+	segments := []a2asm.Segment{
+		{Origin: 0x300, Data: []byte{0xA9, 0x41}},
+		{Origin: 0x303, Data: []byte{0xEA}},
+	}
+
+	expected := []string{
+		`$0301: listing has $C1; assembled $41 (line 3: LDA #"A")`,
+		"$0302: listing has $60; assembled nothing (line 4: RTS)",
+		"$0303: listing has nothing; assembled $EA",
+	}
+
+	var actual []string
+	for _, d := range Compare(records, segments) {
+		actual = append(actual, d.String())
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %q; got %q", expected, actual)
+	}
+}
+
+// TestReferenceListings assembles each source in testdata and compares it
+// with the listing of the same name. To check the Assembly Lines programs,
+// copy their .S and .txt files into testdata.
+func TestReferenceListings(t *testing.T) {
+	listings, err := filepath.Glob(filepath.Join("testdata", "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range listings {
+		path := path
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			records, err := Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			base := strings.TrimSuffix(path, ".txt")
+			fp, err := os.Open(base + ".s")
+			if os.IsNotExist(err) {
+				fp, err = os.Open(base + ".S")
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fp.Close()
+
+			segments, err := a2asm.AssembleSegments(fp)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, d := range Compare(records, segments) {
+				t.Error(d)
+			}
+		})
+	}
+}
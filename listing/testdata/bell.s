@@ -0,0 +1,7 @@
+*       OBJ $300
+        ORG $300
+BELL    EQU $FBDD
+*
+START   JSR BELL
+        RTS
+        CHK
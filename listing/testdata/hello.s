@@ -0,0 +1,11 @@
+        ORG $300
+COUT    EQU $FDED
+START   LDX #0
+LOOP    LDA MSG,X
+        BEQ DONE
+        JSR COUT
+        INX
+        BNE LOOP
+DONE    RTS
+MSG     ASC "HELLO"
+        HEX 8D00
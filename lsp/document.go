@@ -0,0 +1,140 @@
+package lsp
+
+import (
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/taeber/a2asm"
+)
+
+// document is a source open in the editor.
+type document struct {
+	URI  string
+	Path string // of the file, or just its Name if the URI is not a file
+	Dir  string // that PUT files are read from
+	Name string
+
+	Text  string
+	Lines []string
+
+	// Result is from the last time the document assembled, if it has.
+	Result *a2asm.Result
+}
+
+func (doc *document) setText(text string) {
+	if doc.Path == "" {
+		if u, err := url.Parse(doc.URI); err == nil && u.Scheme == "file" {
+			doc.Path = filepath.FromSlash(u.Path)
+			doc.Dir = filepath.Dir(doc.Path)
+			doc.Name = filepath.Base(doc.Path)
+		} else {
+			doc.Name = path.Base(doc.URI)
+			doc.Path = doc.Name
+		}
+	}
+
+	doc.Text = text
+	doc.Lines = strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+}
+
+// opener opens the files doc includes, relative to it, preferring the text
+// of those open in the editor to what was last saved.
+func (srv *Server) opener(doc *document) a2asm.Opener {
+	return func(name string) (io.ReadCloser, error) {
+		path := filepath.Join(doc.Dir, name)
+		if doc.Dir == "" {
+			path = name
+		}
+		for _, open := range srv.docs {
+			if open.Path == path {
+				return ioutil.NopCloser(strings.NewReader(open.Text)), nil
+			}
+		}
+		return os.Open(path)
+	}
+}
+
+// uri returns the URI of file, as named in a Position of doc's Result.
+func (doc *document) uri(file string) string {
+	if file == "" || doc.Dir == "" {
+		return doc.URI
+	}
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(filepath.Join(doc.Dir, file))}
+	return u.String()
+}
+
+// lineText returns the text of the line at pos, or "" if it is not known.
+func (doc *document) lineText(pos a2asm.Position) string {
+	if pos.File == "" || pos.File == doc.Name {
+		if pos.Line > 0 && int(pos.Line) <= len(doc.Lines) {
+			return doc.Lines[pos.Line-1]
+		}
+		return ""
+	}
+
+	if doc.Result != nil {
+		for _, line := range doc.Result.Lines {
+			if line.File == pos.File && line.Number == pos.Line {
+				return line.Text
+			}
+		}
+	}
+	return ""
+}
+
+func (doc *document) diagnostics(result *a2asm.Result, err error) []diagnostic {
+	diagnostics := []diagnostic{}
+
+	if result != nil {
+		for _, d := range result.Diagnostics() {
+			if d.File == "" {
+				diagnostics = append(diagnostics, doc.diagnostic(d))
+			}
+		}
+	}
+
+	if err != nil {
+		d, ok := a2asm.ErrorDiagnostic(err)
+		if !ok || d.File != "" {
+			// Errors in PUT files, or of no line, are shown on the first.
+			d = a2asm.Diagnostic{Severity: "error", Rule: a2asm.ErrorRule, Message: err.Error()}
+		}
+		diagnostics = append(diagnostics, doc.diagnostic(d))
+	}
+
+	return diagnostics
+}
+
+// diagnostic returns d, about a line of doc, for the editor.
+func (doc *document) diagnostic(d a2asm.Diagnostic) diagnostic {
+	line := int(d.Line) - 1
+	if line < 0 {
+		line = 0
+	}
+
+	r := doc.lineRange(line)
+	if d.Column > 0 {
+		r.Start.Character = d.Column - 1
+		r.End.Character = d.EndColumn - 1
+	}
+
+	severity := severityWarning
+	if d.Severity == "error" {
+		severity = severityError
+	}
+	return diagnostic{r, severity, d.Rule, "a2asm", d.Message}
+}
+
+// lineRange returns the range of the whole line, counting from 0.
+func (doc *document) lineRange(line int) textRange {
+	var n int
+	if line < len(doc.Lines) {
+		n = len(doc.Lines[line])
+	}
+	return textRange{position{line, 0}, position{line, n}}
+}
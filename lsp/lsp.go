@@ -0,0 +1,265 @@
+// Package lsp is a language server for MERLIN assembly, speaking the Language
+// Server Protocol over a stream such as stdio.
+//
+// Each open document is assembled whenever it changes. The errors and
+// warnings are published as diagnostics, and the symbols of the Result
+// answer requests for definitions, references, hover, completion and the
+// outline of the document. A document that no longer assembles keeps the
+// symbols from the last time it did.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+
+	"github.com/taeber/a2asm"
+)
+
+// Server is a language server reading requests from In and writing
+// responses and notifications to Out.
+type Server struct {
+	In  io.Reader
+	Out io.Writer
+
+	docs     map[string]*document // by URI
+	warnings map[string]bool
+}
+
+// Serve answers requests from r on w until the client asks it to exit or r
+// ends.
+func Serve(r io.Reader, w io.Writer) error {
+	return (&Server{In: r, Out: w}).Serve()
+}
+
+// Serve answers requests until the client asks it to exit or In ends.
+func (srv *Server) Serve() error {
+	srv.docs = make(map[string]*document)
+
+	in := textproto.NewReader(bufio.NewReader(srv.In))
+	for {
+		body, err := readMessage(in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			if err := srv.fail(nil, parseError, err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if msg.Method == "exit" {
+			return nil
+		}
+
+		result, err := srv.handle(msg)
+		var rerr *rpcError
+		if err != nil && !errors.As(err, &rerr) {
+			return err
+		}
+		if msg.ID == nil {
+			// Notifications have no response, even when they fail.
+			continue
+		}
+		if rerr != nil {
+			err = srv.fail(msg.ID, rerr.Code, rerr)
+		} else {
+			err = srv.write(response{"2.0", msg.ID, result})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readMessage reads the body of the next message, which follows headers
+// giving its Content-Length.
+func readMessage(in *textproto.Reader) ([]byte, error) {
+	header, err := in.ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF && len(header) == 0 {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("bad Content-Length: %v", err)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(in.R, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// write sends msg to the client.
+func (srv *Server) write(msg interface{}) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(srv.Out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+func (srv *Server) fail(id *json.RawMessage, code int, err error) error {
+	return srv.write(errorResponse{"2.0", id, responseError{code, err.Error()}})
+}
+
+func (srv *Server) notify(method string, params interface{}) error {
+	return srv.write(notification{"2.0", method, params})
+}
+
+// rpcError is an error to respond to a request with.
+type rpcError struct {
+	Code    int
+	Message string
+}
+
+func (e *rpcError) Error() string { return e.Message }
+
+// handle carries out the request or notification in msg and returns the
+// result to respond with.
+func (srv *Server) handle(msg message) (interface{}, error) {
+	params := func(v interface{}) error {
+		if err := json.Unmarshal(msg.Params, v); err != nil {
+			return &rpcError{invalidParams, err.Error()}
+		}
+		return nil
+	}
+
+	switch msg.Method {
+	case "initialize":
+		var p initializeParams
+		if err := params(&p); err != nil {
+			return nil, err
+		}
+		srv.warnings = p.InitializationOptions.Warnings
+		return initializeResult{
+			Capabilities: serverCapabilities{
+				TextDocumentSync:       syncFull,
+				DefinitionProvider:     true,
+				ReferencesProvider:     true,
+				HoverProvider:          true,
+				CompletionProvider:     completionOptions{[]string{":", "."}},
+				DocumentSymbolProvider: true,
+			},
+			ServerInfo: serverInfo{"a2asm"},
+		}, nil
+
+	case "initialized", "shutdown":
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if err := params(&p); err != nil {
+			return nil, err
+		}
+		return nil, srv.update(p.TextDocument.URI, p.TextDocument.Text)
+
+	case "textDocument/didChange":
+		var p didChangeParams
+		if err := params(&p); err != nil {
+			return nil, err
+		}
+		if n := len(p.ContentChanges); n > 0 {
+			return nil, srv.update(p.TextDocument.URI, p.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+
+	case "textDocument/didClose":
+		var p didCloseParams
+		if err := params(&p); err != nil {
+			return nil, err
+		}
+		delete(srv.docs, p.TextDocument.URI)
+		return nil, srv.notify("textDocument/publishDiagnostics",
+			publishDiagnosticsParams{p.TextDocument.URI, []diagnostic{}})
+
+	case "textDocument/definition":
+		var p textDocumentPositionParams
+		if err := params(&p); err != nil {
+			return nil, err
+		}
+		return srv.definition(p), nil
+
+	case "textDocument/references":
+		var p referenceParams
+		if err := params(&p); err != nil {
+			return nil, err
+		}
+		return srv.references(p), nil
+
+	case "textDocument/hover":
+		var p textDocumentPositionParams
+		if err := params(&p); err != nil {
+			return nil, err
+		}
+		return srv.hover(p), nil
+
+	case "textDocument/completion":
+		var p textDocumentPositionParams
+		if err := params(&p); err != nil {
+			return nil, err
+		}
+		return srv.completion(p), nil
+
+	case "textDocument/documentSymbol":
+		var p documentSymbolParams
+		if err := params(&p); err != nil {
+			return nil, err
+		}
+		return srv.documentSymbols(p), nil
+	}
+
+	return nil, &rpcError{methodNotFound, "unknown method: " + msg.Method}
+}
+
+// assemble assembles doc. A panic in the assembler, on text half typed, is
+// returned as an error so that it is shown rather than stopping the server.
+func (srv *Server) assemble(doc *document) (result *a2asm.Result, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, fmt.Errorf("cannot assemble: %v", r)
+		}
+	}()
+
+	return a2asm.AssembleWithOptions(nil, a2asm.Options{
+		Name:     doc.Name,
+		Open:     srv.opener(doc),
+		Warnings: srv.warnings,
+		Locals:   true,
+	})
+}
+
+// update assembles the document at uri with its new text and publishes its
+// diagnostics.
+func (srv *Server) update(uri, text string) error {
+	doc, ok := srv.docs[uri]
+	if !ok {
+		doc = &document{URI: uri}
+		srv.docs[uri] = doc
+	}
+	doc.setText(text)
+
+	result, err := srv.assemble(doc)
+	if result != nil {
+		doc.Result = result
+	}
+
+	return srv.notify("textDocument/publishDiagnostics",
+		publishDiagnosticsParams{uri, doc.diagnostics(result, err)})
+}
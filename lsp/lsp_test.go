@@ -0,0 +1,360 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/taeber/a2asm"
+)
+
+// operands are how each addressing mode is written in the tests.
+var operands = map[string]string{
+	implied:     "",
+	accumulator: "",
+	immediate:   "#$44",
+	zeroPage:    "$44",
+	zeroPageX:   "$44,X",
+	zeroPageY:   "$44,Y",
+	absolute:    "$4400",
+	absoluteX:   "$4400,X",
+	absoluteY:   "$4400,Y",
+	indirect:    "($4400)",
+	indirectX:   "($44,X)",
+	indirectY:   "($44),Y",
+	relative:    "$300",
+}
+
+func TestOpcodes(t *testing.T) {
+	for name, info := range instructions {
+		for _, op := range info.Opcodes {
+			src := fmt.Sprintf(" ORG $300\n %s %s\n", name, operands[op.Mode])
+			result, err := a2asm.AssembleWithOptions(strings.NewReader(src), a2asm.Options{})
+			if err != nil {
+				t.Errorf("%s %s: %v", name, op.Mode, err)
+				continue
+			}
+
+			data := result.Segments[0].Data
+			if len(data) != modeSize[op.Mode] || data[0] != op.Code {
+				t.Errorf("%s %s: expected $%02X in %d bytes; got % X", name, op.Mode, op.Code, modeSize[op.Mode], data)
+			}
+		}
+	}
+}
+
+const mainSource = `COUT	EQU $FDED
+		ORG $300
+START	LDX #0
+:LOOP	LDA MSG,X
+		BEQ :DONE
+		JSR COUT
+		INX
+		BNE :LOOP
+:DONE	JMP EXIT
+		PUT LIB
+`
+
+const libSource = `MSG		ASC "HI"
+		DFB 0
+EXIT	RTS
+`
+
+// reply is a response or notification from the server.
+type reply struct {
+	ID     *int
+	Method string
+	Params json.RawMessage
+	Result json.RawMessage
+	Error  *responseError
+}
+
+// session sends each message to a server and returns its replies.
+func session(t *testing.T, messages ...interface{}) []reply {
+	var in bytes.Buffer
+	for _, msg := range messages {
+		body, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+
+	var out bytes.Buffer
+	if err := Serve(&in, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	var replies []reply
+	r := textproto.NewReader(bufio.NewReader(&out))
+	for {
+		body, err := readMessage(r)
+		if err == io.EOF {
+			return replies
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var rep reply
+		if err := json.Unmarshal(body, &rep); err != nil {
+			t.Fatal(err)
+		}
+		replies = append(replies, rep)
+	}
+}
+
+func request(id int, method string, params interface{}) map[string]interface{} {
+	return map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params}
+}
+
+func notice(method string, params interface{}) map[string]interface{} {
+	return map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params}
+}
+
+func at(uri string, line, character int) map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument": map[string]string{"uri": uri},
+		"position":     position{line, character},
+	}
+}
+
+// result finds the response to the request id and decodes it into v.
+func result(t *testing.T, replies []reply, id int, v interface{}) {
+	t.Helper()
+	for _, rep := range replies {
+		if rep.ID != nil && *rep.ID == id {
+			if rep.Error != nil {
+				t.Fatalf("request %d failed: %s", id, rep.Error.Message)
+			}
+			if err := json.Unmarshal(rep.Result, v); err != nil {
+				t.Fatal(err)
+			}
+			return
+		}
+	}
+	t.Fatalf("no response to request %d", id)
+}
+
+// published returns the diagnostics of each publishDiagnostics, in order.
+func published(t *testing.T, replies []reply) [][]diagnostic {
+	var all [][]diagnostic
+	for _, rep := range replies {
+		if rep.Method == "textDocument/publishDiagnostics" {
+			var p publishDiagnosticsParams
+			if err := json.Unmarshal(rep.Params, &p); err != nil {
+				t.Fatal(err)
+			}
+			all = append(all, p.Diagnostics)
+		}
+	}
+	return all
+}
+
+func fileURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "LIB"), []byte(libSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+	uri := fileURI(filepath.Join(dir, "MAIN.S"))
+	libURI := fileURI(filepath.Join(dir, "LIB"))
+
+	replies := session(t,
+		request(1, "initialize", map[string]interface{}{}),
+		notice("initialized", map[string]interface{}{}),
+		notice("textDocument/didOpen", map[string]interface{}{
+			"textDocument": map[string]string{"uri": uri, "languageId": "merlin", "text": mainSource},
+		}),
+		request(2, "textDocument/definition", at(uri, 3, 11)), // MSG
+		request(3, "textDocument/definition", at(uri, 7, 7)),  // :LOOP
+		request(4, "textDocument/references", map[string]interface{}{
+			"textDocument": map[string]string{"uri": uri},
+			"position":     position{0, 1}, // COUT
+			"context":      map[string]bool{"includeDeclaration": true},
+		}),
+		request(5, "textDocument/hover", at(uri, 5, 8)), // COUT
+		request(6, "textDocument/hover", at(uri, 3, 3)), // :LOOP
+		request(7, "textDocument/hover", at(uri, 3, 7)), // LDA
+		request(8, "textDocument/completion", at(uri, 4, 3)),
+		request(9, "textDocument/completion", at(uri, 4, 7)),
+		request(10, "textDocument/documentSymbol", map[string]interface{}{
+			"textDocument": map[string]string{"uri": uri},
+		}),
+		notice("textDocument/didChange", map[string]interface{}{
+			"textDocument":   map[string]interface{}{"uri": uri, "version": 2},
+			"contentChanges": []map[string]string{{"text": mainSource + "\t\tBNE NOWHERE\n"}},
+		}),
+		request(11, "textDocument/hover", at(uri, 5, 8)),
+		request(12, "shutdown", nil),
+		notice("exit", nil),
+	)
+
+	var init initializeResult
+	result(t, replies, 1, &init)
+	if !init.Capabilities.DefinitionProvider || init.Capabilities.TextDocumentSync != syncFull {
+		t.Errorf("Expected definitions and full sync; got %+v", init.Capabilities)
+	}
+
+	var locations []location
+	result(t, replies, 2, &locations)
+	expected := []location{{libURI, textRange{position{0, 0}, position{0, 3}}}}
+	if !reflect.DeepEqual(expected, locations) {
+		t.Errorf("Expected MSG in LIB %v; got %v", expected, locations)
+	}
+
+	result(t, replies, 3, &locations)
+	expected = []location{{uri, textRange{position{3, 0}, position{3, 5}}}}
+	if !reflect.DeepEqual(expected, locations) {
+		t.Errorf("Expected :LOOP %v; got %v", expected, locations)
+	}
+
+	result(t, replies, 4, &locations)
+	expected = []location{
+		{uri, textRange{position{0, 0}, position{0, 4}}},
+		{uri, textRange{position{5, 6}, position{5, 10}}},
+	}
+	if !reflect.DeepEqual(expected, locations) {
+		t.Errorf("Expected references to COUT %v; got %v", expected, locations)
+	}
+
+	var h hover
+	result(t, replies, 5, &h)
+	if h.Contents.Value != "**COUT** (constant) = $FDED (65005)" {
+		t.Errorf("Unexpected hover for COUT: %q", h.Contents.Value)
+	}
+
+	result(t, replies, 6, &h)
+	if h.Contents.Value != "**:LOOP** in START (label) = $0302 (770)" {
+		t.Errorf("Unexpected hover for :LOOP: %q", h.Contents.Value)
+	}
+
+	result(t, replies, 7, &h)
+	if !strings.HasPrefix(h.Contents.Value, "**LDA** — Load accumulator\n\nFlags: N Z\n") ||
+		!strings.Contains(h.Contents.Value, "| Absolute,X | `LDA $4400,X` | $BD | 3 | 4+ |") {
+		t.Errorf("Unexpected hover for LDA:\n%s", h.Contents.Value)
+	}
+
+	var items []completionItem
+	result(t, replies, 8, &items)
+	if !hasCompletion(items, "LDA") || !hasCompletion(items, "PUT") || hasCompletion(items, "COUT") {
+		t.Errorf("Expected mnemonics; got %v", items)
+	}
+
+	result(t, replies, 9, &items)
+	if !hasCompletion(items, "COUT") || !hasCompletion(items, ":LOOP") || !hasCompletion(items, "EXIT") ||
+		hasCompletion(items, "LDA") {
+		t.Errorf("Expected symbols; got %v", items)
+	}
+
+	var symbols []documentSymbol
+	result(t, replies, 10, &symbols)
+	var names []string
+	for _, sym := range symbols {
+		names = append(names, sym.Name)
+		for _, child := range sym.Children {
+			names = append(names, "  "+child.Name)
+		}
+	}
+	if expected := []string{"COUT", "START", "  :LOOP", "  :DONE"}; !reflect.DeepEqual(expected, names) {
+		t.Errorf("Expected document symbols %v; got %v", expected, names)
+	}
+
+	diagnostics := published(t, replies)
+	if len(diagnostics) != 2 || len(diagnostics[0]) != 0 || len(diagnostics[1]) != 1 {
+		t.Fatalf("Expected no diagnostics and then an error; got %v", diagnostics)
+	}
+	d := diagnostics[1][0]
+	if d.Severity != severityError || d.Range.Start.Line != 10 || !strings.Contains(d.Message, "NOWHERE") {
+		t.Errorf("Unexpected diagnostic %+v", d)
+	}
+
+	// The symbols from before the error are kept.
+	result(t, replies, 11, &h)
+	if h.Contents.Value != "**COUT** (constant) = $FDED (65005)" {
+		t.Errorf("Unexpected hover for COUT after the error: %q", h.Contents.Value)
+	}
+}
+
+func hasCompletion(items []completionItem, label string) bool {
+	for _, item := range items {
+		if item.Label == label {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWarningDiagnostics(t *testing.T) {
+	uri := "untitled:Untitled-1"
+	replies := session(t,
+		request(1, "initialize", map[string]interface{}{
+			"initializationOptions": map[string]interface{}{
+				"warnings": map[string]bool{a2asm.WarnUnusedLabel: true},
+			},
+		}),
+		notice("textDocument/didOpen", map[string]interface{}{
+			"textDocument": map[string]string{"uri": uri, "text": " ORG $300\nSTART LDA #$1234 ; load\n"},
+		}),
+		request(2, "textDocument/unknown", nil),
+	)
+
+	for _, rep := range replies {
+		if rep.ID != nil && *rep.ID == 2 && (rep.Error == nil || rep.Error.Code != methodNotFound) {
+			t.Errorf("Expected method not found; got %+v", rep)
+		}
+	}
+
+	diagnostics := published(t, replies)
+	if len(diagnostics) != 1 {
+		t.Fatalf("Expected one set of diagnostics; got %v", diagnostics)
+	}
+
+	expected := []diagnostic{
+		{textRange{position{1, 0}, position{1, 16}}, severityWarning, a2asm.WarnTruncation, "a2asm", "immediate value $1234 is truncated to $34; use < or > to pick a byte"},
+		{textRange{position{1, 0}, position{1, 16}}, severityWarning, a2asm.WarnUnusedLabel, "a2asm", "label START is never used"},
+	}
+	if !reflect.DeepEqual(expected, diagnostics[0]) {
+		t.Errorf("Expected %v; got %v", expected, diagnostics[0])
+	}
+}
+
+func TestHalfTypedLines(t *testing.T) {
+	uri := "untitled:Untitled-1"
+	replies := session(t,
+		request(1, "initialize", map[string]interface{}{}),
+		notice("textDocument/didOpen", map[string]interface{}{
+			"textDocument": map[string]string{"uri": uri, "text": " ORG\n"},
+		}),
+		notice("textDocument/didChange", map[string]interface{}{
+			"textDocument":   map[string]interface{}{"uri": uri, "version": 2},
+			"contentChanges": []map[string]string{{"text": " ORG $300\n LDA ($\n"}},
+		}),
+		request(2, "shutdown", nil),
+	)
+
+	diagnostics := published(t, replies)
+	if len(diagnostics) != 2 {
+		t.Fatalf("Expected two sets of diagnostics; got %v", diagnostics)
+	}
+
+	expected := [][]diagnostic{
+		{{textRange{position{0, 1}, position{0, 4}}, severityError, a2asm.ErrorRule, "a2asm", "missing address"}},
+		{{textRange{position{1, 1}, position{1, 7}}, severityError, a2asm.ErrorRule, "a2asm", "expected hex, binary, or decimal literal; got $"}},
+	}
+	if !reflect.DeepEqual(expected, diagnostics) {
+		t.Errorf("Expected %v; got %v", expected, diagnostics)
+	}
+}
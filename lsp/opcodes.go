@@ -0,0 +1,223 @@
+package lsp
+
+// Addressing modes, as named on hover.
+const (
+	implied     = "Implied"
+	accumulator = "Accumulator"
+	immediate   = "Immediate"
+	zeroPage    = "Zero Page"
+	zeroPageX   = "Zero Page,X"
+	zeroPageY   = "Zero Page,Y"
+	absolute    = "Absolute"
+	absoluteX   = "Absolute,X"
+	absoluteY   = "Absolute,Y"
+	indirect    = "(Indirect)"
+	indirectX   = "(Indirect,X)"
+	indirectY   = "(Indirect),Y"
+	relative    = "Relative"
+)
+
+// modeSyntax shows how each addressing mode is written.
+var modeSyntax = map[string]string{
+	implied:     "",
+	accumulator: "",
+	immediate:   "#$44",
+	zeroPage:    "$44",
+	zeroPageX:   "$44,X",
+	zeroPageY:   "$44,Y",
+	absolute:    "$4400",
+	absoluteX:   "$4400,X",
+	absoluteY:   "$4400,Y",
+	indirect:    "($4400)",
+	indirectX:   "($44,X)",
+	indirectY:   "($44),Y",
+	relative:    "LABEL",
+}
+
+// modeSize is the number of bytes an instruction takes in each mode.
+var modeSize = map[string]int{
+	implied:     1,
+	accumulator: 1,
+	immediate:   2,
+	zeroPage:    2,
+	zeroPageX:   2,
+	zeroPageY:   2,
+	absolute:    3,
+	absoluteX:   3,
+	absoluteY:   3,
+	indirect:    3,
+	indirectX:   2,
+	indirectY:   2,
+	relative:    2,
+}
+
+// opcode is an instruction in one addressing mode. Cycles ending in + take
+// one more when a page boundary is crossed or, for branches, when taken.
+type opcode struct {
+	Mode   string
+	Code   byte
+	Cycles string
+}
+
+// instructionInfo describes a 6502 instruction.
+type instructionInfo struct {
+	Description string
+	Flags       string // the flags it changes: N V B D I Z C
+	Opcodes     []opcode
+}
+
+// instructions are the 6502 instructions a2asm assembles, by mnemonic.
+var instructions = map[string]instructionInfo{
+	"ADC": {"Add with carry", "N V Z C", []opcode{
+		{immediate, 0x69, "2"}, {zeroPage, 0x65, "3"}, {zeroPageX, 0x75, "4"},
+		{absolute, 0x6D, "4"}, {absoluteX, 0x7D, "4+"}, {absoluteY, 0x79, "4+"},
+		{indirectX, 0x61, "6"}, {indirectY, 0x71, "5+"},
+	}},
+	"AND": {"AND with accumulator", "N Z", []opcode{
+		{immediate, 0x29, "2"}, {zeroPage, 0x25, "3"}, {zeroPageX, 0x35, "4"},
+		{absolute, 0x2D, "4"}, {absoluteX, 0x3D, "4+"}, {absoluteY, 0x39, "4+"},
+		{indirectX, 0x21, "6"}, {indirectY, 0x31, "5+"},
+	}},
+	"ASL": {"Arithmetic shift left", "N Z C", []opcode{
+		{accumulator, 0x0A, "2"}, {zeroPage, 0x06, "5"}, {zeroPageX, 0x16, "6"},
+		{absolute, 0x0E, "6"}, {absoluteX, 0x1E, "7"},
+	}},
+	"BCC": {"Branch if carry clear", "", []opcode{{relative, 0x90, "2+"}}},
+	"BCS": {"Branch if carry set", "", []opcode{{relative, 0xB0, "2+"}}},
+	"BEQ": {"Branch if equal (zero set)", "", []opcode{{relative, 0xF0, "2+"}}},
+	"BIT": {"Test bits in memory with accumulator", "N V Z", []opcode{
+		{zeroPage, 0x24, "3"}, {absolute, 0x2C, "4"},
+	}},
+	"BMI": {"Branch if minus (negative set)", "", []opcode{{relative, 0x30, "2+"}}},
+	"BNE": {"Branch if not equal (zero clear)", "", []opcode{{relative, 0xD0, "2+"}}},
+	"BPL": {"Branch if plus (negative clear)", "", []opcode{{relative, 0x10, "2+"}}},
+	"BRK": {"Break", "B I", []opcode{{implied, 0x00, "7"}}},
+	"BVC": {"Branch if overflow clear", "", []opcode{{relative, 0x50, "2+"}}},
+	"BVS": {"Branch if overflow set", "", []opcode{{relative, 0x70, "2+"}}},
+	"CLC": {"Clear carry", "C", []opcode{{implied, 0x18, "2"}}},
+	"CLD": {"Clear decimal mode", "D", []opcode{{implied, 0xD8, "2"}}},
+	"CLI": {"Clear interrupt disable", "I", []opcode{{implied, 0x58, "2"}}},
+	"CLV": {"Clear overflow", "V", []opcode{{implied, 0xB8, "2"}}},
+	"CMP": {"Compare with accumulator", "N Z C", []opcode{
+		{immediate, 0xC9, "2"}, {zeroPage, 0xC5, "3"}, {zeroPageX, 0xD5, "4"},
+		{absolute, 0xCD, "4"}, {absoluteX, 0xDD, "4+"}, {absoluteY, 0xD9, "4+"},
+		{indirectX, 0xC1, "6"}, {indirectY, 0xD1, "5+"},
+	}},
+	"CPX": {"Compare with X", "N Z C", []opcode{
+		{immediate, 0xE0, "2"}, {zeroPage, 0xE4, "3"}, {absolute, 0xEC, "4"},
+	}},
+	"CPY": {"Compare with Y", "N Z C", []opcode{
+		{immediate, 0xC0, "2"}, {zeroPage, 0xC4, "3"}, {absolute, 0xCC, "4"},
+	}},
+	"DEC": {"Decrement memory", "N Z", []opcode{
+		{zeroPage, 0xC6, "5"}, {zeroPageX, 0xD6, "6"}, {absolute, 0xCE, "6"}, {absoluteX, 0xDE, "7"},
+	}},
+	"DEX": {"Decrement X", "N Z", []opcode{{implied, 0xCA, "2"}}},
+	"DEY": {"Decrement Y", "N Z", []opcode{{implied, 0x88, "2"}}},
+	"EOR": {"Exclusive OR with accumulator", "N Z", []opcode{
+		{immediate, 0x49, "2"}, {zeroPage, 0x45, "3"}, {zeroPageX, 0x55, "4"},
+		{absolute, 0x4D, "4"}, {absoluteX, 0x5D, "4+"}, {absoluteY, 0x59, "4+"},
+		{indirectX, 0x41, "6"}, {indirectY, 0x51, "5+"},
+	}},
+	"INC": {"Increment memory", "N Z", []opcode{
+		{zeroPage, 0xE6, "5"}, {zeroPageX, 0xF6, "6"}, {absolute, 0xEE, "6"}, {absoluteX, 0xFE, "7"},
+	}},
+	"INX": {"Increment X", "N Z", []opcode{{implied, 0xE8, "2"}}},
+	"INY": {"Increment Y", "N Z", []opcode{{implied, 0xC8, "2"}}},
+	"JMP": {"Jump", "", []opcode{{absolute, 0x4C, "3"}, {indirect, 0x6C, "5"}}},
+	"JSR": {"Jump to subroutine", "", []opcode{{absolute, 0x20, "6"}}},
+	"LDA": {"Load accumulator", "N Z", []opcode{
+		{immediate, 0xA9, "2"}, {zeroPage, 0xA5, "3"}, {zeroPageX, 0xB5, "4"},
+		{absolute, 0xAD, "4"}, {absoluteX, 0xBD, "4+"}, {absoluteY, 0xB9, "4+"},
+		{indirectX, 0xA1, "6"}, {indirectY, 0xB1, "5+"},
+	}},
+	"LDX": {"Load X", "N Z", []opcode{
+		{immediate, 0xA2, "2"}, {zeroPage, 0xA6, "3"}, {zeroPageY, 0xB6, "4"},
+		{absolute, 0xAE, "4"}, {absoluteY, 0xBE, "4+"},
+	}},
+	"LDY": {"Load Y", "N Z", []opcode{
+		{immediate, 0xA0, "2"}, {zeroPage, 0xA4, "3"}, {zeroPageX, 0xB4, "4"},
+		{absolute, 0xAC, "4"}, {absoluteX, 0xBC, "4+"},
+	}},
+	"LSR": {"Logical shift right", "N Z C", []opcode{
+		{accumulator, 0x4A, "2"}, {zeroPage, 0x46, "5"}, {zeroPageX, 0x56, "6"},
+		{absolute, 0x4E, "6"}, {absoluteX, 0x5E, "7"},
+	}},
+	"NOP": {"No operation", "", []opcode{{implied, 0xEA, "2"}}},
+	"ORA": {"OR with accumulator", "N Z", []opcode{
+		{immediate, 0x09, "2"}, {zeroPage, 0x05, "3"}, {zeroPageX, 0x15, "4"},
+		{absolute, 0x0D, "4"}, {absoluteX, 0x1D, "4+"}, {absoluteY, 0x19, "4+"},
+		{indirectX, 0x01, "6"}, {indirectY, 0x11, "5+"},
+	}},
+	"PHA": {"Push accumulator", "", []opcode{{implied, 0x48, "3"}}},
+	"PHP": {"Push processor status", "", []opcode{{implied, 0x08, "3"}}},
+	"PLA": {"Pull accumulator", "N Z", []opcode{{implied, 0x68, "4"}}},
+	"PLP": {"Pull processor status", "N V B D I Z C", []opcode{{implied, 0x28, "4"}}},
+	"ROL": {"Rotate left", "N Z C", []opcode{
+		{accumulator, 0x2A, "2"}, {zeroPage, 0x26, "5"}, {zeroPageX, 0x36, "6"},
+		{absolute, 0x2E, "6"}, {absoluteX, 0x3E, "7"},
+	}},
+	"ROR": {"Rotate right", "N Z C", []opcode{
+		{accumulator, 0x6A, "2"}, {zeroPage, 0x66, "5"}, {zeroPageX, 0x76, "6"},
+		{absolute, 0x6E, "6"}, {absoluteX, 0x7E, "7"},
+	}},
+	"RTI": {"Return from interrupt", "N V B D I Z C", []opcode{{implied, 0x40, "6"}}},
+	"RTS": {"Return from subroutine", "", []opcode{{implied, 0x60, "6"}}},
+	"SBC": {"Subtract with carry", "N V Z C", []opcode{
+		{immediate, 0xE9, "2"}, {zeroPage, 0xE5, "3"}, {zeroPageX, 0xF5, "4"},
+		{absolute, 0xED, "4"}, {absoluteX, 0xFD, "4+"}, {absoluteY, 0xF9, "4+"},
+		{indirectX, 0xE1, "6"}, {indirectY, 0xF1, "5+"},
+	}},
+	"SEC": {"Set carry", "C", []opcode{{implied, 0x38, "2"}}},
+	"SED": {"Set decimal mode", "D", []opcode{{implied, 0xF8, "2"}}},
+	"SEI": {"Set interrupt disable", "I", []opcode{{implied, 0x78, "2"}}},
+	"STA": {"Store accumulator", "", []opcode{
+		{zeroPage, 0x85, "3"}, {zeroPageX, 0x95, "4"}, {absolute, 0x8D, "4"},
+		{absoluteX, 0x9D, "5"}, {absoluteY, 0x99, "5"}, {indirectX, 0x81, "6"},
+		{indirectY, 0x91, "6"},
+	}},
+	"STX": {"Store X", "", []opcode{
+		{zeroPage, 0x86, "3"}, {zeroPageY, 0x96, "4"}, {absolute, 0x8E, "4"},
+	}},
+	"STY": {"Store Y", "", []opcode{
+		{zeroPage, 0x84, "3"}, {zeroPageX, 0x94, "4"}, {absolute, 0x8C, "4"},
+	}},
+	"TAX": {"Transfer accumulator to X", "N Z", []opcode{{implied, 0xAA, "2"}}},
+	"TAY": {"Transfer accumulator to Y", "N Z", []opcode{{implied, 0xA8, "2"}}},
+	"TSX": {"Transfer stack pointer to X", "N Z", []opcode{{implied, 0xBA, "2"}}},
+	"TXA": {"Transfer X to accumulator", "N Z", []opcode{{implied, 0x8A, "2"}}},
+	"TXS": {"Transfer X to stack pointer", "", []opcode{{implied, 0x9A, "2"}}},
+	"TYA": {"Transfer Y to accumulator", "N Z", []opcode{{implied, 0x98, "2"}}},
+}
+
+// directives are the assembler directives a2asm understands, for completion.
+var directives = map[string]string{
+	"ORG":     "Set the address",
+	"EQU":     "Define a constant",
+	"CHK":     "Checksum byte",
+	"DFB":     "Define bytes",
+	"DA":      "Define addresses, low byte first",
+	"DW":      "Define words, low byte first",
+	"DDB":     "Define words, high byte first",
+	"DS":      "Define storage",
+	"HEX":     "Define bytes in hex",
+	"ASC":     "ASCII string",
+	"DCI":     "ASCII string, last character inverted",
+	"INV":     "Inverse screen codes",
+	"FLS":     "Flashing screen codes",
+	"REV":     "ASCII string, reversed",
+	"STR":     "ASCII string with a length byte",
+	"SCR":     "Screen codes",
+	"MTX":     "MouseText screen codes",
+	"CHARSET": "Character set for screen codes",
+	"REL":     "Assemble a relocatable module",
+	"ENT":     "Entry point for other modules",
+	"EXT":     "Label defined by another module",
+	"PUT":     "Include a source file",
+	"USE":     "Include a source file",
+	"DUM":     "Start a dummy section",
+	"DEND":    "End a dummy section",
+	"ERR":     "Error if the expression is not zero",
+	"ASSERT":  "Error if the expression is zero",
+	"LST":     "Listing on or off",
+}
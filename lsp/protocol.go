@@ -0,0 +1,200 @@
+package lsp
+
+import "encoding/json"
+
+// The parts of the Language Server Protocol the server speaks. Lines and
+// characters count from 0.
+
+type (
+	// message is a JSON-RPC request, response or notification.
+	message struct {
+		JSONRPC string           `json:"jsonrpc"`
+		ID      *json.RawMessage `json:"id,omitempty"`
+		Method  string           `json:"method,omitempty"`
+		Params  json.RawMessage  `json:"params,omitempty"`
+	}
+
+	response struct {
+		JSONRPC string           `json:"jsonrpc"`
+		ID      *json.RawMessage `json:"id"`
+		Result  interface{}      `json:"result"`
+	}
+
+	errorResponse struct {
+		JSONRPC string           `json:"jsonrpc"`
+		ID      *json.RawMessage `json:"id"`
+		Error   responseError    `json:"error"`
+	}
+
+	responseError struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+
+	notification struct {
+		JSONRPC string      `json:"jsonrpc"`
+		Method  string      `json:"method"`
+		Params  interface{} `json:"params"`
+	}
+)
+
+// JSON-RPC error codes
+const (
+	parseError     = -32700
+	invalidParams  = -32602
+	methodNotFound = -32601
+)
+
+type (
+	initializeParams struct {
+		InitializationOptions struct {
+			// Warnings turns categories of warning on or off by name, as
+			// with a2asm -W.
+			Warnings map[string]bool `json:"warnings"`
+		} `json:"initializationOptions"`
+	}
+
+	initializeResult struct {
+		Capabilities serverCapabilities `json:"capabilities"`
+		ServerInfo   serverInfo         `json:"serverInfo"`
+	}
+
+	serverCapabilities struct {
+		TextDocumentSync       int               `json:"textDocumentSync"`
+		DefinitionProvider     bool              `json:"definitionProvider"`
+		ReferencesProvider     bool              `json:"referencesProvider"`
+		HoverProvider          bool              `json:"hoverProvider"`
+		CompletionProvider     completionOptions `json:"completionProvider"`
+		DocumentSymbolProvider bool              `json:"documentSymbolProvider"`
+	}
+
+	completionOptions struct {
+		TriggerCharacters []string `json:"triggerCharacters,omitempty"`
+	}
+
+	serverInfo struct {
+		Name string `json:"name"`
+	}
+)
+
+// syncFull is the textDocumentSync kind where each change sends the whole
+// document.
+const syncFull = 1
+
+type (
+	textDocumentIdentifier struct {
+		URI string `json:"uri"`
+	}
+
+	textDocumentItem struct {
+		URI  string `json:"uri"`
+		Text string `json:"text"`
+	}
+
+	didOpenParams struct {
+		TextDocument textDocumentItem `json:"textDocument"`
+	}
+
+	didChangeParams struct {
+		TextDocument   textDocumentIdentifier `json:"textDocument"`
+		ContentChanges []struct {
+			Text string `json:"text"`
+		} `json:"contentChanges"`
+	}
+
+	didCloseParams struct {
+		TextDocument textDocumentIdentifier `json:"textDocument"`
+	}
+
+	textDocumentPositionParams struct {
+		TextDocument textDocumentIdentifier `json:"textDocument"`
+		Position     position               `json:"position"`
+	}
+
+	referenceParams struct {
+		textDocumentPositionParams
+		Context struct {
+			IncludeDeclaration bool `json:"includeDeclaration"`
+		} `json:"context"`
+	}
+
+	documentSymbolParams struct {
+		TextDocument textDocumentIdentifier `json:"textDocument"`
+	}
+)
+
+type (
+	position struct {
+		Line      int `json:"line"`
+		Character int `json:"character"`
+	}
+
+	textRange struct {
+		Start position `json:"start"`
+		End   position `json:"end"`
+	}
+
+	location struct {
+		URI   string    `json:"uri"`
+		Range textRange `json:"range"`
+	}
+
+	diagnostic struct {
+		Range    textRange `json:"range"`
+		Severity int       `json:"severity"`
+		Code     string    `json:"code,omitempty"`
+		Source   string    `json:"source"`
+		Message  string    `json:"message"`
+	}
+
+	publishDiagnosticsParams struct {
+		URI         string       `json:"uri"`
+		Diagnostics []diagnostic `json:"diagnostics"`
+	}
+
+	markupContent struct {
+		Kind  string `json:"kind"`
+		Value string `json:"value"`
+	}
+
+	hover struct {
+		Contents markupContent `json:"contents"`
+		Range    *textRange    `json:"range,omitempty"`
+	}
+
+	completionItem struct {
+		Label  string `json:"label"`
+		Kind   int    `json:"kind"`
+		Detail string `json:"detail,omitempty"`
+	}
+
+	documentSymbol struct {
+		Name           string           `json:"name"`
+		Detail         string           `json:"detail,omitempty"`
+		Kind           int              `json:"kind"`
+		Range          textRange        `json:"range"`
+		SelectionRange textRange        `json:"selectionRange"`
+		Children       []documentSymbol `json:"children,omitempty"`
+	}
+)
+
+// Diagnostic severities
+const (
+	severityError   = 1
+	severityWarning = 2
+)
+
+// Completion item kinds
+const (
+	completionFunction = 3
+	completionVariable = 6
+	completionKeyword  = 14
+	completionConstant = 21
+)
+
+// Symbol kinds
+const (
+	symbolFunction = 12
+	symbolVariable = 13
+	symbolConstant = 14
+)
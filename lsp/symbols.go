@@ -0,0 +1,346 @@
+package lsp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/taeber/a2asm"
+	"github.com/taeber/a2asm/syntax"
+)
+
+// fields returns where the label field of a line ends and the mnemonic and
+// operand fields start, and where any comment starts. A line that is all
+// comment has no fields.
+func fields(text string) (labelEnd, mnemonic, operand, comment int) {
+	l := syntax.SplitLine(0, text)
+	comment = len(text)
+	if l.Comment.Pos > 0 {
+		comment = l.Comment.Pos - 1
+	}
+	mnemonic, operand = comment, comment
+	if l.Opcode.Pos > 0 {
+		mnemonic = l.Opcode.Pos - 1
+		operand = mnemonic + len(l.Opcode.Text)
+	}
+	return len(l.Label.Text), mnemonic, operand, comment
+}
+
+// word is a label or mnemonic on a line, from Start to just before End.
+type word struct {
+	Text       string
+	Start, End int
+	Mnemonic   bool // whether it is in the mnemonic field
+}
+
+// wordAt returns the word at character i of the line, if there is one.
+// Numbers are not words, and neither are the a: and z: that force the size
+// of an operand.
+func wordAt(text string, i int) (word, bool) {
+	_, mnemonic, operand, comment := fields(text)
+	if i > comment {
+		return word{}, false
+	}
+
+	start, end := i, i
+	for start > 0 && syntax.IsLabelChar(text[start-1]) {
+		start--
+	}
+	for end < comment && syntax.IsLabelChar(text[end]) {
+		end++
+	}
+	if start >= operand && end-start > 2 && text[start+1] == ':' && strings.ContainsRune("aAzZ", rune(text[start])) {
+		start += 2
+	}
+	if start == end || text[start] >= '0' && text[start] <= '9' || start > 0 && text[start-1] == '$' {
+		return word{}, false
+	}
+
+	return word{text[start:end], start, end, start >= mnemonic && end <= operand}, true
+}
+
+// findWord returns where name appears, as a whole word, in the part of the
+// line from character from.
+func findWord(text, name string, from int) (int, bool) {
+	for from < len(text) {
+		i := strings.Index(text[from:], name)
+		if i < 0 {
+			break
+		}
+		i += from
+		end := i + len(name)
+		if (i == 0 || !syntax.IsLabelChar(text[i-1])) && (end == len(text) || !syntax.IsLabelChar(text[end])) {
+			return i, true
+		}
+		from = end
+	}
+	return 0, false
+}
+
+// scopeAt returns the global label that local labels on line (counting from
+// 0) of doc belong to: the last one defined before it.
+func (doc *document) scopeAt(line int) string {
+	var scope string
+	var at uint
+	for _, sym := range doc.Result.Symbols {
+		def := sym.Defined
+		if sym.Scope == "" && def.File == "" && def.Line > at && int(def.Line) <= line+1 {
+			scope, at = sym.Name, def.Line
+		}
+	}
+	return scope
+}
+
+// symbolAt returns the symbol named at pos in doc.
+func (doc *document) symbolAt(pos position) (*a2asm.Symbol, word, bool) {
+	if doc.Result == nil || pos.Line >= len(doc.Lines) {
+		return nil, word{}, false
+	}
+
+	w, ok := wordAt(doc.Lines[pos.Line], pos.Character)
+	if !ok || w.Mnemonic {
+		return nil, w, false
+	}
+
+	var scope string
+	if w.Text[0] == ':' || w.Text[0] == '.' {
+		scope = doc.scopeAt(pos.Line)
+	}
+	for i, sym := range doc.Result.Symbols {
+		if sym.Name == w.Text && sym.Scope == scope {
+			return &doc.Result.Symbols[i], w, true
+		}
+	}
+	return nil, w, false
+}
+
+// location returns where name is on the line at pos, searching from the
+// start of the field, or the whole line if it is not found.
+func (doc *document) location(pos a2asm.Position, name string, field func(text string) int) location {
+	line := int(pos.Line) - 1
+	text := doc.lineText(pos)
+
+	r := textRange{position{line, 0}, position{line, len(text)}}
+	if i, ok := findWord(text, name, field(text)); ok {
+		r = textRange{position{line, i}, position{line, i + len(name)}}
+	}
+	return location{doc.uri(pos.File), r}
+}
+
+func labelField(string) int { return 0 }
+
+func operandField(text string) int {
+	_, _, operand, _ := fields(text)
+	return operand
+}
+
+func (srv *Server) definition(p textDocumentPositionParams) []location {
+	doc, ok := srv.docs[p.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+
+	sym, _, ok := doc.symbolAt(p.Position)
+	if !ok || sym.Defined.Line == 0 {
+		return nil
+	}
+	return []location{doc.location(sym.Defined, sym.Name, labelField)}
+}
+
+func (srv *Server) references(p referenceParams) []location {
+	doc, ok := srv.docs[p.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+
+	sym, _, ok := doc.symbolAt(p.Position)
+	if !ok {
+		return nil
+	}
+
+	locations := []location{}
+	if p.Context.IncludeDeclaration && sym.Defined.Line > 0 {
+		locations = append(locations, doc.location(sym.Defined, sym.Name, labelField))
+	}
+	for _, pos := range sym.References {
+		locations = append(locations, doc.location(pos, sym.Name, operandField))
+	}
+	return locations
+}
+
+func (srv *Server) hover(p textDocumentPositionParams) *hover {
+	doc, ok := srv.docs[p.TextDocument.URI]
+	if !ok || p.Position.Line >= len(doc.Lines) {
+		return nil
+	}
+
+	w, ok := wordAt(doc.Lines[p.Position.Line], p.Position.Character)
+	if !ok {
+		return nil
+	}
+	r := textRange{position{p.Position.Line, w.Start}, position{p.Position.Line, w.End}}
+
+	if w.Mnemonic {
+		info, ok := instructions[mnemonic(w.Text)]
+		if !ok {
+			return nil
+		}
+		return &hover{markupContent{"markdown", describeInstruction(mnemonic(w.Text), info)}, &r}
+	}
+
+	sym, _, ok := doc.symbolAt(p.Position)
+	if !ok {
+		return nil
+	}
+	return &hover{markupContent{"markdown", describeSymbol(sym)}, &r}
+}
+
+// mnemonic returns the instruction named by text, without the suffix that
+// forces an absolute address, as in LDA:.
+func mnemonic(text string) string {
+	text = strings.ToUpper(text)
+	if len(text) == 4 && (text[3] < 'A' || text[3] > 'Z') {
+		text = text[:3]
+	}
+	return text
+}
+
+func describeSymbol(sym *a2asm.Symbol) string {
+	name := "**" + sym.Name + "**"
+	if sym.Scope != "" {
+		name += " in " + sym.Scope
+	}
+	if sym.Kind == a2asm.ExternalSymbol {
+		return fmt.Sprintf("%s (%v)", name, sym.Kind)
+	}
+	return fmt.Sprintf("%s (%v) = $%04X (%d)", name, sym.Kind, sym.Value, sym.Value)
+}
+
+func describeInstruction(name string, info instructionInfo) string {
+	var b strings.Builder
+
+	flags := info.Flags
+	if flags == "" {
+		flags = "none"
+	}
+	fmt.Fprintf(&b, "**%s** — %s\n\nFlags: %s\n\n", name, info.Description, flags)
+
+	b.WriteString("| Mode | Syntax | Opcode | Bytes | Cycles |\n")
+	b.WriteString("|------|--------|--------|-------|--------|\n")
+	var extra bool
+	for _, op := range info.Opcodes {
+		syntax := strings.TrimSpace(name + " " + modeSyntax[op.Mode])
+		fmt.Fprintf(&b, "| %s | `%s` | $%02X | %d | %s |\n", op.Mode, syntax, op.Code, modeSize[op.Mode], op.Cycles)
+		extra = extra || strings.HasSuffix(op.Cycles, "+")
+	}
+
+	if extra {
+		if info.Opcodes[0].Mode == relative {
+			b.WriteString("\n+1 cycle if the branch is taken, +2 if to another page.\n")
+		} else {
+			b.WriteString("\n+1 cycle if a page boundary is crossed.\n")
+		}
+	}
+	return b.String()
+}
+
+func (srv *Server) completion(p textDocumentPositionParams) []completionItem {
+	doc, ok := srv.docs[p.TextDocument.URI]
+	if !ok || p.Position.Line >= len(doc.Lines) {
+		return nil
+	}
+
+	text := doc.Lines[p.Position.Line]
+	i := p.Position.Character
+	if i > len(text) {
+		i = len(text)
+	}
+
+	before := text[:i]
+	_, _, _, comment := fields(text)
+	label := strings.IndexAny(before, " \t")
+
+	items := []completionItem{}
+	switch {
+	case label < 0 || i > comment:
+		// New labels and comments.
+
+	case !strings.ContainsAny(strings.TrimLeft(before[label:], " \t"), " \t"):
+		for name, info := range instructions {
+			items = append(items, completionItem{name, completionKeyword, info.Description})
+		}
+		for name, description := range directives {
+			items = append(items, completionItem{name, completionKeyword, description})
+		}
+
+	case doc.Result != nil:
+		scope := doc.scopeAt(p.Position.Line)
+		for _, sym := range doc.Result.Symbols {
+			if sym.Scope != "" && sym.Scope != scope {
+				continue
+			}
+
+			kind := completionFunction
+			switch sym.Kind {
+			case a2asm.ConstantSymbol:
+				kind = completionConstant
+			case a2asm.ExternalSymbol:
+				kind = completionVariable
+			}
+			items = append(items, completionItem{sym.Name, kind, fmt.Sprintf("$%04X %v", sym.Value, sym.Kind)})
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+	return items
+}
+
+func (srv *Server) documentSymbols(p documentSymbolParams) []documentSymbol {
+	doc, ok := srv.docs[p.TextDocument.URI]
+	if !ok || doc.Result == nil {
+		return nil
+	}
+
+	symbols := []documentSymbol{}
+	for _, sym := range doc.symbolsByLine() {
+		line := int(sym.Defined.Line) - 1
+		loc := doc.location(sym.Defined, sym.Name, labelField)
+
+		kind := symbolFunction
+		switch sym.Kind {
+		case a2asm.ConstantSymbol:
+			kind = symbolConstant
+		case a2asm.ExternalSymbol:
+			kind = symbolVariable
+		}
+
+		ds := documentSymbol{
+			Name:           sym.Name,
+			Detail:         fmt.Sprintf("$%04X", sym.Value),
+			Kind:           kind,
+			Range:          doc.lineRange(line),
+			SelectionRange: loc.Range,
+		}
+		if sym.Scope == "" {
+			symbols = append(symbols, ds)
+		} else if n := len(symbols); n > 0 && symbols[n-1].Name == sym.Scope {
+			symbols[n-1].Children = append(symbols[n-1].Children, ds)
+		}
+	}
+	return symbols
+}
+
+// symbolsByLine returns the symbols defined in doc itself, in the order they
+// are defined.
+func (doc *document) symbolsByLine() []a2asm.Symbol {
+	var symbols []a2asm.Symbol
+	for _, sym := range doc.Result.Symbols {
+		if sym.Defined.File == "" && sym.Defined.Line > 0 {
+			symbols = append(symbols, sym)
+		}
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		return symbols[i].Defined.Line < symbols[j].Defined.Line
+	})
+	return symbols
+}
@@ -0,0 +1,201 @@
+package a2asm
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Region is a range of memory, from Start to Last inclusive.
+type Region struct {
+	Name  string
+	Start uint16
+	Last  uint16
+}
+
+// Size returns the number of bytes in the region.
+func (r Region) Size() int {
+	return int(r.Last) - int(r.Start) + 1
+}
+
+func (r Region) String() string {
+	return fmt.Sprintf("$%04X-$%04X %s", r.Start, r.Last, r.Name)
+}
+
+// MemoryMap describes the memory of a target machine: the regions that a
+// program should not be loaded into because something else uses them.
+type MemoryMap struct {
+	Name      string
+	Protected []Region
+}
+
+// Regions shared by the Apple II memory maps.
+var (
+	stackPage   = Region{"stack", 0x0100, 0x01FF}
+	inputBuffer = Region{"input buffer", 0x0200, 0x02FF}
+	textPage1   = Region{"text page 1", 0x0400, 0x07FF}
+	hiresPage1  = Region{"hi-res page 1", 0x2000, 0x3FFF}
+	hiresPage2  = Region{"hi-res page 2", 0x4000, 0x5FFF}
+	ioPage      = Region{"I/O", 0xC000, 0xCFFF}
+)
+
+// MemoryMaps are the targets that programs may be checked against.
+var MemoryMaps = map[string]MemoryMap{
+	"dos33": {"DOS 3.3", []Region{
+		stackPage,
+		inputBuffer,
+		{"DOS and monitor vectors", 0x03D0, 0x03FF},
+		textPage1,
+		hiresPage1,
+		hiresPage2,
+		{"DOS 3.3", 0x9600, 0xBFFF},
+		ioPage,
+		{"ROM", 0xD000, 0xFFFF},
+	}},
+	"prodos": {"ProDOS", []Region{
+		stackPage,
+		inputBuffer,
+		{"ProDOS and monitor vectors", 0x03D0, 0x03FF},
+		textPage1,
+		hiresPage1,
+		hiresPage2,
+		{"BASIC.SYSTEM", 0x9600, 0xBEFF},
+		{"ProDOS global page", 0xBF00, 0xBFFF},
+		ioPage,
+		{"ProDOS and ROM", 0xD000, 0xFFFF},
+	}},
+	"rom": {"ROM", []Region{
+		stackPage,
+		{"soft switches", 0xC000, 0xC0FF},
+	}},
+}
+
+// Overlap is where a segment is loaded into a protected region.
+type Overlap struct {
+	Segment Segment
+	Region  Region
+	Start   uint16
+	Last    uint16
+}
+
+func (o Overlap) String() string {
+	return fmt.Sprintf("segment at $%04X uses $%04X-$%04X, which is reserved for %s ($%04X-$%04X)",
+		o.Segment.Origin, o.Start, o.Last, o.Region.Name, o.Region.Start, o.Region.Last)
+}
+
+// MemoryReport is how a program's segments use a memory map.
+type MemoryReport struct {
+	Map      MemoryMap
+	Overlaps []Overlap
+
+	// Ranges covers all of memory in order, each range named "used", "free"
+	// or after the protected region it is in. Used ranges take precedence.
+	Ranges []Region
+
+	Used int
+	Free int
+}
+
+// Check reports where segments are loaded into protected regions, and what
+// memory they leave free.
+func (m MemoryMap) Check(segments []Segment) (report MemoryReport) {
+	report.Map = m
+
+	const (
+		free = -2
+		used = -1
+	)
+
+	var owner [0x10000]int
+	for i := range owner {
+		owner[i] = free
+	}
+	for i, r := range m.Protected {
+		for addr := int(r.Start); addr <= int(r.Last); addr++ {
+			owner[addr] = i
+		}
+	}
+
+	sorted := append([]Segment(nil), segments...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Origin < sorted[j].Origin
+	})
+
+	for _, seg := range sorted {
+		if len(seg.Data) == 0 {
+			continue
+		}
+		start, last := int(seg.Origin), int(seg.Origin)+len(seg.Data)-1
+
+		for _, r := range m.Protected {
+			lo, hi := max(start, int(r.Start)), min(last, int(r.Last))
+			if lo <= hi {
+				report.Overlaps = append(report.Overlaps, Overlap{seg, r, uint16(lo), uint16(hi)})
+			}
+		}
+
+		for addr := start; addr <= last && addr < len(owner); addr++ {
+			owner[addr] = used
+		}
+	}
+
+	name := func(o int) string {
+		switch o {
+		case free:
+			return "free"
+		case used:
+			return "used"
+		}
+		return m.Protected[o].Name
+	}
+
+	start := 0
+	for addr := 1; addr <= len(owner); addr++ {
+		if addr < len(owner) && owner[addr] == owner[start] {
+			continue
+		}
+
+		r := Region{name(owner[start]), uint16(start), uint16(addr - 1)}
+		report.Ranges = append(report.Ranges, r)
+		switch owner[start] {
+		case free:
+			report.Free += r.Size()
+		case used:
+			report.Used += r.Size()
+		}
+		start = addr
+	}
+
+	return
+}
+
+// WriteSummary writes the ranges of memory, one per line, followed by the
+// number of bytes used and free.
+func (report MemoryReport) WriteSummary(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "Memory map: %s\n", report.Map.Name); err != nil {
+		return err
+	}
+
+	for _, r := range report.Ranges {
+		if _, err := fmt.Fprintf(w, "  $%04X-$%04X  %5d bytes  %s\n", r.Start, r.Last, r.Size(), r.Name); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "%d bytes used, %d bytes free\n", report.Used, report.Free)
+	return err
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
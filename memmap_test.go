@@ -0,0 +1,67 @@
+package a2asm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMemoryMapOverlaps(t *testing.T) {
+	segments := []Segment{
+		{0x0300, make([]byte, 0x100)},
+		{0x0800, make([]byte, 0x10)},
+		{0x95F0, make([]byte, 0x20)},
+	}
+
+	report := MemoryMaps["dos33"].Check(segments)
+
+	expected := []string{
+		"segment at $0300 uses $03D0-$03FF, which is reserved for DOS and monitor vectors ($03D0-$03FF)",
+		"segment at $95F0 uses $9600-$960F, which is reserved for DOS 3.3 ($9600-$BFFF)",
+	}
+
+	if len(report.Overlaps) != len(expected) {
+		t.Fatalf("Expected %q; got %v", expected, report.Overlaps)
+	}
+	for i, overlap := range report.Overlaps {
+		if overlap.String() != expected[i] {
+			t.Errorf("Expected %q; got %q", expected[i], overlap)
+		}
+	}
+
+	if report.Used != 0x130 {
+		t.Errorf("Expected $130 bytes used; got $%X", report.Used)
+	}
+}
+
+func TestMemoryMapSummary(t *testing.T) {
+	report := MemoryMaps["rom"].Check([]Segment{{0xF800, make([]byte, 0x800)}})
+
+	var out bytes.Buffer
+	if err := report.WriteSummary(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `Memory map: ROM
+  $0000-$00FF    256 bytes  free
+  $0100-$01FF    256 bytes  stack
+  $0200-$BFFF  48640 bytes  free
+  $C000-$C0FF    256 bytes  soft switches
+  $C100-$F7FF  14080 bytes  free
+  $F800-$FFFF   2048 bytes  used
+2048 bytes used, 62976 bytes free
+`
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+	}
+}
+
+func TestWraparound(t *testing.T) {
+	_, err := AssembleSegments(strings.NewReader(`
+		ORG $FFFE
+		JMP $1234
+`))
+	if err == nil || err.Error() != "line 3 - code wraps around past $FFFF" {
+		t.Errorf("Expected wraparound error; got %v", err)
+	}
+}
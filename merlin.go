@@ -0,0 +1,110 @@
+package a2asm
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/taeber/a2asm/syntax"
+)
+
+// MERLIN saves source as DOS 3.3 (or ProDOS) text: every character has its
+// high bit set, lines end with a carriage return ($8D) and the label, opcode,
+// operand and comment fields are separated by a single space. The editor
+// tabs the fields into columns only when displaying them.
+
+const merlinReturn = '\r' | highASCII
+
+// readSource returns src as plain text, translating it first if it is in
+// native MERLIN format or uses carriage returns for line endings.
+func readSource(src io.Reader) io.Reader {
+	r := bufio.NewReader(src)
+	head, _ := r.Peek(512)
+
+	if IsMerlinNative(head) || (bytes.IndexByte(head, '\r') >= 0 && bytes.IndexByte(head, '\n') < 0) {
+		return merlinReader{r}
+	}
+
+	return r
+}
+
+// merlinReader clears the high bit of each character, turns carriage returns
+// into newlines and stops at the NUL padding the end of a DOS 3.3 text file.
+type merlinReader struct {
+	r io.Reader
+}
+
+func (m merlinReader) Read(p []byte) (n int, err error) {
+	n, err = m.r.Read(p)
+	for i := 0; i < n; i++ {
+		ch := p[i] &^ highASCII
+		switch ch {
+		case 0:
+			return i, io.EOF
+		case '\r':
+			ch = '\n'
+		}
+		p[i] = ch
+	}
+	return
+}
+
+// IsMerlinNative reports whether text looks like native MERLIN source, that
+// is, most of its characters have the high bit set.
+func IsMerlinNative(text []byte) bool {
+	var high, total int
+	for _, ch := range text {
+		if ch == 0 {
+			break
+		}
+		total++
+		if ch&highASCII != 0 {
+			high++
+		}
+	}
+
+	return total > 0 && high*2 > total
+}
+
+// MerlinToText converts native MERLIN source to plain text with the fields of
+// each line separated by tabs.
+func MerlinToText(native []byte) []byte {
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(merlinReader{bytes.NewReader(native)})
+	for scanner.Scan() {
+		fields := splitMerlinFields(scanner.Text())
+		out.WriteString(strings.TrimRight(strings.Join(fields[:], "\t"), "\t"))
+		out.WriteByte('\n')
+	}
+
+	return out.Bytes()
+}
+
+// TextToMerlin converts plain text source to native MERLIN format.
+func TextToMerlin(text []byte) []byte {
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(text))
+	for scanner.Scan() {
+		fields := splitMerlinFields(strings.TrimRight(scanner.Text(), "\r"))
+		line := strings.TrimRight(strings.Join(fields[:], " "), " ")
+		for i := 0; i < len(line); i++ {
+			out.WriteByte(line[i] | highASCII)
+		}
+		out.WriteByte(merlinReturn)
+	}
+
+	return out.Bytes()
+}
+
+// splitMerlinFields splits a line into its label, opcode, operand and comment
+// fields. Whole-line comments starting in the first column are returned in
+// the label field.
+func splitMerlinFields(line string) (fields [4]string) {
+	l := syntax.SplitLine(0, line)
+	if l.IsComment() && l.Comment.Pos == 1 {
+		fields[0] = l.Comment.Text
+		return
+	}
+	return [4]string{l.Label.Text, l.Opcode.Text, l.Operand.Text, l.Comment.Text}
+}
@@ -0,0 +1,56 @@
+package a2asm
+
+import (
+	"bytes"
+	"testing"
+)
+
+func highBit(text string) []byte {
+	native := []byte(text)
+	for i := range native {
+		native[i] |= highASCII
+	}
+	return native
+}
+
+func TestAssembleNative(t *testing.T) {
+	native := highBit("* BELL\r ORG $300\rBELL EQU $FBDD\rSTART JSR BELL\rLOOP\r RTS ; DONE\r")
+	native = append(native, 0, 0, 0)
+
+	out := bytes.NewBuffer(nil)
+	if _, err := Assemble(out, bytes.NewReader(native), true); err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := []byte("\x20\xDD\xFB\x60")
+	actual := out.Bytes()
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("Expected %v; got %v", expected, actual)
+	}
+}
+
+func TestMerlinConversion(t *testing.T) {
+	text := "* HELLO\n" +
+		"START\tLDA\t#\" \"\t; SPACE\n" +
+		"\tASC\t\"HI THERE\"\n" +
+		"\n" +
+		"\tRTS\n"
+	native := highBit("* HELLO\r" +
+		"START LDA #\" \" ; SPACE\r" +
+		" ASC \"HI THERE\"\r" +
+		"\r" +
+		" RTS\r")
+
+	if actual := TextToMerlin([]byte(text)); !bytes.Equal(native, actual) {
+		t.Errorf("Expected %q; got %q", native, actual)
+	}
+
+	if actual := MerlinToText(native); !bytes.Equal([]byte(text), actual) {
+		t.Errorf("Expected %q; got %q", text, actual)
+	}
+
+	if !IsMerlinNative(native) || IsMerlinNative([]byte(text)) {
+		t.Error("Expected only the native source to be detected as native")
+	}
+}
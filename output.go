@@ -0,0 +1,78 @@
+package a2asm
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// Segment is a contiguous run of assembled bytes that loads at Origin.
+type Segment struct {
+	Origin uint16
+	Data   []byte
+}
+
+// End returns the address just past the last byte of the segment.
+func (seg Segment) End() int {
+	return int(seg.Origin) + len(seg.Data)
+}
+
+// WriteImage writes segments to dst as one contiguous image spanning the
+// lowest to the highest assembled address. Gaps between segments are filled
+// with zeros. Unless headless, the image is prefixed with the 4-byte DOS 3.3
+// header comprising its origin and length.
+func WriteImage(dst io.Writer, segments []Segment, headless bool) (written uint, err error) {
+	if len(segments) == 0 {
+		return writeRecord(dst, Segment{}, headless)
+	}
+
+	start, end := int(segments[0].Origin), segments[0].End()
+	for _, seg := range segments[1:] {
+		if int(seg.Origin) < start {
+			start = int(seg.Origin)
+		}
+		if seg.End() > end {
+			end = seg.End()
+		}
+	}
+
+	image := make([]byte, end-start)
+	for _, seg := range segments {
+		copy(image[int(seg.Origin)-start:], seg.Data)
+	}
+
+	return writeRecord(dst, Segment{uint16(start), image}, headless)
+}
+
+// WriteRecords writes each segment to dst in order as its own record: the
+// 4-byte DOS 3.3 header (origin and length) followed by the segment's bytes.
+func WriteRecords(dst io.Writer, segments []Segment) (written uint, err error) {
+	for _, seg := range segments {
+		var n uint
+		n, err = writeRecord(dst, seg, false)
+		written += n
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func writeRecord(dst io.Writer, seg Segment, headless bool) (written uint, err error) {
+	if !headless {
+		if err = binary.Write(dst, binary.LittleEndian, seg.Origin); err != nil {
+			return
+		}
+		written += 2
+
+		if err = binary.Write(dst, binary.LittleEndian, uint16(len(seg.Data))); err != nil {
+			return
+		}
+		written += 2
+	}
+
+	n, err := dst.Write(seg.Data)
+	written += uint(n)
+
+	return
+}
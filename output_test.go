@@ -0,0 +1,46 @@
+package a2asm
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteImage(t *testing.T) {
+	out := bytes.NewBuffer(nil)
+	segments := []Segment{
+		{0x303, []byte("\x60")},
+		{0x300, []byte("\xEA\xEA")},
+	}
+
+	n, err := WriteImage(out, segments, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := []byte("\x00\x03\x04\x00\xEA\xEA\x00\x60")
+	actual := out.Bytes()
+	if !bytes.Equal(expected, actual) || n != uint(len(expected)) {
+		t.Errorf("Expected %v; got %v (%d)", expected, actual, n)
+	}
+}
+
+func TestWriteRecords(t *testing.T) {
+	out := bytes.NewBuffer(nil)
+	segments := []Segment{
+		{0x300, []byte("\xEA\xEA")},
+		{0x303, []byte("\x60")},
+	}
+
+	n, err := WriteRecords(out, segments)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := []byte("\x00\x03\x02\x00\xEA\xEA\x03\x03\x01\x00\x60")
+	actual := out.Bytes()
+	if !bytes.Equal(expected, actual) || n != uint(len(expected)) {
+		t.Errorf("Expected %v; got %v (%d)", expected, actual, n)
+	}
+}
@@ -0,0 +1,441 @@
+package a2asm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// A REL file is Merlin's relocatable object format, produced when a source
+// uses the REL directive and consumed by the linker. Its layout is:
+//
+//	origin (2 bytes)   always $8000, the address the code was assembled at
+//	length (2 bytes)   number of bytes of object code
+//	object code
+//	relocation dictionary (RLD), terminated by $00
+//	external symbol dictionary (ESD), terminated by $00
+//
+// Each RLD entry is 4 bytes: flags, the offset of the field within the code
+// (low, high), and either the low byte of the value (for high-byte fields)
+// or the ESD number of the external symbol it refers to.
+//
+// Each ESD entry is the symbol's name with the high bit set on all but the
+// last character, a flags byte, and 2 bytes: the address of an ENTry, or the
+// number of an EXTernal followed by $00.
+
+// relOrigin is the address relocatable code is assembled at. It keeps labels
+// out of zero page so that the linker can always relocate them.
+const relOrigin = 0x8000
+
+// RLD entry flags
+const (
+	rldTwoBytes = 0x80
+	rldHighByte = 0x40
+	rldReversed = 0x20
+	rldExternal = 0x10
+	rldInUse    = 0x01 // keeps an entry from looking like the terminator
+)
+
+// ESD entry flags
+const (
+	esdExternal = 0x10
+	esdEntry    = 0x08
+)
+
+// Object is the result of assembling a source. Sources using REL also carry
+// what the linker needs: relocations, ENTry points and EXTernal symbols.
+type Object struct {
+	// Name identifies the object in link errors.
+	Name string
+
+	Segments    []Segment
+	Relocatable bool
+
+	// Relocations, Entries and Externals are only set when Relocatable.
+	Relocations []Relocation
+	Entries     map[string]uint16 // offset of each ENT label within the code
+	Externals   []string          // EXT labels, in the order declared
+}
+
+// Relocation is a field within relocatable code that the linker must adjust.
+type Relocation struct {
+	Offset   uint16 // of the field within the code
+	TwoBytes bool
+	HighByte bool   // one-byte field holding the high byte of the value
+	Reversed bool   // two-byte field stored high byte first, as by DDB
+	Low      byte   // low byte of the value, needed to relocate HighByte
+	External string // name of the EXT symbol the field refers to, if any
+}
+
+// relocation is a field noted during assembly that may need relocating once
+// it is known whether its label is an address or a constant.
+type relocation struct {
+	Address  address
+	Size     uint16
+	HighByte bool
+	Reversed bool
+	Name     string
+	Value    uint16 // full value, or the offset from Name when not Resolved
+	Resolved bool
+}
+
+// AssembleObject reads MERLIN-style 6502 assembly from src and returns the
+// assembled object. For REL sources, this is what WriteREL saves for linking.
+func AssembleObject(src io.Reader) (*Object, error) {
+	result, err := AssembleWithOptions(src, Options{})
+	if err != nil {
+		return nil, err
+	}
+	return result.Object, nil
+}
+
+// newObject returns the object assembled into s.
+func newObject(s *state) (obj *Object) {
+	obj = &Object{Relocatable: s.Relocatable}
+	for _, span := range s.Segments {
+		obj.Segments = append(obj.Segments, Segment{
+			Origin: span.Start,
+			Data:   s.Memory[span.Start:span.End],
+		})
+	}
+
+	if !s.Relocatable {
+		return
+	}
+
+	obj.Entries = make(map[string]uint16)
+	for _, name := range s.Entries {
+		obj.Entries[name] = s.Labels[name] - relOrigin
+	}
+
+	obj.Externals = make([]string, len(s.Externals))
+	for name, num := range s.Externals {
+		obj.Externals[num-1] = name
+	}
+
+	for _, r := range s.Relocations {
+		reloc := Relocation{
+			Offset:   r.Address - relOrigin,
+			TwoBytes: r.Size == 2,
+			HighByte: r.HighByte,
+			Reversed: r.Reversed,
+			Low:      byte(r.Value),
+		}
+		if s.isExternal(r.Name) {
+			reloc.External = trimSelector(r.Name)
+		}
+		obj.Relocations = append(obj.Relocations, reloc)
+	}
+
+	return
+}
+
+// Code returns the object code of a relocatable object.
+func (obj *Object) Code() []byte {
+	if len(obj.Segments) == 0 {
+		return nil
+	}
+	return obj.Segments[0].Data
+}
+
+// WriteREL writes obj to dst in Merlin's REL file format.
+func (obj *Object) WriteREL(dst io.Writer) (written uint, err error) {
+	if !obj.Relocatable {
+		return 0, fmt.Errorf("%s is not relocatable; missing REL", obj.Name)
+	}
+
+	code := obj.Code()
+
+	buf := bytes.NewBuffer(nil)
+	binary.Write(buf, binary.LittleEndian, uint16(relOrigin))
+	binary.Write(buf, binary.LittleEndian, uint16(len(code)))
+	buf.Write(code)
+
+	esd := make(map[string]byte)
+	for i, name := range obj.Externals {
+		esd[name] = byte(i + 1)
+	}
+
+	for _, r := range obj.Relocations {
+		flags := byte(rldInUse)
+		extra := r.Low
+		if r.TwoBytes {
+			flags |= rldTwoBytes
+		}
+		if r.HighByte {
+			flags |= rldHighByte
+		}
+		if r.Reversed {
+			flags |= rldReversed
+		}
+		if r.External != "" {
+			flags |= rldExternal
+			extra = esd[r.External]
+		}
+		buf.Write([]byte{flags, byte(r.Offset), byte(r.Offset >> 8), extra})
+	}
+	buf.WriteByte(0)
+
+	entries := make([]string, 0, len(obj.Entries))
+	for name := range obj.Entries {
+		entries = append(entries, name)
+	}
+	sort.Strings(entries)
+
+	for _, name := range entries {
+		writeESDName(buf, name)
+		value := obj.Entries[name] + relOrigin
+		buf.Write([]byte{esdEntry, byte(value), byte(value >> 8)})
+	}
+	for i, name := range obj.Externals {
+		writeESDName(buf, name)
+		buf.Write([]byte{esdExternal, byte(i + 1), 0})
+	}
+	buf.WriteByte(0)
+
+	n, err := dst.Write(buf.Bytes())
+	return uint(n), err
+}
+
+func writeESDName(buf *bytes.Buffer, name string) {
+	for i := 0; i < len(name)-1; i++ {
+		buf.WriteByte(name[i] | highASCII)
+	}
+	buf.WriteByte(name[len(name)-1] &^ highASCII)
+}
+
+// ReadObject reads a REL file written by WriteREL (or Merlin).
+func ReadObject(src io.Reader) (obj *Object, err error) {
+	r := bufio.NewReader(src)
+
+	var header struct {
+		Origin uint16
+		Length uint16
+	}
+	if err = binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("reading REL header: %v", err)
+	}
+
+	code := make([]byte, header.Length)
+	if _, err = io.ReadFull(r, code); err != nil {
+		return nil, fmt.Errorf("reading REL code: %v", err)
+	}
+
+	obj = &Object{
+		Segments:    []Segment{{relOrigin, code}},
+		Relocatable: true,
+		Entries:     make(map[string]uint16),
+	}
+
+	var rld [][4]byte
+	for {
+		var entry [4]byte
+		if entry[0], err = r.ReadByte(); err != nil {
+			return nil, fmt.Errorf("reading REL relocation dictionary: %v", err)
+		}
+		if entry[0] == 0 {
+			break
+		}
+		if _, err = io.ReadFull(r, entry[1:]); err != nil {
+			return nil, fmt.Errorf("reading REL relocation dictionary: %v", err)
+		}
+		rld = append(rld, entry)
+	}
+
+	externals := make(map[byte]string)
+	for {
+		var name []byte
+		var ch byte
+		for {
+			if ch, err = r.ReadByte(); err != nil {
+				return nil, fmt.Errorf("reading REL symbol dictionary: %v", err)
+			}
+			if ch == 0 && len(name) == 0 {
+				break
+			}
+			name = append(name, ch&^highASCII)
+			if ch&highASCII == 0 {
+				break
+			}
+		}
+		if len(name) == 0 {
+			break
+		}
+
+		var entry [3]byte
+		if _, err = io.ReadFull(r, entry[:]); err != nil {
+			return nil, fmt.Errorf("reading REL symbol dictionary: %v", err)
+		}
+
+		switch {
+		case entry[0]&esdEntry != 0:
+			obj.Entries[string(name)] = binary.LittleEndian.Uint16(entry[1:]) - header.Origin
+		case entry[0]&esdExternal != 0:
+			externals[entry[1]] = string(name)
+			obj.Externals = append(obj.Externals, string(name))
+		}
+	}
+
+	for _, entry := range rld {
+		reloc := Relocation{
+			Offset:   binary.LittleEndian.Uint16(entry[1:3]),
+			TwoBytes: entry[0]&rldTwoBytes != 0,
+			HighByte: entry[0]&rldHighByte != 0,
+			Reversed: entry[0]&rldReversed != 0,
+		}
+		if entry[0]&rldExternal != 0 {
+			name, ok := externals[entry[3]]
+			if !ok {
+				return nil, fmt.Errorf("relocation refers to unknown external symbol #%d", entry[3])
+			}
+			reloc.External = name
+		} else {
+			reloc.Low = entry[3]
+		}
+		obj.Relocations = append(obj.Relocations, reloc)
+	}
+
+	return obj, nil
+}
+
+// rel handles the REL directive, which makes the output relocatable.
+func (s *state) rel() error {
+	if s.Written > 0 || len(s.Segments) > 0 {
+		return fmt.Errorf("REL must come before any code")
+	}
+
+	s.Relocatable = true
+	s.Origin = relOrigin
+	s.Address = relOrigin
+	return nil
+}
+
+// ent handles the ENT directive, which exports the label on the line or the
+// comma-separated labels in the operand to other modules.
+func (s *state) ent(label, operand string) error {
+	if !s.Relocatable {
+		return fmt.Errorf("ENT requires REL")
+	}
+
+	if label != "" {
+		s.Entries = append(s.Entries, label)
+	}
+
+	if operand == "" {
+		if label == "" {
+			return fmt.Errorf("ENT needs a label")
+		}
+		return nil
+	}
+
+	for _, name := range strings.Split(operand, ",") {
+		s.Entries = append(s.Entries, name)
+	}
+
+	return nil
+}
+
+// ext handles the EXT directive, which declares the label on the line as
+// defined by another module.
+func (s *state) ext(label string) error {
+	if !s.Relocatable {
+		return fmt.Errorf("EXT requires REL")
+	}
+
+	if label == "" {
+		return fmt.Errorf("EXT needs a label")
+	}
+
+	if len(s.Externals) == 0xFF {
+		return fmt.Errorf("too many external labels")
+	}
+
+	delete(s.Labels, label)
+	s.Externals[label] = byte(len(s.Externals) + 1)
+	return nil
+}
+
+func (s *state) isExternal(ref string) bool {
+	if ref == "" {
+		return false
+	}
+	_, ok := s.Externals[trimSelector(ref)]
+	return ok
+}
+
+// trimSelector removes a leading < or > byte selector from ref.
+func trimSelector(ref string) string {
+	if ref != "" && (ref[0] == '<' || ref[0] == '>') {
+		return ref[1:]
+	}
+	return ref
+}
+
+// relocate notes that the size-byte field at addr refers to ref, in case it
+// needs relocating by the linker, and returns the note.
+func (s *state) relocate(ref string, addr address, size uint16, value uint16, resolved bool) *relocation {
+	if !s.Relocatable || ref == "" || size == 0 {
+		return nil
+	}
+
+	r := &relocation{
+		Address:  addr,
+		Size:     size,
+		HighByte: size == 1 && ref[0] == '>',
+		Name:     ref,
+		Value:    value,
+		Resolved: resolved,
+	}
+	s.Relocations = append(s.Relocations, r)
+	return r
+}
+
+// finishRelocations checks the ENTry labels and keeps only the relocations
+// that refer to addresses within the object or to external labels.
+func (s *state) finishRelocations() error {
+	if !s.Relocatable {
+		return nil
+	}
+
+	for _, name := range s.Entries {
+		if _, ok := s.Labels[name]; !ok {
+			return s.errorf("unknown entry label: %s", name)
+		}
+	}
+
+	var relocations []*relocation
+	for _, r := range s.Relocations {
+		name := trimSelector(r.Name)
+
+		switch {
+		case s.isExternal(name):
+		case name == "*":
+			if !r.Resolved {
+				r.Value += r.Address - 1
+			}
+		default:
+			addr, ok := s.Labels[name]
+			if !ok {
+				// Constants stay as they are.
+				continue
+			}
+			if !r.Resolved {
+				r.Value += addr
+			}
+		}
+
+		relocations = append(relocations, r)
+	}
+
+	// Data fixed up at the end is noted last, so put them back in order.
+	sort.SliceStable(relocations, func(i, j int) bool {
+		return relocations[i].Address < relocations[j].Address
+	})
+
+	s.Relocations = relocations
+	return nil
+}
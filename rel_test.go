@@ -0,0 +1,85 @@
+package a2asm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestREL(t *testing.T) {
+	obj, err := AssembleObject(strings.NewReader(`
+		REL
+COUT	EXT
+START	ENT
+		LDA #>MSG
+		LDY #<MSG
+		JSR COUT
+		JMP START
+MSG		RTS
+	`))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !obj.Relocatable {
+		t.Error("Expected a relocatable object")
+		return
+	}
+
+	expected := []byte("\xA9\x80\xA0\x0A\x20\x00\x00\x4C\x00\x80\x60")
+	if !bytes.Equal(expected, obj.Code()) {
+		t.Errorf("Expected %v; got %v", expected, obj.Code())
+	}
+
+	if obj.Entries["START"] != 0 {
+		t.Errorf("Expected START at offset 0; got %d", obj.Entries["START"])
+	}
+
+	if len(obj.Externals) != 1 || obj.Externals[0] != "COUT" {
+		t.Errorf("Expected COUT to be external; got %v", obj.Externals)
+	}
+
+	if len(obj.Relocations) != 4 {
+		t.Errorf("Expected 4 relocations; got %v", obj.Relocations)
+	}
+
+	out := bytes.NewBuffer(nil)
+	if _, err = obj.WriteREL(out); err != nil {
+		t.Error(err)
+		return
+	}
+
+	read, err := ReadObject(out)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !bytes.Equal(obj.Code(), read.Code()) {
+		t.Errorf("Expected %v; got %v", obj.Code(), read.Code())
+	}
+
+	if len(read.Relocations) != len(obj.Relocations) {
+		t.Errorf("Expected %v; got %v", obj.Relocations, read.Relocations)
+	}
+
+	for i := range read.Relocations {
+		if read.Relocations[i] != obj.Relocations[i] {
+			t.Errorf("Expected %v; got %v", obj.Relocations[i], read.Relocations[i])
+		}
+	}
+
+	if read.Entries["START"] != 0 || read.Externals[0] != "COUT" {
+		t.Errorf("Wrong symbols: %v %v", read.Entries, read.Externals)
+	}
+}
+
+func TestRELRequiresREL(t *testing.T) {
+	_, err := AssembleObject(strings.NewReader(`
+COUT	EXT
+	`))
+	if err == nil {
+		t.Error("Expected EXT without REL to be an error")
+	}
+}
@@ -0,0 +1,308 @@
+package a2asm
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+)
+
+// Options control how AssembleWithOptions assembles a source.
+type Options struct {
+	// Name is the name of the source. When AssembleWithOptions is given no
+	// source, it is opened by this name with Open.
+	Name string
+
+	// Open opens the files included with PUT and USE.
+	Open Opener
+
+	// FS, if set, is used in place of Open. Name is then a path in FS and
+	// files are included from its directory. The included files are named
+	// by their paths in FS too, as the source is.
+	FS fs.FS
+
+	// Charset is the character set that SCR, INV, FLS and MTX encode for
+	// until a CHARSET directive says otherwise: IIE (the default), II+ or
+	// IIE-ALT.
+	Charset string
+
+	// Warnings turns categories of warning on or off by name. The rest of
+	// the WarningCategories keep their Default.
+	Warnings map[string]bool
+
+	// Locals includes local labels in the Result's Symbols.
+	Locals bool
+
+	// Target names the entry of MemoryMaps to check the segments against.
+	// Each segment in a protected region gives a warning. REL sources are
+	// not checked, as they are placed by the linker.
+	Target string
+}
+
+// Result is everything learned from assembling a source: the object, with its
+// segments, along with the symbols defined, the address and bytes of each
+// line, and any warnings. Use WriteImage, WriteRecords or WriteREL to save it.
+type Result struct {
+	*Object
+
+	// CPU is the instruction set assembled for, which is always "6502".
+	CPU string
+
+	Symbols  []Symbol // in order of name, locals following their scope
+	Lines    []Line   // in the order read, including those of PUT files
+	Warnings []Warning
+}
+
+// SymbolKind says what a symbol stands for.
+type SymbolKind int
+
+// Symbol kinds
+const (
+	LabelSymbol    SymbolKind = iota // the address of a line
+	ConstantSymbol                   // defined with EQU or in a DUM section
+	ExternalSymbol                   // declared with EXT
+)
+
+func (kind SymbolKind) String() string {
+	switch kind {
+	case LabelSymbol:
+		return "label"
+	case ConstantSymbol:
+		return "constant"
+	case ExternalSymbol:
+		return "external"
+	}
+	return fmt.Sprintf("SymbolKind(%d)", int(kind))
+}
+
+// Symbol is a name defined by the source.
+type Symbol struct {
+	Name  string
+	Value uint16 // zero for externals
+	Kind  SymbolKind
+	Scope string // the global label a local label belongs to
+
+	Defined    Position   // the line that defines it
+	References []Position // the lines that refer to it, in the order read
+}
+
+// Position is a line of a source file. File is the PUT or USE file, or empty
+// for the source itself.
+type Position struct {
+	File string
+	Line uint
+}
+
+// Line is a line of source and what was assembled from it.
+type Line struct {
+	File    string // the Options.Name or PUT file the line is in
+	Number  uint
+	Text    string
+	Address uint16 // of the bytes, or the address after the line if none
+	Bytes   []byte
+}
+
+// Warning is a problem with the source that did not stop it assembling.
+type Warning struct {
+	File     string
+	Line     uint
+	Message  string
+	Category string // the Name of one of the WarningCategories
+}
+
+func (w Warning) String() string {
+	msg := fmt.Sprintf("%s [%s]", w.Message, w.Category)
+	if w.Line > 0 {
+		// Warnings about the whole program have no line.
+		msg = fmt.Sprintf("line %d - %s", w.Line, msg)
+	}
+	if w.File != "" {
+		msg = w.File + ": " + msg
+	}
+	return msg
+}
+
+// lineRecord is where a line was assembled; its bytes are read at the end,
+// once they have been fixed up.
+type lineRecord struct {
+	File    string
+	Number  uint
+	Text    string
+	Address address
+	Size    int
+}
+
+// AssembleWithOptions reads MERLIN-style 6502 assembly from src, or from the
+// file named by opts.Name if src is nil, and returns the result.
+func AssembleWithOptions(src io.Reader, opts Options) (*Result, error) {
+	// dir is the directory, within opts.FS, that the names of the source and
+	// the files it includes are recorded under.
+	var dir string
+	if opts.FS != nil {
+		dir = path.Dir(opts.Name)
+		sub, err := fs.Sub(opts.FS, dir)
+		if err != nil {
+			return nil, err
+		}
+		opts.Open = FSOpener(sub)
+
+		if src == nil {
+			fp, opened, err := openSource(opts.Open, path.Base(opts.Name))
+			if err != nil {
+				return nil, err
+			}
+			defer fp.Close()
+
+			src, opts.Name = fp, path.Join(dir, opened)
+		}
+	}
+
+	if src == nil {
+		if opts.Open == nil {
+			return nil, fmt.Errorf("no source to assemble")
+		}
+
+		fp, opened, err := openSource(opts.Open, opts.Name)
+		if err != nil {
+			return nil, err
+		}
+		defer fp.Close()
+
+		src, opts.Name = fp, opened
+	}
+
+	s, err := assemble(src, dir, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Object: newObject(s), CPU: "6502"}
+	result.Object.Name = opts.Name
+	result.Symbols = s.symbols(opts.Locals)
+
+	for _, rec := range s.Lines {
+		file := rec.File
+		if file == "" {
+			file = opts.Name
+		}
+		result.Lines = append(result.Lines, Line{
+			File:    file,
+			Number:  rec.Number,
+			Text:    rec.Text,
+			Address: rec.Address,
+			Bytes:   s.Memory[int(rec.Address) : int(rec.Address)+rec.Size],
+		})
+	}
+
+	if opts.Target != "" && !s.Relocatable {
+		memory, ok := MemoryMaps[opts.Target]
+		if !ok {
+			return nil, fmt.Errorf("unknown target: %s", opts.Target)
+		}
+		for _, overlap := range memory.Check(result.Segments).Overlaps {
+			s.warnAt(Position{"", s.segmentLine(overlap.Segment.Origin)}, WarnMemory, "%v", overlap)
+		}
+	}
+
+	// Warnings found at the end are put with those of their line.
+	order := make(map[Position]int)
+	for i, rec := range s.Lines {
+		order[Position{rec.File, rec.Number}] = i
+	}
+	sort.SliceStable(s.Warnings, func(i, j int) bool {
+		a, b := s.Warnings[i], s.Warnings[j]
+		return order[Position{a.File, a.Line}] < order[Position{b.File, b.Line}]
+	})
+	result.Warnings = s.Warnings
+
+	return result, nil
+}
+
+// noteLine records where a line was assembled, given the address and count
+// of bytes written before it.
+func (s *state) noteLine(file string, number uint, text string, start address, written uint16) {
+	rec := lineRecord{file, number, text, start, int(s.Written - written)}
+	if rec.Size == 0 {
+		rec.Address = s.Address
+	}
+	s.Lines = append(s.Lines, rec)
+}
+
+// segmentLine returns the line number of the ORG that started the segment
+// at origin.
+func (s *state) segmentLine(origin address) uint {
+	for _, span := range s.Segments {
+		if span.Start == origin {
+			return span.LineNumber
+		}
+	}
+	return 0
+}
+
+// symbols returns the labels, constants and externals in order of name,
+// with local labels, if wanted, following the global label they belong to.
+func (s *state) symbols(locals bool) (symbols []Symbol) {
+	add := func(name string, value uint16, kind SymbolKind) {
+		scope := s.Definitions[name].Scope
+		if scope != "" && !locals {
+			return
+		}
+		def := s.Definitions[name]
+		symbols = append(symbols, Symbol{
+			Name:       name[len(scope):],
+			Value:      value,
+			Kind:       kind,
+			Scope:      scope,
+			Defined:    Position{def.File, def.LineNumber},
+			References: s.Uses[name],
+		})
+	}
+
+	for name, value := range s.Labels {
+		if _, ok := s.Constants[name]; !ok {
+			add(name, value, LabelSymbol)
+		}
+	}
+	for name, value := range s.Constants {
+		add(name, value, ConstantSymbol)
+	}
+	for name := range s.Externals {
+		add(name, 0, ExternalSymbol)
+	}
+
+	// Order by the global label each symbol is or belongs to, the global
+	// label first, then by name.
+	global := func(sym Symbol) string {
+		if sym.Scope != "" {
+			return sym.Scope
+		}
+		return sym.Name
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		a, b := symbols[i], symbols[j]
+		if global(a) != global(b) {
+			return global(a) < global(b)
+		}
+		if (a.Scope == "") != (b.Scope == "") {
+			return a.Scope == ""
+		}
+		return a.Name < b.Name
+	})
+	return
+}
+
+// WriteSymbols writes the symbol table, one symbol per line with local labels
+// indented beneath their scope.
+func (result *Result) WriteSymbols(w io.Writer) error {
+	for _, sym := range result.Symbols {
+		name := sym.Name
+		if sym.Scope != "" {
+			name = "  " + name
+		}
+		if _, err := fmt.Fprintf(w, "%-16s $%04X  %s\n", name, sym.Value, sym.Kind); err != nil {
+			return err
+		}
+	}
+	return nil
+}
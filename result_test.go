@@ -0,0 +1,200 @@
+package a2asm
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestAssembleWithOptions(t *testing.T) {
+	result, err := AssembleWithOptions(strings.NewReader(`
+COUT	EQU $FDED
+		ORG $300
+START	LDA #"A"
+		JSR COUT
+		JMP START
+`), Options{Name: "BELL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.CPU != "6502" {
+		t.Errorf("Expected CPU 6502; got %s", result.CPU)
+	}
+
+	if len(result.Segments) != 1 || result.Segments[0].Origin != 0x300 || len(result.Segments[0].Data) != 8 {
+		t.Errorf("Expected one 8-byte segment at $300; got %v", result.Segments)
+	}
+
+	expectedSymbols := []Symbol{
+		{"COUT", 0xFDED, ConstantSymbol, "", Position{"", 2}, []Position{{"", 5}}},
+		{"START", 0x300, LabelSymbol, "", Position{"", 4}, []Position{{"", 6}}},
+	}
+	if !reflect.DeepEqual(expectedSymbols, result.Symbols) {
+		t.Errorf("Expected %v; got %v", expectedSymbols, result.Symbols)
+	}
+
+	expectedLines := []Line{
+		{"BELL", 1, "", 0, nil},
+		{"BELL", 2, "COUT\tEQU $FDED", 0, nil},
+		{"BELL", 3, "\t\tORG $300", 0x300, nil},
+		{"BELL", 4, "START\tLDA #\"A\"", 0x300, []byte{0xA9, 0xC1}},
+		{"BELL", 5, "\t\tJSR COUT", 0x302, []byte{0x20, 0xED, 0xFD}},
+		{"BELL", 6, "\t\tJMP START", 0x305, []byte{0x4C, 0x00, 0x03}},
+	}
+	if len(expectedLines) != len(result.Lines) {
+		t.Fatalf("Expected %d lines; got %v", len(expectedLines), result.Lines)
+	}
+	for i, line := range result.Lines {
+		expected := expectedLines[i]
+		if line.File != expected.File || line.Number != expected.Number || line.Text != expected.Text ||
+			line.Address != expected.Address || !bytes.Equal(line.Bytes, expected.Bytes) {
+			t.Errorf("Expected %+v; got %+v", expected, line)
+		}
+	}
+}
+
+func TestResultForwardReference(t *testing.T) {
+	result, err := AssembleWithOptions(strings.NewReader(`
+		ORG $300
+		JMP END
+END		RTS
+`), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line := result.Lines[2]
+	if !bytes.Equal(line.Bytes, []byte{0x4C, 0x03, 0x03}) {
+		t.Errorf("Expected the fixed-up bytes; got %x", line.Bytes)
+	}
+}
+
+func TestResultIncludes(t *testing.T) {
+	files := map[string]string{
+		"MAIN": "\tORG $300\n\tPUT T.LIB\n\tRTS\n",
+		"LIB":  "\tNOP\n",
+	}
+	open := func(name string) (io.ReadCloser, error) {
+		src, ok := files[strings.TrimPrefix(name, "T.")]
+		if !ok {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return ioutil.NopCloser(strings.NewReader(src)), nil
+	}
+
+	result, err := AssembleWithOptions(nil, Options{Name: "MAIN", Open: open})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sources []string
+	for _, line := range result.Lines {
+		if len(line.Bytes) > 0 {
+			sources = append(sources, line.File)
+		}
+	}
+	if !reflect.DeepEqual(sources, []string{"T.LIB", "MAIN"}) {
+		t.Errorf("Expected the NOP from T.LIB and RTS from MAIN; got %v", sources)
+	}
+
+	// In a subdirectory, the included files are named as the source is.
+	fsys := fstest.MapFS{
+		"src/MAIN":  {Data: []byte(files["MAIN"])},
+		"src/T.LIB": {Data: []byte(files["LIB"] + "UNUSED\tRTS\n")},
+	}
+	result, err = AssembleWithOptions(nil, Options{
+		Name:     "src/MAIN",
+		FS:       fsys,
+		Warnings: map[string]bool{WarnUnusedLabel: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := lineFiles(result); !reflect.DeepEqual(files, []string{"src/T.LIB", "src/T.LIB", "src/MAIN"}) {
+		t.Errorf("Expected lines from src/T.LIB and src/MAIN; got %v", files)
+	}
+	if len(result.Warnings) != 1 || result.Warnings[0].File != "src/T.LIB" {
+		t.Errorf("Expected a warning in src/T.LIB; got %v", result.Warnings)
+	}
+}
+
+// lineFiles returns the file of each line of result that has bytes.
+func lineFiles(result *Result) (files []string) {
+	for _, line := range result.Lines {
+		if len(line.Bytes) > 0 {
+			files = append(files, line.File)
+		}
+	}
+	return
+}
+
+func TestResultIncludesSourceNames(t *testing.T) {
+	open := mapOpener(map[string]string{
+		"MAIN":  "\tORG $300\n\tPUT LIB\n\tRTS\n",
+		"T.LIB": "\tNOP\n",
+	})
+
+	result, err := AssembleWithOptions(nil, Options{Name: "MAIN", Open: open})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := lineFiles(result); !reflect.DeepEqual(files, []string{"T.LIB", "MAIN"}) {
+		t.Errorf("Expected the NOP from T.LIB and RTS from MAIN; got %v", files)
+	}
+}
+
+func TestResultIncludesFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"src/T.MAIN": {Data: []byte("\tORG $300\n\tPUT LIB\n\tRTS\n")},
+		"src/LIB.S":  {Data: []byte("\tNOP\n")},
+	}
+
+	result, err := AssembleWithOptions(nil, Options{Name: "src/MAIN", FS: fsys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Name != "src/T.MAIN" {
+		t.Errorf("Expected the source to be named src/T.MAIN; got %s", result.Name)
+	}
+	if files := lineFiles(result); !reflect.DeepEqual(files, []string{"src/LIB.S", "src/T.MAIN"}) {
+		t.Errorf("Expected the NOP from src/LIB.S and RTS from src/T.MAIN; got %v", files)
+	}
+}
+
+func TestResultTargetWarnings(t *testing.T) {
+	result, err := AssembleWithOptions(strings.NewReader(`
+		ORG $400
+		RTS
+`), Options{Target: "dos33"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Warning{{
+		Line:     2,
+		Message:  "segment at $0400 uses $0400-$0400, which is reserved for text page 1 ($0400-$07FF)",
+		Category: WarnMemory,
+	}}
+	if !reflect.DeepEqual(expected, result.Warnings) {
+		t.Errorf("Expected %v; got %v", expected, result.Warnings)
+	}
+}
+
+func TestResultCharset(t *testing.T) {
+	result, err := AssembleWithOptions(strings.NewReader(`
+		ORG $300
+		SCR "a"
+`), Options{Charset: "II+"})
+	if err == nil {
+		t.Errorf("Expected no lowercase in the II+ set; got %x", result.Segments[0].Data)
+	}
+
+	if _, err = AssembleWithOptions(strings.NewReader(" NOP\n"), Options{Charset: "C64"}); err == nil {
+		t.Error("Expected an unknown character set error")
+	}
+}
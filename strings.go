@@ -0,0 +1,118 @@
+package a2asm
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// str handles the string directives. Each takes a string between a pair of
+// delimiters, which may be any character; delimiters before ' in ASCII, such
+// as ", set the high bit of each character, others such as ' or / clear it.
+// Hex bytes may follow the closing delimiter after a comma, as in
+// ASC "HELLO",8D00.
+//
+//	ASC  the characters as they are
+//	DCI  with the high bit of the last character flipped
+//	REV  in reverse order
+//	STR  prefixed with the number of characters
+//	SCR  as normal text on the screen, in the CHARSET selected
+//	INV  in inverse video
+//	FLS  flashing
+//	MTX  as MouseText
+func (s *state) str(mneumonic, operand string) error {
+	text, rest, err := readDelimited([]byte(operand))
+	if err != nil {
+		return err
+	}
+
+	var tail []byte
+	if len(rest) > 0 && rest[0] == ',' {
+		if tail, err = parseHex(string(rest[1:])); err != nil {
+			return err
+		}
+	} else if len(rest) > 0 {
+		return fmt.Errorf("unexpected character after string: %c", rest[0])
+	}
+
+	switch mneumonic {
+	case "DCI":
+		if len(text) > 0 {
+			text[len(text)-1] ^= highASCII
+		}
+
+	case "SCR", "INV", "FLS", "MTX":
+		for i, ch := range text {
+			if text[i], err = s.Charset.screenCode(ch, mneumonic); err != nil {
+				return err
+			}
+		}
+
+	case "REV":
+		for i, j := 0, len(text)-1; i < j; i, j = i+1, j-1 {
+			text[i], text[j] = text[j], text[i]
+		}
+
+	case "STR":
+		if len(text) > 0xFF {
+			return fmt.Errorf("string is %d characters; STR allows at most 255", len(text))
+		}
+		text = append([]byte{byte(len(text))}, text...)
+	}
+
+	for _, b := range append(text, tail...) {
+		s.write(b)
+	}
+
+	return nil
+}
+
+// readDelimited reads the delimited string at the start of line and returns
+// its characters, with the high bit set if the delimiter calls for it, and
+// what follows the closing delimiter.
+func readDelimited(line []byte) (text, rest []byte, err error) {
+	if len(line) == 0 || line[0] == ' ' || line[0] == '\t' || line[0] == ';' {
+		return nil, nil, fmt.Errorf("missing string")
+	}
+
+	delim := line[0]
+	end := bytes.IndexByte(line[1:], delim)
+	if end < 0 {
+		return nil, nil, fmt.Errorf("unterminated string")
+	}
+
+	var mask byte
+	if delim < '\'' {
+		mask = highASCII
+	}
+
+	text = make([]byte, end)
+	for i, ch := range line[1 : end+1] {
+		text[i] = ch&^highASCII | mask
+	}
+
+	return text, line[end+2:], nil
+}
+
+// parseHex reads pairs of hex digits, optionally separated by commas, from
+// operand.
+func parseHex(operand string) (data []byte, err error) {
+	for i := 0; i < len(operand); i++ {
+		if operand[i] == ',' {
+			continue
+		}
+		if i+1 >= len(operand) || !isHex(operand[i]) || !isHex(operand[i+1]) {
+			return nil, fmt.Errorf("expected pairs of hex digits; got %s", operand[i:])
+		}
+
+		num, _ := strconv.ParseUint(operand[i:i+2], 16, 8)
+		data = append(data, byte(num))
+		i++
+	}
+
+	if len(data) == 0 {
+		return nil, fmt.Errorf("missing hex digits")
+	}
+
+	return
+}
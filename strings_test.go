@@ -0,0 +1,49 @@
+package a2asm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStringDirectives(t *testing.T) {
+	tests := map[string]string{
+		` ASC "HI"`:         "\xC8\xC9",
+		` ASC 'HI'`:         "HI",
+		` ASC !A"B!`:        "\xC1\xA2\xC2",
+		` ASC /A B/`:        "A B",
+		` ASC "HELLO",8D00`: "\xC8\xC5\xCC\xCC\xCF\x8D\x00",
+		` ASC 'AB',0D,0A`:   "AB\x0D\x0A",
+		` DCI "HI"`:         "\xC8\x49",
+		` DCI 'HI'`:         "H\xC9",
+		` REV "ABC"`:        "\xC3\xC2\xC1",
+		` STR "HI"`:         "\x02\xC8\xC9",
+		` STR 'HI',8D`:      "\x02HI\x8D",
+		` INV "A1 @"`:       "\x01\x31\x20\x00",
+		` FLS 'A1'`:         "\x41\x71",
+		` HEX 01,0203`:      "\x01\x02\x03",
+	}
+
+	for src, expected := range tests {
+		actual := assembleBytes(t, src)
+		if !bytes.Equal([]byte(expected), actual) {
+			t.Errorf("%s: expected %x; got %x", src, expected, actual)
+		}
+	}
+}
+
+func TestStringErrors(t *testing.T) {
+	tests := map[string]string{
+		` ASC "HI`:    "line 1 - unterminated string",
+		` ASC "HI"X`:  "line 1 - unexpected character after string: X",
+		` ASC "HI",8`: "line 1 - expected pairs of hex digits; got 8",
+		` STR`:        "line 1 - missing string",
+	}
+
+	for src, expected := range tests {
+		_, err := AssembleSegments(strings.NewReader(src))
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected %q; got %v", src, expected, err)
+		}
+	}
+}
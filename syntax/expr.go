@@ -0,0 +1,196 @@
+package syntax
+
+import (
+	"fmt"
+)
+
+// Expr is an expression in an operand. Its String is the expression as
+// written.
+type Expr interface {
+	Column() int // where it starts, counting from 1
+	String() string
+}
+
+type (
+	// Number is a literal number: $FDED, %1010 or 42.
+	Number struct {
+		Pos   int
+		Text  string
+		Value uint16
+	}
+
+	// Char is a character: 'A' is its ASCII code and "A" has the high bit
+	// set too.
+	Char struct {
+		Pos   int
+		Text  string
+		Value uint16
+	}
+
+	// Ident is a label: global, local (:LOOP or .LOOP) or a variable
+	// (]COUNT).
+	Ident struct {
+		Pos  int
+		Name string
+	}
+
+	// Here is *, the address of the line.
+	Here struct {
+		Pos int
+	}
+
+	// Unary is -X, or <X or >X selecting the low or high byte of X.
+	Unary struct {
+		Pos int
+		Op  byte
+		X   Expr
+	}
+
+	// Str is a delimited string, as in the message of ASSERT.
+	Str struct {
+		Pos  int
+		Text string // with its delimiters
+	}
+
+	// Binary is X Op Y. Operators are applied from left to right, without
+	// precedence: +, -, *, /, & (and), ! (exclusive or), and the comparisons
+	// <, =, > and # (not equal).
+	Binary struct {
+		X  Expr
+		Op byte
+		Y  Expr
+	}
+)
+
+func (x *Number) Column() int { return x.Pos }
+func (x *Char) Column() int   { return x.Pos }
+func (x *Ident) Column() int  { return x.Pos }
+func (x *Here) Column() int   { return x.Pos }
+func (x *Unary) Column() int  { return x.Pos }
+func (x *Str) Column() int    { return x.Pos }
+func (x *Binary) Column() int { return x.X.Column() }
+
+func (x *Number) String() string { return x.Text }
+func (x *Char) String() string   { return x.Text }
+func (x *Ident) String() string  { return x.Name }
+func (x *Here) String() string   { return "*" }
+func (x *Unary) String() string  { return string(x.Op) + x.X.String() }
+func (x *Str) String() string    { return x.Text }
+func (x *Binary) String() string { return x.X.String() + string(x.Op) + x.Y.String() }
+
+// Inspect calls f for x and then, if f returns true, for each expression in
+// it, from left to right.
+func Inspect(x Expr, f func(Expr) bool) {
+	if x == nil || !f(x) {
+		return
+	}
+	switch x := x.(type) {
+	case *Unary:
+		Inspect(x.X, f)
+	case *Binary:
+		Inspect(x.X, f)
+		Inspect(x.Y, f)
+	}
+}
+
+// ParseExpr parses text, which starts in column pos of its line, as an
+// expression. A leading < or > selects a byte of the whole expression.
+func ParseExpr(text string, pos int) (Expr, error) {
+	tokens, err := Scan(text, pos)
+	if err != nil {
+		return nil, err
+	}
+	return parseTokens(text, pos, tokens)
+}
+
+// parseTokens parses the tokens scanned from text, which starts in column pos,
+// as an expression.
+func parseTokens(text string, pos int, tokens []Token) (Expr, error) {
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("missing expression")
+	}
+
+	p := parser{text, pos, tokens}
+	if tok := p.tokens[0]; tok.Text == "<" || tok.Text == ">" {
+		p.tokens = p.tokens[1:]
+		x, err := p.arithmetic()
+		if err != nil {
+			return nil, err
+		}
+		return &Unary{tok.Pos, tok.Text[0], x}, nil
+	}
+	return p.arithmetic()
+}
+
+type parser struct {
+	text   string
+	pos    int
+	tokens []Token
+}
+
+// arithmetic parses the terms and operators of an expression.
+func (p *parser) arithmetic() (Expr, error) {
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("missing expression")
+	}
+
+	var x Expr
+	var err error
+	if tok := p.tokens[0]; tok.Text == "-" && len(p.tokens) > 1 {
+		p.tokens = p.tokens[1:]
+		term, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		x = &Unary{tok.Pos, '-', term}
+	} else if x, err = p.term(); err != nil {
+		return nil, err
+	}
+
+	for len(p.tokens) > 0 {
+		op := p.tokens[0]
+		switch op.Text {
+		case "+", "-", "*", "/", "&", "!", "<", "=", ">", "#":
+		default:
+			return nil, fmt.Errorf("invalid arithmetic operator: %s", op.Text[:1])
+		}
+
+		p.tokens = p.tokens[1:]
+		if len(p.tokens) == 0 {
+			return nil, fmt.Errorf("missing term after %s", op.Text)
+		}
+
+		y, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		x = &Binary{x, op.Text[0], y}
+	}
+
+	return x, nil
+}
+
+// term parses a number, character, label or *.
+func (p *parser) term() (Expr, error) {
+	tok := p.tokens[0]
+	p.tokens = p.tokens[1:]
+
+	switch tok.Kind {
+	case NumberToken:
+		return &Number{tok.Pos, tok.Text, tok.Value}, nil
+	case CharToken:
+		return &Char{tok.Pos, tok.Text, tok.Value}, nil
+	case IdentToken:
+		return &Ident{tok.Pos, tok.Text}, nil
+	}
+
+	if tok.Text == "*" {
+		return &Here{tok.Pos}, nil
+	}
+	end := len(p.text)
+	if len(p.tokens) > 0 {
+		last := p.tokens[len(p.tokens)-1]
+		end = last.Pos - p.pos + len(last.Text)
+	}
+	return nil, fmt.Errorf("expected hex, binary, or decimal literal; got %s", p.text[tok.Pos-p.pos:end])
+}
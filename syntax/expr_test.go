@@ -0,0 +1,65 @@
+package syntax
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScan(t *testing.T) {
+	tokens, err := Scan(`<LABEL+$1F*%101-'A'!"B`, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Token{
+		{PunctToken, "<", 10, 0},
+		{IdentToken, "LABEL", 11, 0},
+		{PunctToken, "+", 16, 0},
+		{NumberToken, "$1F", 17, 0x1F},
+		{PunctToken, "*", 20, 0},
+		{NumberToken, "%101", 21, 5},
+		{PunctToken, "-", 25, 0},
+		{CharToken, "'A'", 26, 'A'},
+		{PunctToken, "!", 29, 0},
+		{CharToken, `"B`, 30, 'B' | 0x80},
+	}
+	if !reflect.DeepEqual(expected, tokens) {
+		t.Errorf("Expected %v; got %v", expected, tokens)
+	}
+}
+
+func TestParseExpr(t *testing.T) {
+	x, err := ParseExpr(">-:LOOP+2*3/*", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &Unary{5, '>', &Binary{
+		&Binary{
+			&Binary{
+				&Unary{6, '-', &Ident{7, ":LOOP"}},
+				'+', &Number{13, "2", 2},
+			},
+			'*', &Number{15, "3", 3},
+		},
+		'/', &Here{17},
+	}}
+	if !reflect.DeepEqual(expected, x) {
+		t.Errorf("Expected %v; got %v", expected, x)
+	}
+
+	if x.String() != ">-:LOOP+2*3/*" {
+		t.Errorf("Expected the expression back; got %s", x)
+	}
+
+	var names []string
+	Inspect(x, func(x Expr) bool {
+		if id, ok := x.(*Ident); ok {
+			names = append(names, id.Name)
+		}
+		return true
+	})
+	if !reflect.DeepEqual([]string{":LOOP"}, names) {
+		t.Errorf("Expected to find :LOOP; got %v", names)
+	}
+}
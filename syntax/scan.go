@@ -0,0 +1,132 @@
+package syntax
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Kind is the kind of a Token.
+type Kind int
+
+// Token kinds
+const (
+	NumberToken Kind = iota + 1 // $FDED, %1010 or 42
+	CharToken                   // 'A' or "A", the closing quote optional
+	IdentToken                  // a label, or X or Y after a comma
+	PunctToken                  // any other character, such as + or (
+)
+
+func (kind Kind) String() string {
+	switch kind {
+	case NumberToken:
+		return "number"
+	case CharToken:
+		return "character"
+	case IdentToken:
+		return "identifier"
+	case PunctToken:
+		return "punctuation"
+	}
+	return fmt.Sprintf("Kind(%d)", int(kind))
+}
+
+// Token is a number, character, identifier or punctuation in an operand.
+type Token struct {
+	Kind  Kind
+	Text  string // as written
+	Pos   int    // the column it starts in, counting from 1
+	Value uint16 // of a number or character
+}
+
+// highASCII is the bit set by double quotes, as in "A".
+const highASCII = 0x80
+
+// Scan splits the operand text, which starts in column pos of its line, into
+// tokens. Operands have no blanks, except in a quoted character.
+func Scan(text string, pos int) ([]Token, error) {
+	var tokens []Token
+	for i := 0; i < len(text); {
+		tok := Token{Kind: PunctToken, Pos: pos + i}
+		start := i
+
+		switch ch := text[i]; {
+		case IsLabelStart(ch):
+			tok.Kind = IdentToken
+			for i++; i < len(text) && IsLabelChar(text[i]); i++ {
+			}
+
+		case ch == '$' || ch == '%' || isDigit(ch):
+			tok.Kind = NumberToken
+			base, digits := 10, i
+			switch ch {
+			case '$':
+				base, digits = 16, i+1
+			case '%':
+				base, digits = 2, i+1
+			}
+			for i = digits; i < len(text) && isDigitIn(text[i], base); i++ {
+			}
+			num, err := strconv.ParseUint(text[digits:i], base, 16)
+			if err != nil {
+				if i == digits {
+					return tokens, fmt.Errorf("expected hex, binary, or decimal literal; got %s", text[start:])
+				}
+				return tokens, err
+			}
+			tok.Value = uint16(num)
+
+		case ch == '\'' || ch == '"':
+			if i+1 == len(text) {
+				return tokens, fmt.Errorf("missing character after %c", ch)
+			}
+			tok.Kind = CharToken
+			tok.Value = uint16(text[i+1])
+			if ch == '"' {
+				tok.Value |= highASCII
+			}
+			i += 2
+			if i < len(text) && text[i] == ch {
+				i++
+			}
+
+		default:
+			i++
+		}
+
+		tok.Text = text[start:i]
+		tokens = append(tokens, tok)
+	}
+	return tokens, nil
+}
+
+// IsLabelStart is whether a label may start with ch.
+func IsLabelStart(ch byte) bool {
+	return isLetter(ch) || ch == '_' || ch == '.' || ch == ':' || ch == ']'
+}
+
+// IsLabelChar is whether ch may follow the start of a label.
+func IsLabelChar(ch byte) bool {
+	return IsLabelStart(ch) || isDigit(ch)
+}
+
+func isLetter(ch byte) bool {
+	return 'A' <= ch && ch <= 'Z' || 'a' <= ch && ch <= 'z'
+}
+
+func isDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
+
+func isDigitIn(ch byte, base int) bool {
+	switch base {
+	case 2:
+		return ch == '0' || ch == '1'
+	case 16:
+		return isDigit(ch) || 'A' <= ch && ch <= 'F' || 'a' <= ch && ch <= 'f'
+	}
+	return isDigit(ch)
+}
+
+func isBlank(ch byte) bool {
+	return ch == ' ' || ch == '\t'
+}
@@ -0,0 +1,502 @@
+// Package syntax parses MERLIN source into lines and prints them back.
+//
+// Each line is split into its label, opcode, operand and comment fields, as
+// written, along with the blanks between them, so that printing a line gives
+// back exactly the source it was parsed from. The operand of an instruction
+// is parsed into its addressing mode and an expression tree, and the
+// operands of directives such as DFB into a list of expressions:
+//
+//	START   LDA   #<MSG+1     ; LOW BYTE
+//	        DFB   $0D,"A",END-START
+//
+// Lines and columns count from 1.
+package syntax
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Field is a field of a line as written.
+type Field struct {
+	Space string // the blanks before it
+	Text  string
+	Pos   int // the column Text starts in, or 0 if there is none
+}
+
+// Line is a line of source.
+type Line struct {
+	Number int
+
+	// Label, Opcode and Operand are empty on lines that are all comment:
+	// those starting with * or ;. Comment is anything after the operand.
+	Label, Opcode, Operand, Comment Field
+	Trailing                        string // the blanks after the last field
+
+	// Instruction, Mode and Size are set by ParseLine for instructions.
+	// Instruction is the mnemonic without any character after it that
+	// forces absolute addressing, as in LDA:.
+	Instruction string
+	Mode        Mode
+	Size        Size
+
+	// Args are the expressions of the operand: the value or address of an
+	// instruction, or the items of directives such as DFB and EQU, and the
+	// message of ASSERT. They are set by ParseLine. The \ of DS \ and ERR \
+	// is only in the Operand.
+	Args []Expr
+}
+
+// Mode is how an instruction's operand is written.
+type Mode int
+
+// Addressing modes
+const (
+	NoOperand   Mode = iota // implied
+	Accumulator             // A
+	Immediate               // #expr
+	Direct                  // expr: zero page, absolute or relative
+	DirectX                 // expr,X
+	DirectY                 // expr,Y
+	Indirect                // (expr)
+	IndirectX               // (expr,X)
+	IndirectY               // (expr),Y
+)
+
+func (mode Mode) String() string {
+	switch mode {
+	case NoOperand:
+		return "implied"
+	case Accumulator:
+		return "accumulator"
+	case Immediate:
+		return "immediate"
+	case Direct:
+		return "direct"
+	case DirectX:
+		return "direct,X"
+	case DirectY:
+		return "direct,Y"
+	case Indirect:
+		return "indirect"
+	case IndirectX:
+		return "indirect,X"
+	case IndirectY:
+		return "indirect,Y"
+	}
+	return fmt.Sprintf("Mode(%d)", int(mode))
+}
+
+// Size is the size of address an instruction is forced to use.
+type Size int
+
+// Sizes
+const (
+	AnySize  Size = iota // zero page if the address fits, absolute if not
+	Absolute             // LDA: $10 or LDA a:$10
+	ZeroPage             // LDA z:LABEL
+)
+
+// instructions are the 6502 mnemonics.
+var instructions = map[string]bool{
+	"ADC": true, "AND": true, "ASL": true, "BCC": true, "BCS": true, "BEQ": true,
+	"BIT": true, "BMI": true, "BNE": true, "BPL": true, "BRK": true, "BVC": true,
+	"BVS": true, "CLC": true, "CLD": true, "CLI": true, "CLV": true, "CMP": true,
+	"CPX": true, "CPY": true, "DEC": true, "DEX": true, "DEY": true, "EOR": true,
+	"INC": true, "INX": true, "INY": true, "JMP": true, "JSR": true, "LDA": true,
+	"LDX": true, "LDY": true, "LSR": true, "NOP": true, "ORA": true, "PHA": true,
+	"PHP": true, "PLA": true, "PLP": true, "ROL": true, "ROR": true, "RTI": true,
+	"RTS": true, "SBC": true, "SEC": true, "SED": true, "SEI": true, "STA": true,
+	"STX": true, "STY": true, "TAX": true, "TAY": true, "TSX": true, "TXA": true,
+	"TXS": true, "TYA": true,
+}
+
+// IsInstruction is whether mnemonic, in uppercase, is a 6502 instruction.
+func IsInstruction(mnemonic string) bool {
+	return instructions[mnemonic]
+}
+
+// stringOpcodes take a delimited string operand that may hold blanks.
+var stringOpcodes = map[string]bool{
+	"ASC": true, "DCI": true, "INV": true, "FLS": true, "REV": true, "STR": true,
+	"SCR": true, "MTX": true,
+}
+
+// IsString is whether the operand of the directive, in uppercase, is a
+// delimited string, such as ASC "HI THERE".
+func IsString(mnemonic string) bool {
+	return stringOpcodes[mnemonic]
+}
+
+// exprOpcodes take a list of expressions.
+var exprOpcodes = map[string]bool{
+	"EQU": true, "ORG": true, "DS": true, "DUM": true, "DFB": true, "DA": true,
+	"DW": true, "DDB": true, "ERR": true, "ASSERT": true,
+}
+
+// Mnemonic returns the opcode in uppercase, with = as EQU.
+func (l *Line) Mnemonic() string {
+	if l.Opcode.Text == "=" {
+		return "EQU"
+	}
+	return strings.ToUpper(l.Opcode.Text)
+}
+
+// IsComment is whether the line is all comment, or blank.
+func (l *Line) IsComment() bool {
+	return l.Label.Text == "" && l.Opcode.Text == ""
+}
+
+// Columns returns the column the statement on the line starts in, and the
+// one just past where it ends, before any comment. Both are 0 on a line that
+// is all comment.
+func (l *Line) Columns() (start, end int) {
+	for _, f := range []Field{l.Label, l.Opcode, l.Operand} {
+		if f.Pos == 0 {
+			continue
+		}
+		if start == 0 {
+			start = f.Pos
+		}
+		end = f.Pos + len(f.Text)
+	}
+	return start, end
+}
+
+// String returns the line as written.
+func (l *Line) String() string {
+	var b strings.Builder
+	for _, f := range []Field{l.Label, l.Opcode, l.Operand, l.Comment} {
+		b.WriteString(f.Space)
+		b.WriteString(f.Text)
+	}
+	b.WriteString(l.Trailing)
+	return b.String()
+}
+
+// SplitLine splits text, the line number of a source, into its fields.
+func SplitLine(number int, text string) *Line {
+	l := &Line{Number: number}
+
+	end := len(text)
+	for end > 0 && (isBlank(text[end-1]) || text[end-1] == '\r') {
+		end--
+	}
+	text, l.Trailing = text[:end], text[end:]
+
+	// field reads the field after any blanks at i, up to where stop says it
+	// ends, unless it would be empty.
+	i := 0
+	field := func(f *Field, stop func(i int) int) {
+		j := i
+		for j < len(text) && isBlank(text[j]) {
+			j++
+		}
+		if j == len(text) {
+			return
+		}
+		if k := stop(j); k > j {
+			*f = Field{text[i:j], text[j:k], j + 1}
+			i = k
+		}
+	}
+	blank := func(i int) int {
+		for i < len(text) && !isBlank(text[i]) {
+			i++
+		}
+		return i
+	}
+	rest := func(int) int { return len(text) }
+
+	trimmed := strings.TrimLeft(text, " \t")
+	if trimmed == "" || trimmed[0] == '*' || trimmed[0] == ';' {
+		field(&l.Comment, rest)
+		return l
+	}
+
+	if !isBlank(text[0]) {
+		field(&l.Label, blank)
+	}
+
+	field(&l.Opcode, func(i int) int {
+		if text[i] == '=' {
+			return i + 1
+		}
+		for i < len(text) && !isBlank(text[i]) && text[i] != ';' {
+			i++
+		}
+		return i
+	})
+
+	if l.Opcode.Text != "" {
+		field(&l.Operand, func(i int) int {
+			if IsString(l.Mnemonic()) && text[i] != ';' {
+				// The first character delimits the string, blanks and all.
+				if end := strings.IndexByte(text[i+1:], text[i]); end >= 0 {
+					i += end + 2
+				}
+			}
+			for i < len(text) && !isBlank(text[i]) && text[i] != ';' {
+				switch {
+				case text[i] == ',' && l.Mnemonic() == "ASSERT" && i+1 < len(text):
+					// The message is a delimited string, blanks and all.
+					if end := strings.IndexByte(text[i+2:], text[i+1]); end >= 0 {
+						i += end + 2
+					}
+				case text[i] == '\'' || text[i] == '"':
+					i += quotedLength(text[i:])
+				}
+				i++
+			}
+			return i
+		})
+	}
+
+	field(&l.Comment, rest)
+	return l
+}
+
+// quotedLength returns how many characters follow the quote starting text: the
+// quoted character, and the closing quote if there is one.
+func quotedLength(text string) int {
+	switch {
+	case len(text) > 2 && text[2] == text[0]:
+		return 2
+	case len(text) > 1:
+		return 1
+	}
+	return 0
+}
+
+// ParseLine splits text, the line number of a source, into its fields and
+// parses its operand. The line is returned even if the operand cannot be
+// parsed.
+func ParseLine(number int, text string) (*Line, error) {
+	l := SplitLine(number, text)
+	mnemonic := l.Mnemonic()
+
+	var err error
+	switch {
+	case len(mnemonic) == 4 && IsInstruction(mnemonic[:3]) && !isLetter(mnemonic[3]):
+		l.Instruction = mnemonic[:3]
+		l.Size = Absolute
+	case IsInstruction(mnemonic):
+		l.Instruction = mnemonic
+	case exprOpcodes[mnemonic]:
+		l.Args, err = parseArgs(mnemonic, l.Operand.Text, l.Operand.Pos)
+		return l, l.errorf(err)
+	default:
+		return l, nil
+	}
+
+	var size Size
+	var x Expr
+	l.Mode, size, x, err = ParseOperand(l.Operand.Text, l.Operand.Pos)
+	if size != AnySize {
+		l.Size = size
+	}
+	if x != nil {
+		l.Args = []Expr{x}
+	}
+	return l, l.errorf(err)
+}
+
+// parseArgs parses the operand of a directive that takes expressions.
+func parseArgs(mnemonic, text string, pos int) ([]Expr, error) {
+	switch mnemonic {
+	case "ERR":
+		// ERR \addr checks that the code does not run past addr.
+		if strings.HasPrefix(text, "\\") {
+			text, pos = text[1:], pos+1
+		}
+	case "DS":
+		// DS \ fills to the end of the page, with the value after it if any.
+		if strings.HasPrefix(text, "\\") {
+			text, pos = text[1:], pos+1
+			if text == "" {
+				return nil, nil
+			}
+			if text[0] != ',' {
+				return nil, fmt.Errorf("expected , after \\")
+			}
+			text, pos = text[1:], pos+1
+		}
+	case "ASSERT":
+		// The expression, and the message if a comma follows it.
+		end := 0
+		for end < len(text) && text[end] != ',' {
+			if text[end] == '\'' || text[end] == '"' {
+				end += quotedLength(text[end:])
+			}
+			end++
+		}
+		x, err := ParseExpr(text[:end], pos)
+		if err != nil {
+			return nil, err
+		}
+		args := []Expr{x}
+		if end < len(text) {
+			args = append(args, &Str{pos + end + 1, text[end+1:]})
+		}
+		return args, nil
+	}
+
+	tokens, err := Scan(text, pos)
+	if err != nil {
+		return nil, err
+	}
+
+	var args []Expr
+	for {
+		i := 0
+		for i < len(tokens) && tokens[i].Text != "," {
+			i++
+		}
+		item := tokens[:i]
+		if len(item) > 1 && item[0].Text == "#" {
+			// A value may be written as an immediate operand, as in DFB #$12.
+			item = item[1:]
+		}
+		x, err := parseTokens(text, pos, item)
+		if err != nil {
+			return args, err
+		}
+		args = append(args, x)
+
+		if i == len(tokens) {
+			return args, nil
+		}
+		tokens = tokens[i+1:]
+	}
+}
+
+// ParseOperand parses text, the operand of an instruction starting in column
+// pos of its line, into its addressing mode and expression. A leading a: or
+// z: forces the size of the address.
+func ParseOperand(text string, pos int) (mode Mode, size Size, x Expr, err error) {
+	if len(text) > 2 && text[1] == ':' {
+		switch text[0] {
+		case 'a', 'A':
+			size = Absolute
+		case 'z', 'Z':
+			size = ZeroPage
+		}
+		if size != AnySize {
+			text, pos = text[2:], pos+2
+		}
+	}
+
+	switch {
+	case text == "":
+		return NoOperand, size, nil, nil
+	case text == "A":
+		return Accumulator, size, nil, nil
+	case text[0] == '#':
+		x, err = ParseExpr(text[1:], pos+1)
+		return Immediate, size, x, err
+	}
+
+	tokens, err := Scan(text, pos)
+	if err != nil {
+		return Direct, size, nil, err
+	}
+
+	// index reports whether the tokens end with the punctuation and register
+	// given, such as ",X)".
+	index := func(suffix ...string) bool {
+		n := len(tokens) - len(suffix)
+		if n < 0 {
+			return false
+		}
+		for i, s := range suffix {
+			if !strings.EqualFold(tokens[n+i].Text, s) {
+				return false
+			}
+		}
+		tokens = tokens[:n]
+		return true
+	}
+
+	if text[0] == '(' {
+		tokens = tokens[1:]
+		switch {
+		case index(",", "X", ")"):
+			mode = IndirectX
+		case index(")", ",", "Y"):
+			mode = IndirectY
+		case index(")"):
+			mode = Indirect
+		default:
+			return Indirect, size, nil, fmt.Errorf("missing rparen")
+		}
+		for _, tok := range tokens {
+			if tok.Text == "," {
+				return mode, size, nil, fmt.Errorf("expected ,X) or ),Y")
+			}
+		}
+	} else {
+		switch {
+		case index(",", "X"):
+			mode = DirectX
+		case index(",", "Y"):
+			mode = DirectY
+		default:
+			mode = Direct
+		}
+	}
+
+	x, err = parseTokens(text, pos, tokens)
+	return mode, size, x, err
+}
+
+func (l *Line) errorf(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{l.Number, l.Operand.Pos, err.Error()}
+}
+
+// Error is a line whose operand cannot be parsed.
+type Error struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d - %s", e.Line, e.Msg)
+}
+
+// Parse reads and parses each line of src. All the lines are returned, along
+// with the errors of any that cannot be parsed.
+func Parse(src io.Reader) (lines []*Line, errs []error) {
+	r := bufio.NewReader(src)
+	for number := 1; ; number++ {
+		text, err := r.ReadString('\n')
+		if text != "" {
+			l, perr := ParseLine(number, strings.TrimSuffix(text, "\n"))
+			if perr != nil {
+				errs = append(errs, perr)
+			}
+			lines = append(lines, l)
+		}
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			return lines, append(errs, err)
+		}
+	}
+}
+
+// Print writes each line as written, ending each with a newline.
+func Print(w io.Writer, lines []*Line) error {
+	for _, l := range lines {
+		if _, err := fmt.Fprintln(w, l.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
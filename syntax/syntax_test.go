@@ -0,0 +1,174 @@
+package syntax
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	paths, err := filepath.Glob("../6502progs/*.s")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sources := []string{
+		"* COMMENT\n\n   \nSTART\tLDA\t#\"A\"\t; LETTER  \n" +
+			"\tASC \"HI THERE\" ; GREETING\n" +
+			"COUT = $FDED\n" +
+			"LABEL ; JUST A COMMENT\n" +
+			"  RTS;DONE\r\n" +
+			"  ; INDENTED\n",
+	}
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, string(src))
+	}
+
+	for _, src := range sources {
+		lines, errs := Parse(strings.NewReader(src))
+		if len(errs) > 0 {
+			t.Errorf("Unexpected errors: %v", errs)
+		}
+
+		var out bytes.Buffer
+		if err := Print(&out, lines); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != src {
+			t.Errorf("Expected:\n%q\nGot:\n%q", src, out.String())
+		}
+	}
+}
+
+func TestSplitLine(t *testing.T) {
+	tests := map[string][4]Field{
+		"START\tLDA #\"A\"\t; LETTER": {
+			{"", "START", 1}, {"\t", "LDA", 7}, {" ", "#\"A\"", 11}, {"\t", "; LETTER", 16},
+		},
+		" ASC \"HI THERE\",8D DONE": {
+			{}, {" ", "ASC", 2}, {" ", "\"HI THERE\",8D", 6}, {" ", "DONE", 20},
+		},
+		"COUT =$FDED": {
+			{"", "COUT", 1}, {" ", "=", 6}, {"", "$FDED", 7}, {},
+		},
+		" LDA #' ' SPACE": {
+			{}, {" ", "LDA", 2}, {" ", "#' '", 6}, {" ", "SPACE", 11},
+		},
+		" RTS;DONE": {
+			{}, {" ", "RTS", 2}, {}, {"", ";DONE", 5},
+		},
+		"LOOP ; ONLY A LABEL": {
+			{"", "LOOP", 1}, {}, {}, {" ", "; ONLY A LABEL", 6},
+		},
+		"  * STARRED": {
+			{}, {}, {}, {"  ", "* STARRED", 3},
+		},
+	}
+
+	for text, expected := range tests {
+		l := SplitLine(1, text)
+		actual := [4]Field{l.Label, l.Opcode, l.Operand, l.Comment}
+		if actual != expected {
+			t.Errorf("%q: expected %q; got %q", text, expected, actual)
+		}
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		Text        string
+		Instruction string
+		Mode        Mode
+		Size        Size
+		Args        []string
+	}{
+		{" RTS", "RTS", NoOperand, AnySize, nil},
+		{" ASL A", "ASL", Accumulator, AnySize, nil},
+		{" lda #<MSG", "LDA", Immediate, AnySize, []string{"<MSG"}},
+		{" LDA $10", "LDA", Direct, AnySize, []string{"$10"}},
+		{" LDA: $10", "LDA", Direct, Absolute, []string{"$10"}},
+		{" LDA z:ZP,x", "LDA", DirectX, ZeroPage, []string{"ZP"}},
+		{" LDX TABLE,Y", "LDX", DirectY, AnySize, []string{"TABLE"}},
+		{" JMP (VECTOR)", "JMP", Indirect, AnySize, []string{"VECTOR"}},
+		{" LDA ($40,X)", "LDA", IndirectX, AnySize, []string{"$40"}},
+		{" STA (PTR),Y", "STA", IndirectY, AnySize, []string{"PTR"}},
+		{" CMP #','", "CMP", Immediate, AnySize, []string{"','"}},
+		{" DFB $0D,\"A\",END-START", "", NoOperand, AnySize, []string{"$0D", "\"A\"", "END-START"}},
+		{" DFB #$12,#<END", "", NoOperand, AnySize, []string{"$12", "<END"}},
+		{"BUF = *+$100", "", NoOperand, AnySize, []string{"*+$100"}},
+		{" ERR \\$4000", "", NoOperand, AnySize, []string{"$4000"}},
+		{" ASSERT *<$4000,\"TOO BIG\"", "", NoOperand, AnySize, []string{"*<$4000", "\"TOO BIG\""}},
+		{" ASSERT *<$4000,\"$\" ; BIG", "", NoOperand, AnySize, []string{"*<$4000", "\"$\""}},
+		{" DS \\,$FF", "", NoOperand, AnySize, []string{"$FF"}},
+		{" DS \\", "", NoOperand, AnySize, nil},
+		{" ASC \"A,B\"", "", NoOperand, AnySize, nil},
+	}
+
+	for _, test := range tests {
+		l, err := ParseLine(1, test.Text)
+		if err != nil {
+			t.Errorf("%q: %v", test.Text, err)
+			continue
+		}
+
+		var args []string
+		for _, x := range l.Args {
+			args = append(args, x.String())
+		}
+		if l.Instruction != test.Instruction || l.Mode != test.Mode || l.Size != test.Size || !reflect.DeepEqual(args, test.Args) {
+			t.Errorf("%q: expected %s %v %v %q; got %s %v %v %q", test.Text,
+				test.Instruction, test.Mode, test.Size, test.Args, l.Instruction, l.Mode, l.Size, args)
+		}
+	}
+}
+
+func TestColumns(t *testing.T) {
+	tests := []struct {
+		text       string
+		start, end int
+	}{
+		{"START LDA #1", 1, 13},
+		{"\tRTS\t; done", 2, 5},
+		{` ASC "A;B" ;`, 2, 11},
+		{"; comment", 0, 0},
+		{"   ", 0, 0},
+	}
+
+	for _, test := range tests {
+		start, end := SplitLine(1, test.text).Columns()
+		if start != test.start || end != test.end {
+			t.Errorf("%q: expected %d-%d; got %d-%d", test.text, test.start, test.end, start, end)
+		}
+	}
+}
+
+func TestParseLineErrors(t *testing.T) {
+	tests := map[string]string{
+		" LDA (PTR":     "line 3 - missing rparen",
+		" LDA (PTR,Y)":  "line 3 - expected ,X) or ),Y",
+		" LDA #1?2":     "line 3 - invalid arithmetic operator: ?",
+		" DFB 1,2+":     "line 3 - missing term after +",
+		" ORG $":        "line 3 - expected hex, binary, or decimal literal; got $",
+		" LDA #'":       "line 3 - missing character after '",
+		" LDA $10000":   `line 3 - strconv.ParseUint: parsing "10000": value out of range`,
+		" DFB 1,,2":     "line 3 - missing expression",
+		" JMP (VECT)),": "line 3 - missing rparen",
+	}
+
+	for text, expected := range tests {
+		l, err := ParseLine(3, text)
+		if err == nil || err.Error() != expected {
+			t.Errorf("%q: expected %q; got %v", text, expected, err)
+		}
+		if l == nil || l.String() != text {
+			t.Errorf("%q: expected the line back; got %v", text, l)
+		}
+	}
+}
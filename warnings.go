@@ -0,0 +1,173 @@
+package a2asm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WarningCategory is a kind of warning that may be turned on or off.
+type WarningCategory struct {
+	Name        string
+	Description string
+	Default     bool // whether it is on unless turned off
+}
+
+// Warning categories
+const (
+	WarnTruncation      = "truncation"
+	WarnUnusedLabel     = "unused-label"
+	WarnBranchNearLimit = "branch-near-limit"
+	WarnJMPIndirectBug  = "jmp-indirect-page-bug"
+	WarnImplicitZPage   = "implicit-zero-page"
+	WarnMemory          = "memory"
+)
+
+// WarningCategories are the warnings that may be given, in the order listed
+// by a2asm -help.
+var WarningCategories = []WarningCategory{
+	{WarnTruncation, "immediate values that do not fit in a byte", true},
+	{WarnUnusedLabel, "labels that are never referred to", false},
+	{WarnBranchNearLimit, "branches within 8 bytes of their range", false},
+	{WarnJMPIndirectBug, "JMP ($xxFF), which the 6502 reads from the wrong page", true},
+	{WarnImplicitZPage, "labels assembled as zero page without z:", false},
+	{WarnMemory, "segments in memory reserved by the target", true},
+}
+
+// ignoreDirective, in a comment, turns off warnings for its line:
+//
+//	LDA #MSG        ; a2asm:ignore truncation
+//
+// With no categories named, all warnings are turned off.
+const ignoreDirective = "a2asm:ignore"
+
+// setWarnings turns on the default warnings and then turns each category in
+// enable on or off.
+func (s *state) setWarnings(enable map[string]bool) error {
+	s.Enabled = make(map[string]bool)
+	for _, category := range WarningCategories {
+		s.Enabled[category.Name] = category.Default
+	}
+
+	for name, on := range enable {
+		if _, ok := s.Enabled[name]; !ok {
+			return fmt.Errorf("unknown warning: %s", name)
+		}
+		s.Enabled[name] = on
+	}
+
+	return nil
+}
+
+// noteIgnores records comment, that of the current line, if it turns off
+// warnings.
+func (s *state) noteIgnores(comment string) {
+	if !strings.Contains(comment, ignoreDirective) {
+		return
+	}
+	if s.Ignores == nil {
+		s.Ignores = make(map[Position]string)
+	}
+	s.Ignores[Position{s.File, s.LineNumber}] = comment
+}
+
+// IsIgnored is whether comment, the comment field of a line, turns off the
+// warning or lint rule name for its line. With no names after a2asm:ignore,
+// everything is turned off.
+func IsIgnored(comment, name string) bool {
+	i := strings.Index(comment, ignoreDirective)
+	if i < 0 {
+		return false
+	}
+
+	names := strings.FieldsFunc(comment[i+len(ignoreDirective):], func(r rune) bool {
+		return r == ' ' || r == '\t' || r == ','
+	})
+	if len(names) == 0 {
+		return true
+	}
+	for _, ignored := range names {
+		if ignored == name {
+			return true
+		}
+	}
+	return false
+}
+
+// warn gives a warning of the category about the current line, unless it
+// is turned off.
+func (s *state) warn(category, format string, a ...interface{}) {
+	s.warnAt(Position{s.File, s.LineNumber}, category, format, a...)
+}
+
+// warnAt gives a warning of the category about the line at pos, unless it is
+// turned off.
+func (s *state) warnAt(pos Position, category, format string, a ...interface{}) {
+	if !s.Enabled[category] {
+		return
+	}
+
+	if IsIgnored(s.Ignores[pos], category) {
+		return
+	}
+
+	s.Warnings = append(s.Warnings, Warning{pos.File, pos.Line, fmt.Sprintf(format, a...), category})
+}
+
+// checkBranch warns about a branch to target that is within 8 bytes of the
+// furthest a branch can reach, where a little more code breaks it.
+func (s *state) checkBranch(pos Position, target string, offset int) {
+	if offset < -120 || offset > 119 {
+		s.warnAt(pos, WarnBranchNearLimit, "branch to %s is %d bytes away, near the limit", target, offset)
+	}
+}
+
+// checkIndirectJMP warns about JMP (addr) where addr is the last byte of a
+// page: the 6502 reads the high byte of the target from the start of the
+// same page rather than the next one.
+func (s *state) checkIndirectJMP(pos Position, addr uint16) {
+	if addr&0xFF == 0xFF {
+		s.warnAt(pos, WarnJMPIndirectBug, "JMP ($%04X) reads its high byte from $%04X, not $%04X", addr, addr&0xFF00, addr+1)
+	}
+}
+
+// use notes that the label name is referred to on the current line.
+func (s *state) use(name string) {
+	if name != "" && (name[0] == '<' || name[0] == '>') {
+		name = name[1:]
+	}
+	if s.Resolving {
+		return
+	}
+
+	pos := Position{s.File, s.LineNumber}
+	if uses := s.Uses[name]; len(uses) > 0 && uses[len(uses)-1] == pos {
+		return
+	}
+	s.Uses[name] = append(s.Uses[name], pos)
+}
+
+// warnUnused warns about the labels that nothing refers to. Constants, such
+// as the ROM routines an equates file names, and entry points are not
+// reported.
+func (s *state) warnUnused() {
+	entries := make(map[string]bool)
+	for _, name := range s.Entries {
+		entries[name] = true
+	}
+
+	names := make(map[Position]string)
+	for name, def := range s.Definitions {
+		if _, ok := s.Labels[name]; !ok || len(s.Uses[name]) > 0 || entries[name] {
+			continue
+		}
+		names[Position{def.File, def.LineNumber}] = name
+	}
+
+	// Report them in the order they were defined.
+	for _, line := range s.Lines {
+		pos := Position{line.File, line.Number}
+		if name, ok := names[pos]; ok {
+			s.warnAt(pos, WarnUnusedLabel, "label %s is never used", name)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package a2asm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func assembleWarnings(t *testing.T, src string, enable map[string]bool) []Warning {
+	t.Helper()
+
+	result, err := AssembleWithOptions(strings.NewReader(src), Options{Warnings: enable})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result.Warnings
+}
+
+func TestWarningCategories(t *testing.T) {
+	warnings := assembleWarnings(t, `
+		ORG $300
+PTR		= $06
+START	LDA PTR
+UNUSED	LDY #0
+		JMP (VECTOR)
+		DS 112
+		BNE START
+		DS 134
+VECTOR	DA START
+`, map[string]bool{
+		WarnUnusedLabel:     true,
+		WarnBranchNearLimit: true,
+		WarnImplicitZPage:   true,
+	})
+
+	expected := []Warning{
+		{"", 4, "PTR ($06) is assembled as zero page; use z: or a: to say which", WarnImplicitZPage},
+		{"", 5, "label UNUSED is never used", WarnUnusedLabel},
+		{"", 6, "JMP ($03FF) reads its high byte from $0300, not $0400", WarnJMPIndirectBug},
+		{"", 8, "branch to START is -121 bytes away, near the limit", WarnBranchNearLimit},
+	}
+	if !reflect.DeepEqual(expected, warnings) {
+		t.Errorf("Expected %v; got %v", expected, warnings)
+	}
+}
+
+func TestWarningDefaults(t *testing.T) {
+	src := `
+		ORG $300
+UNUSED	LDA #$1234
+		JMP ($12FF)
+`
+	warnings := assembleWarnings(t, src, nil)
+	if len(warnings) != 2 || warnings[0].Category != WarnTruncation || warnings[1].Category != WarnJMPIndirectBug {
+		t.Errorf("Expected truncation and jmp-indirect-page-bug; got %v", warnings)
+	}
+
+	warnings = assembleWarnings(t, src, map[string]bool{WarnTruncation: false, WarnJMPIndirectBug: false})
+	if len(warnings) != 0 {
+		t.Errorf("Expected no warnings; got %v", warnings)
+	}
+
+	_, err := AssembleWithOptions(strings.NewReader(src), Options{Warnings: map[string]bool{"everything": true}})
+	if err == nil || err.Error() != "unknown warning: everything" {
+		t.Errorf("Expected an unknown warning error; got %v", err)
+	}
+}
+
+func TestIgnoreWarnings(t *testing.T) {
+	warnings := assembleWarnings(t, `
+		ORG $300
+		LDA #$1234	; a2asm:ignore truncation
+		LDA #$1234	; a2asm:ignore unused-label, jmp-indirect-page-bug
+		LDA #$1234	; a2asm:ignore
+		LDA #END
+		LDA #END	; a2asm:ignore truncation
+END		RTS
+`, nil)
+
+	expected := []Warning{
+		{"", 4, "immediate value $1234 is truncated to $34; use < or > to pick a byte", WarnTruncation},
+		{"", 6, "immediate value END ($030A) is truncated to $0A; use < or > to pick a byte", WarnTruncation},
+	}
+	if !reflect.DeepEqual(expected, warnings) {
+		t.Errorf("Expected %v; got %v", expected, warnings)
+	}
+}
+
+func TestIgnoreInString(t *testing.T) {
+	warnings := assembleWarnings(t, `
+		ORG $300
+		RTS
+MSG		ASC "A;a2asm:ignore unused-label "
+`, map[string]bool{WarnUnusedLabel: true})
+
+	expected := []Warning{{"", 4, "label MSG is never used", WarnUnusedLabel}}
+	if !reflect.DeepEqual(expected, warnings) {
+		t.Errorf("Expected %v; got %v", expected, warnings)
+	}
+}
+
+func TestWarningString(t *testing.T) {
+	w := Warning{"LIB", 3, "label X is never used", WarnUnusedLabel}
+	if w.String() != "LIB: line 3 - label X is never used [unused-label]" {
+		t.Errorf("Unexpected %q", w)
+	}
+}